@@ -0,0 +1,221 @@
+// Package baggage carries request scoped values (tenant, locale, feature flag overrides, ...) across services.
+// Values are read from the incoming calls by the server interceptors, survive goroutines through Detach,
+// and are sent to the downstream calls by the client interceptors using the W3C baggage header
+package baggage
+
+import (
+	"context"
+	"github.com/apssouza22/grpc-production-go/logging"
+	"github.com/apssouza22/grpc-production-go/requestid"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// Header is the metadata key carrying the baggage, following the W3C baggage format (k1=v1,k2=v2)
+const Header = "baggage"
+
+// Limits of the W3C baggage specification
+const (
+	MaxMembers = 64
+	MaxBytes   = 8192
+)
+
+// Well known keys
+const (
+	TenantKey         = "tenant-id"
+	LocaleKey         = "locale"
+	featureFlagPrefix = "ff."
+)
+
+type bagKey struct{}
+
+// Bag is an immutable set of key/value members
+type Bag struct {
+	members map[string]string
+}
+
+// Get returns the value of the member
+func (b Bag) Get(key string) (string, bool) {
+	value, ok := b.members[key]
+	return value, ok
+}
+
+// Len returns the number of members
+func (b Bag) Len() int {
+	return len(b.members)
+}
+
+// Members returns a copy of the members
+func (b Bag) Members() map[string]string {
+	members := make(map[string]string, len(b.members))
+	for key, value := range b.members {
+		members[key] = value
+	}
+	return members
+}
+
+// With returns a new bag with the member set. An empty value removes the member
+func (b Bag) With(key string, value string) Bag {
+	members := b.Members()
+	if value == "" {
+		delete(members, key)
+	} else {
+		members[key] = value
+	}
+	return Bag{members: members}
+}
+
+// Encode returns the bag in the W3C baggage format, with the members sorted by key.
+// The members over MaxMembers or MaxBytes are dropped, so the downstream services do not reject the header
+func (b Bag) Encode() string {
+	keys := make([]string, 0, len(b.members))
+	for key := range b.members {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	parts := make([]string, 0, len(keys))
+	size := 0
+	for _, key := range keys {
+		if len(parts) >= MaxMembers {
+			break
+		}
+		part := escape(key) + "=" + escape(b.members[key])
+		if len(parts) > 0 {
+			size++
+		}
+		if size+len(part) > MaxBytes {
+			size--
+			continue
+		}
+		size += len(part)
+		parts = append(parts, part)
+	}
+	return strings.Join(parts, ",")
+}
+
+// escape percent-encodes every byte but the unreserved characters of RFC 3986, so the delimiters of the baggage
+// (",", ";", "=") and the spaces never appear in the encoded keys and values. Unlike url.QueryEscape spaces are
+// encoded as %20, the W3C baggage does not decode "+" as a space
+func escape(value string) string {
+	const hex = "0123456789ABCDEF"
+	var b strings.Builder
+	for i := 0; i < len(value); i++ {
+		c := value[i]
+		if 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' || c == '-' || c == '_' || c == '.' || c == '~' {
+			b.WriteByte(c)
+			continue
+		}
+		b.WriteByte('%')
+		b.WriteByte(hex[c>>4])
+		b.WriteByte(hex[c&15])
+	}
+	return b.String()
+}
+
+// Parse decodes a W3C baggage header. Invalid members, member properties and members over the limits are ignored.
+// The member crossing MaxBytes is dropped whole rather than truncated
+func Parse(header string) Bag {
+	members := make(map[string]string)
+	size := 0
+	for _, member := range strings.Split(header, ",") {
+		if len(members) >= MaxMembers {
+			break
+		}
+		size += len(member)
+		if size > MaxBytes {
+			break
+		}
+		size++
+		if i := strings.Index(member, ";"); i >= 0 {
+			member = member[:i]
+		}
+		kv := strings.SplitN(strings.TrimSpace(member), "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		key, err := url.PathUnescape(strings.TrimSpace(kv[0]))
+		if err != nil || key == "" {
+			continue
+		}
+		value, err := url.PathUnescape(strings.TrimSpace(kv[1]))
+		if err != nil {
+			continue
+		}
+		members[key] = value
+	}
+	return Bag{members: members}
+}
+
+// NewContext returns a context carrying the bag
+func NewContext(ctx context.Context, bag Bag) context.Context {
+	return context.WithValue(ctx, bagKey{}, bag)
+}
+
+// FromContext returns the bag carried by the context, an empty bag when there is none
+func FromContext(ctx context.Context) Bag {
+	bag, _ := ctx.Value(bagKey{}).(Bag)
+	return bag
+}
+
+// WithValue returns a context whose bag has the member set
+func WithValue(ctx context.Context, key string, value string) context.Context {
+	return NewContext(ctx, FromContext(ctx).With(key, value))
+}
+
+// Value returns the member of the bag carried by the context
+func Value(ctx context.Context, key string) string {
+	value, _ := FromContext(ctx).Get(key)
+	return value
+}
+
+// WithTenant returns a context whose bag carries the tenant id
+func WithTenant(ctx context.Context, tenant string) context.Context {
+	return WithValue(ctx, TenantKey, tenant)
+}
+
+// Tenant returns the tenant id carried by the context bag
+func Tenant(ctx context.Context) string {
+	return Value(ctx, TenantKey)
+}
+
+// WithLocale returns a context whose bag carries the locale
+func WithLocale(ctx context.Context, locale string) context.Context {
+	return WithValue(ctx, LocaleKey, locale)
+}
+
+// Locale returns the locale carried by the context bag
+func Locale(ctx context.Context) string {
+	return Value(ctx, LocaleKey)
+}
+
+// WithFeatureFlag returns a context whose bag overrides the feature flag
+func WithFeatureFlag(ctx context.Context, flag string, value string) context.Context {
+	return WithValue(ctx, featureFlagPrefix+flag, value)
+}
+
+// FeatureFlags returns the feature flag overrides carried by the context bag
+func FeatureFlags(ctx context.Context) map[string]string {
+	flags := make(map[string]string)
+	for key, value := range FromContext(ctx).members {
+		if strings.HasPrefix(key, featureFlagPrefix) {
+			flags[strings.TrimPrefix(key, featureFlagPrefix)] = value
+		}
+	}
+	return flags
+}
+
+// Detach returns a context that is not canceled with the parent but keeps its bag, request id and logger.
+// Use it when handing work over to goroutines or queues that outlive the call
+func Detach(ctx context.Context) context.Context {
+	return CopyTo(context.Background(), ctx)
+}
+
+// CopyTo copies the bag, request id and logger carried by the source context into the destination context
+func CopyTo(dst context.Context, src context.Context) context.Context {
+	dst = NewContext(dst, FromContext(src))
+	if id, ok := requestid.FromContext(src); ok {
+		dst = requestid.NewContext(dst, id)
+	}
+	return logging.NewContext(dst, logging.FromContext(src))
+}
@@ -0,0 +1,96 @@
+package baggage
+
+import (
+	"context"
+	"fmt"
+	"github.com/apssouza22/grpc-production-go/logging"
+	"github.com/apssouza22/grpc-production-go/requestid"
+	"github.com/stretchr/testify/assert"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestTypedAccessors(t *testing.T) {
+	ctx := WithTenant(context.Background(), "acme")
+	ctx = WithLocale(ctx, "pt-BR")
+	ctx = WithFeatureFlag(ctx, "new-checkout", "on")
+	assert.Equal(t, "acme", Tenant(ctx))
+	assert.Equal(t, "pt-BR", Locale(ctx))
+	assert.Equal(t, map[string]string{"new-checkout": "on"}, FeatureFlags(ctx))
+
+	ctx = WithTenant(ctx, "")
+	assert.Equal(t, "", Tenant(ctx))
+	assert.Equal(t, 2, FromContext(ctx).Len())
+}
+
+func TestBagIsImmutable(t *testing.T) {
+	parent := WithTenant(context.Background(), "acme")
+	child := WithTenant(parent, "other")
+	assert.Equal(t, "acme", Tenant(parent))
+	assert.Equal(t, "other", Tenant(child))
+}
+
+func TestEncodeParse(t *testing.T) {
+	bag := Bag{}.With(TenantKey, "acme").With("note", "a b,c=d;e+f").With("k=v", "x")
+	encoded := bag.Encode()
+	assert.Equal(t, "k%3Dv=x,note=a%20b%2Cc%3Dd%3Be%2Bf,tenant-id=acme", encoded)
+	assert.Equal(t, bag.Members(), Parse(encoded).Members())
+
+	parsed := Parse(" k1 = v1 ;prop=1, invalid, =empty, k2=v2")
+	assert.Equal(t, map[string]string{"k1": "v1", "k2": "v2"}, parsed.Members())
+}
+
+func TestParseLimits(t *testing.T) {
+	members := make([]string, MaxMembers+10)
+	for i := range members {
+		members[i] = "k" + strings.Repeat("x", i) + "=v"
+	}
+	assert.Equal(t, MaxMembers, Parse(strings.Join(members, ",")).Len())
+}
+
+func TestParseDropsTheMemberCrossingMaxBytes(t *testing.T) {
+	header := "k1=" + strings.Repeat("x", MaxBytes-10) + ",k2=abcdefghij"
+	bag := Parse(header)
+	assert.Equal(t, 1, bag.Len())
+	_, ok := bag.Get("k2")
+	assert.False(t, ok)
+}
+
+func TestEncodeLimits(t *testing.T) {
+	bag := Bag{}
+	for i := 0; i < MaxMembers+10; i++ {
+		bag = bag.With(fmt.Sprintf("k%03d", i), "v")
+	}
+	assert.Equal(t, MaxMembers, Parse(bag.Encode()).Len())
+
+	bag = Bag{}.With("a", strings.Repeat("x", MaxBytes-10)).With("b", strings.Repeat("y", 20)).With("c", "z")
+	encoded := bag.Encode()
+	assert.True(t, len(encoded) <= MaxBytes)
+	assert.Equal(t, "a,c", strings.Join(sortedKeys(Parse(encoded)), ","))
+}
+
+func sortedKeys(bag Bag) []string {
+	keys := make([]string, 0, bag.Len())
+	for key := range bag.Members() {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func TestDetach(t *testing.T) {
+	parent, cancel := context.WithCancel(context.Background())
+	parent = WithTenant(parent, "acme")
+	parent = requestid.NewContext(parent, "req-1")
+	logger := logging.Nop()
+	parent = logging.NewContext(parent, logger)
+	cancel()
+
+	detached := Detach(parent)
+	assert.NoError(t, detached.Err())
+	assert.Equal(t, "acme", Tenant(detached))
+	id, _ := requestid.FromContext(detached)
+	assert.Equal(t, "req-1", id)
+	assert.Equal(t, logger, logging.FromContext(detached))
+}
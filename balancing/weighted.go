@@ -0,0 +1,94 @@
+// Package balancing provides the client side load balancing policies not shipped with gRPC
+package balancing
+
+import (
+	"google.golang.org/grpc/balancer"
+	"google.golang.org/grpc/balancer/base"
+	"google.golang.org/grpc/balancer/weightedroundrobin"
+	"google.golang.org/grpc/resolver"
+	"sort"
+	"sync"
+)
+
+// WeightedRoundRobin is the name of the weighted round robin policy, registered when the package is imported.
+// It spreads the RPCs across the ready addresses proportionally to their weight (see WithWeight)
+const WeightedRoundRobin = weightedroundrobin.Name
+
+func init() {
+	balancer.Register(base.NewBalancerBuilderV2(WeightedRoundRobin, &weightedPickerBuilder{}, base.Config{HealthCheck: true}))
+}
+
+// WithWeight returns the address carrying the weight, stored as the address metadata the way gRPC expects it.
+// It replaces any other metadata of the address
+func WithWeight(addr resolver.Address, weight uint32) resolver.Address {
+	addr.Metadata = weightedroundrobin.AddrInfo{Weight: weight}
+	return addr
+}
+
+// Weight returns the weight of the address, 1 when it has none
+func Weight(addr resolver.Address) uint32 {
+	var weight uint32
+	switch info := addr.Metadata.(type) {
+	case weightedroundrobin.AddrInfo:
+		weight = info.Weight
+	case *weightedroundrobin.AddrInfo:
+		weight = info.Weight
+	}
+	if weight == 0 {
+		return 1
+	}
+	return weight
+}
+
+type weightedPickerBuilder struct{}
+
+func (*weightedPickerBuilder) Build(info base.PickerBuildInfo) balancer.V2Picker {
+	if len(info.ReadySCs) == 0 {
+		return base.NewErrPickerV2(balancer.ErrNoSubConnAvailable)
+	}
+	picker := &weightedPicker{}
+	for sc, scInfo := range info.ReadySCs {
+		picker.subConns = append(picker.subConns, weightedSubConn{
+			subConn: sc,
+			addr:    scInfo.Address.Addr,
+			weight:  int64(Weight(scInfo.Address)),
+		})
+	}
+	// A stable order keeps the picks sequence the same across the rebuilds of the picker
+	sort.Slice(picker.subConns, func(i, j int) bool {
+		return picker.subConns[i].addr < picker.subConns[j].addr
+	})
+	for _, sc := range picker.subConns {
+		picker.total += sc.weight
+	}
+	return picker
+}
+
+type weightedSubConn struct {
+	subConn balancer.SubConn
+	addr    string
+	weight  int64
+	current int64
+}
+
+// weightedPicker is a smooth weighted round robin: the picks of the heavy addresses are interleaved with the others
+// instead of sent in bursts
+type weightedPicker struct {
+	mu       sync.Mutex
+	subConns []weightedSubConn
+	total    int64
+}
+
+func (p *weightedPicker) Pick(balancer.PickInfo) (balancer.PickResult, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	best := 0
+	for i := range p.subConns {
+		p.subConns[i].current += p.subConns[i].weight
+		if p.subConns[i].current > p.subConns[best].current {
+			best = i
+		}
+	}
+	p.subConns[best].current -= p.total
+	return balancer.PickResult{SubConn: p.subConns[best].subConn}, nil
+}
@@ -0,0 +1,44 @@
+package balancing
+
+import (
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/balancer"
+	"google.golang.org/grpc/balancer/base"
+	"google.golang.org/grpc/resolver"
+	"testing"
+)
+
+type fakeSubConn struct {
+	name string
+}
+
+func (*fakeSubConn) UpdateAddresses([]resolver.Address) {}
+func (*fakeSubConn) Connect()                           {}
+
+func TestWeightedPicker(t *testing.T) {
+	light, heavy := &fakeSubConn{"light"}, &fakeSubConn{"heavy"}
+	picker := (&weightedPickerBuilder{}).Build(base.PickerBuildInfo{ReadySCs: map[balancer.SubConn]base.SubConnInfo{
+		light: {Address: resolver.Address{Addr: "a:1"}},
+		heavy: {Address: WithWeight(resolver.Address{Addr: "b:1"}, 3)},
+	}})
+
+	var picks []string
+	for i := 0; i < 8; i++ {
+		result, err := picker.Pick(balancer.PickInfo{})
+		assert.NoError(t, err)
+		picks = append(picks, result.SubConn.(*fakeSubConn).name)
+	}
+	assert.Equal(t, []string{"heavy", "light", "heavy", "heavy", "heavy", "light", "heavy", "heavy"}, picks)
+}
+
+func TestWeightedPickerWithoutReadySubConns(t *testing.T) {
+	picker := (&weightedPickerBuilder{}).Build(base.PickerBuildInfo{})
+	_, err := picker.Pick(balancer.PickInfo{})
+	assert.Equal(t, balancer.ErrNoSubConnAvailable, err)
+}
+
+func TestWeight(t *testing.T) {
+	assert.Equal(t, uint32(1), Weight(resolver.Address{Addr: "a:1"}))
+	assert.Equal(t, uint32(5), Weight(WithWeight(resolver.Address{Addr: "a:1"}, 5)))
+	assert.Equal(t, uint32(1), Weight(WithWeight(resolver.Address{Addr: "a:1"}, 0)))
+}
@@ -5,11 +5,14 @@ import (
 	"crypto/tls"
 	"crypto/x509"
 	"fmt"
+	"github.com/apssouza22/grpc-production-go/clientinterceptor"
+	"github.com/apssouza22/grpc-production-go/logging"
 	grpc_middleware "github.com/grpc-ecosystem/go-grpc-middleware"
-	log "github.com/sirupsen/logrus"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials"
 	"google.golang.org/grpc/keepalive"
+	"google.golang.org/grpc/resolver"
+	"net"
 )
 
 //GrpcClientConnBuilder is a builder to create GRPC connection to the GRPC Server
@@ -32,6 +35,16 @@ type GrpcConnBuilder struct {
 	ctx                  context.Context
 	transportCredentials credentials.TransportCredentials
 	err                  error
+	logger               logging.Logger
+	unaryInterceptors    []grpc.UnaryClientInterceptor
+	streamInterceptors   []grpc.StreamClientInterceptor
+	coalescedMethods     []string
+	coalescingMetadata   []string
+	dialer               func(ctx context.Context, addr string) (net.Conn, error)
+	lbPolicy             string
+	methodConfigs        []MethodConfig
+	serviceConfigFile    string
+	healthCheckService   *string
 }
 
 // WithContext set the context to be used in the dial
@@ -39,6 +52,11 @@ func (b *GrpcConnBuilder) WithContext(ctx context.Context) {
 	b.ctx = ctx
 }
 
+// WithLogger sets the logger used by the builder. The default logger is used otherwise
+func (b *GrpcConnBuilder) WithLogger(logger logging.Logger) {
+	b.logger = logger
+}
+
 // WithOptions set dial options
 func (b *GrpcConnBuilder) WithOptions(opts ...grpc.DialOption) {
 	b.options = append(b.options, opts...)
@@ -55,6 +73,18 @@ func (b *GrpcConnBuilder) WithBlock() {
 	b.options = append(b.options, grpc.WithBlock())
 }
 
+// WithContextDialer sets the function opening the network connections. Prefer it over passing grpc.WithContextDialer
+// to WithOptions, the monitored connections (see GetMonitoredConn) wrap it to record the dial failures
+func (b *GrpcConnBuilder) WithContextDialer(dialer func(ctx context.Context, addr string) (net.Conn, error)) {
+	b.dialer = dialer
+}
+
+// WithResolvers registers the name resolvers for this connection only, e.g. resolvers.NewStaticBuilder().
+// The scheme of the target selects the resolver
+func (b *GrpcConnBuilder) WithResolvers(builders ...resolver.Builder) {
+	b.options = append(b.options, grpc.WithResolvers(builders...))
+}
+
 // WithKeepAliveParams set the keep alive params
 // ClientParameters is used to set keepalive parameters on the client-side.
 // These configure how the client will actively probe to notice when a
@@ -71,14 +101,26 @@ func (b *GrpcConnBuilder) WithKeepAliveParams(params keepalive.ClientParameters)
 // By default, gRPC doesn't allow one to have more than one interceptor either on the client nor on the server side.
 // By using `grpc_middleware` we are able to provides convenient method to add a list of interceptors
 func (b *GrpcConnBuilder) WithUnaryInterceptors(interceptors []grpc.UnaryClientInterceptor) {
-	b.options = append(b.options, grpc.WithUnaryInterceptor(grpc_middleware.ChainUnaryClient(interceptors...)))
+	b.unaryInterceptors = interceptors
 }
 
 // WithUnaryInterceptors set a list of interceptors to the Grpc client for stream connection
 // By default, gRPC doesn't allow one to have more than one interceptor either on the client nor on the server side.
 // By using `grpc_middleware` we are able to provides convenient method to add a list of interceptors
 func (b *GrpcConnBuilder) WithStreamInterceptors(interceptors []grpc.StreamClientInterceptor) {
-	b.options = append(b.options, grpc.WithStreamInterceptor(grpc_middleware.ChainStreamClient(interceptors...)))
+	b.streamInterceptors = interceptors
+}
+
+// WithCoalescedMethods coalesces the identical unary calls in flight to the methods matching the globs
+// (e.g. "/config.Config/Get*") into a single RPC. See clientinterceptor.UnaryCoalescing
+func (b *GrpcConnBuilder) WithCoalescedMethods(methods ...string) {
+	b.coalescedMethods = append(b.coalescedMethods, methods...)
+}
+
+// WithCoalescingMetadata adds the outgoing metadata keys telling apart two coalesced calls, in addition to the
+// credentials. See clientinterceptor.WithCoalescingMetadata
+func (b *GrpcConnBuilder) WithCoalescingMetadata(keys ...string) {
+	b.coalescingMetadata = append(b.coalescingMetadata, keys...)
 }
 
 // ClientTransportCredentials builds transport credentials for a gRPC client using the given properties.
@@ -100,8 +142,12 @@ func (b *GrpcConnBuilder) GetConn(addr string) (*grpc.ClientConn, error) {
 	if addr == "" {
 		return nil, fmt.Errorf("target connection parameter missing. address = %s", addr)
 	}
-	log.Debugf("Target to connect = %s", addr)
-	cc, err := grpc.DialContext(b.getContext(), addr, b.options...)
+	logging.OrDefault(b.logger).Debug("Target to connect", "address", addr)
+	opts, err := b.dialOptions()
+	if err != nil {
+		return nil, err
+	}
+	cc, err := grpc.DialContext(b.getContext(), addr, opts...)
 
 	if err != nil {
 		return nil, fmt.Errorf("unable to connect to client. address = %s. error = %+v", addr, err)
@@ -111,18 +157,60 @@ func (b *GrpcConnBuilder) GetConn(addr string) (*grpc.ClientConn, error) {
 
 // GetTlsConn returns client connection to the server
 func (b *GrpcConnBuilder) GetTlsConn(addr string) (*grpc.ClientConn, error) {
-	b.options = append(b.options, grpc.WithTransportCredentials(b.transportCredentials))
-	cc, err := grpc.DialContext(
-		b.getContext(),
-		addr,
-		b.options...,
-	)
+	opts, err := b.dialOptions()
+	if err != nil {
+		return nil, err
+	}
+	cc, err := grpc.DialContext(b.getContext(), addr, append(opts, grpc.WithTransportCredentials(b.transportCredentials))...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get tls conn. Unable to connect to client. address = %s: %w", addr, err)
 	}
 	return cc, nil
 }
 
+// dialOptions returns the dial options with the interceptors chained and the service config, failing when the config
+// is invalid. The coalescing interceptor runs last, so the credentials added by the other interceptors tell apart the coalesced calls
+func (b *GrpcConnBuilder) dialOptions() ([]grpc.DialOption, error) {
+	opts := append([]grpc.DialOption{}, b.options...)
+	serviceConfig, err := b.serviceConfigOption()
+	if err != nil {
+		return nil, err
+	}
+	if serviceConfig != nil {
+		opts = append(opts, serviceConfig)
+	}
+	if b.dialer != nil {
+		opts = append(opts, grpc.WithContextDialer(b.dialer))
+	}
+	unary := b.unaryInterceptors
+	if len(b.coalescedMethods) > 0 {
+		unary = append(append([]grpc.UnaryClientInterceptor{}, unary...),
+			clientinterceptor.UnaryCoalescing(
+				clientinterceptor.WithCoalescedMethods(b.coalescedMethods...),
+				clientinterceptor.WithCoalescingMetadata(b.coalescingMetadata...),
+			))
+	}
+	if len(unary) > 0 {
+		opts = append(opts, grpc.WithUnaryInterceptor(grpc_middleware.ChainUnaryClient(unary...)))
+	}
+	if len(b.streamInterceptors) > 0 {
+		opts = append(opts, grpc.WithStreamInterceptor(grpc_middleware.ChainStreamClient(b.streamInterceptors...)))
+	}
+	return opts, nil
+}
+
+// dial connects to the server, with the transport credentials when they were set
+func (b *GrpcConnBuilder) dial(ctx context.Context, addr string) (*grpc.ClientConn, error) {
+	opts, err := b.dialOptions()
+	if err != nil {
+		return nil, err
+	}
+	if b.transportCredentials != nil {
+		opts = append(opts, grpc.WithTransportCredentials(b.transportCredentials))
+	}
+	return grpc.DialContext(ctx, addr, opts...)
+}
+
 func (b *GrpcConnBuilder) getContext() context.Context {
 	ctx := b.ctx
 	if ctx == nil {
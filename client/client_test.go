@@ -3,6 +3,7 @@ package grpc_client
 import (
 	"context"
 	"github.com/apssouza22/grpc-production-go/grpcutils"
+	"github.com/apssouza22/grpc-production-go/resolvers"
 	grpc_server "github.com/apssouza22/grpc-production-go/server"
 	"github.com/apssouza22/grpc-production-go/testdata"
 	gtest "github.com/apssouza22/grpc-production-go/testing"
@@ -10,6 +11,8 @@ import (
 	"github.com/stretchr/testify/assert"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/examples/helloworld/helloworld"
+	"net"
+	"sync"
 	"testing"
 )
 
@@ -118,3 +121,62 @@ func TestTLSConnWithInsecure(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equal(t, resp.Message, "This is a mocked service test")
 }
+
+func TestCoalescedMethods(t *testing.T) {
+	startServer()
+	defer server.Cleanup()
+	ctx := context.Background()
+	var intercepted int
+	clientBuilder := GrpcConnBuilder{}
+	clientBuilder.WithInsecure()
+	clientBuilder.WithOptions(grpc.WithContextDialer(gtest.GetBufDialer(server.GetListener())))
+	clientBuilder.WithUnaryInterceptors([]grpc.UnaryClientInterceptor{countingInterceptor(&intercepted)})
+	clientBuilder.WithUnaryInterceptors([]grpc.UnaryClientInterceptor{countingInterceptor(&intercepted)})
+	clientBuilder.WithCoalescedMethods("/helloworld.Greeter/*")
+	clientBuilder.WithCoalescingMetadata("x-tenant-id")
+	clientConn, err := clientBuilder.GetConn("localhost:50051")
+	assert.NoError(t, err)
+	defer clientConn.Close()
+
+	client := helloworld.NewGreeterClient(clientConn)
+	resp, err := client.SayHello(ctx, &helloworld.HelloRequest{Name: "test"})
+	assert.NoError(t, err)
+	assert.Equal(t, "This is a mocked service test", resp.Message)
+	// The second list of interceptors replaces the first one
+	assert.Equal(t, 1, intercepted)
+}
+
+func countingInterceptor(count *int) grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		*count++
+		return invoker(ctx, method, req, reply, cc, opts...)
+	}
+}
+
+func TestResolvers(t *testing.T) {
+	startServer()
+	defer server.Cleanup()
+	var mu sync.Mutex
+	dialed := make(map[string]bool)
+	dialer := gtest.GetBufDialer(server.GetListener())
+	builder := GrpcConnBuilder{}
+	builder.WithInsecure()
+	builder.WithLoadBalancingPolicy(RoundRobin)
+	builder.WithResolvers(resolvers.NewStaticBuilder())
+	builder.WithContextDialer(func(ctx context.Context, addr string) (net.Conn, error) {
+		mu.Lock()
+		dialed[addr] = true
+		mu.Unlock()
+		return dialer(ctx, addr)
+	})
+	cc, err := builder.GetConn("static:///host1:50051,host2:50051")
+	assert.NoError(t, err)
+	defer cc.Close()
+	for i := 0; i < 4; i++ {
+		_, err := sayHello(cc)
+		assert.NoError(t, err)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, map[string]bool{"host1:50051": true, "host2:50051": true}, dialed)
+}
@@ -0,0 +1,41 @@
+package grpc_client
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// directDialer dials the address the way the default gRPC dialer does without proxy: over the unix socket of the
+// unix:path and unix://path addresses, over TCP otherwise
+func directDialer(ctx context.Context, addr string) (net.Conn, error) {
+	network, address := parseDialTarget(addr)
+	return (&net.Dialer{}).DialContext(ctx, network, address)
+}
+
+// proxied checks whether the default gRPC dialer goes through the HTTP CONNECT proxy of the environment
+// (HTTPS_PROXY and NO_PROXY) to reach the address
+func proxied(addr string) bool {
+	if network, _ := parseDialTarget(addr); network != "tcp" {
+		return false
+	}
+	proxyURL, err := http.ProxyFromEnvironment(&http.Request{URL: &url.URL{Scheme: "https", Host: addr}})
+	return err != nil || proxyURL != nil
+}
+
+// parseDialTarget returns the network and address of the unix:path and unix://path addresses, tcp otherwise
+func parseDialTarget(addr string) (string, string) {
+	if !strings.HasPrefix(addr, "unix:") {
+		return "tcp", addr
+	}
+	path := strings.TrimPrefix(addr, "unix:")
+	if u, err := url.Parse(addr); err == nil && strings.HasPrefix(path, "//") {
+		path = u.Path
+		if path == "" {
+			path = u.Host
+		}
+	}
+	return "unix", path
+}
@@ -0,0 +1,19 @@
+package grpc_client
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestParseDialTarget(t *testing.T) {
+	for addr, want := range map[string][2]string{
+		"localhost:50051":         {"tcp", "localhost:50051"},
+		"unix:/tmp/grpc.sock":     {"unix", "/tmp/grpc.sock"},
+		"unix:///tmp/grpc.sock":   {"unix", "/tmp/grpc.sock"},
+		"unix://grpc.sock":        {"unix", "grpc.sock"},
+		"unix:relative/grpc.sock": {"unix", "relative/grpc.sock"},
+	} {
+		network, address := parseDialTarget(addr)
+		assert.Equal(t, want, [2]string{network, address}, addr)
+	}
+}
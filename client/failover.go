@@ -0,0 +1,394 @@
+package grpc_client
+
+import (
+	"context"
+	"fmt"
+	"github.com/apssouza22/grpc-production-go/logging"
+	"github.com/apssouza22/grpc-production-go/metrics"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/connectivity"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+	"sync"
+	"time"
+)
+
+// FailoversMetric counts the failovers and failbacks, labeled by kind
+const FailoversMetric = "grpc_client_failovers_total"
+
+// FailoverKind tells a failover from a failback
+type FailoverKind string
+
+const (
+	// Failover is the switch from the primary to the secondary
+	Failover FailoverKind = "failover"
+	// Failback is the return to the primary
+	Failback FailoverKind = "failback"
+)
+
+// FailoverEvent is emitted when the connection switches between the primary and the secondary
+type FailoverEvent struct {
+	Kind FailoverKind
+	// From and To are the targets of the connections
+	From   string
+	To     string
+	Reason string
+	Time   time.Time
+}
+
+const defaultProbeInterval = 5 * time.Second
+
+// FailoverOption configures the failover connection
+type FailoverOption func(*FailoverConn)
+
+// WithFailoverThreshold sets the number of consecutive failures of the primary triggering the failover, counted
+// separately for the RPCs and the health checks. The default is 5
+func WithFailoverThreshold(failures int) FailoverOption {
+	return func(c *FailoverConn) {
+		c.threshold = failures
+	}
+}
+
+// WithFailoverCodes sets the codes counted as failures of the primary. The default is Unavailable and DeadlineExceeded
+func WithFailoverCodes(failureCodes ...codes.Code) FailoverOption {
+	return func(c *FailoverConn) {
+		c.failureCodes = failureCodes
+	}
+}
+
+// WithFailoverHealthCheck checks the service on the primary with the gRPC health checking protocol: consecutive failed
+// health checks (not serving or erroring) trigger the failover and the probes of the failback check it too.
+// Only the connectivity state is probed otherwise
+func WithFailoverHealthCheck(service string) FailoverOption {
+	return func(c *FailoverConn) {
+		c.healthCheckService = &service
+	}
+}
+
+// WithFailbackCooldown sets how long the secondary is used before probing the primary. The default is 30s
+func WithFailbackCooldown(cooldown time.Duration) FailoverOption {
+	return func(c *FailoverConn) {
+		c.cooldown = cooldown
+	}
+}
+
+// WithFailbackProbes sets the number of consecutive successful probes required to fail back. The default is 3
+func WithFailbackProbes(probes int) FailoverOption {
+	return func(c *FailoverConn) {
+		c.probes = probes
+	}
+}
+
+// WithProbeInterval sets how often the primary is probed (and health checked).
+// The default is 5s, also used when the interval is not positive as the connection never fails back without probes
+func WithProbeInterval(interval time.Duration) FailoverOption {
+	return func(c *FailoverConn) {
+		c.probeInterval = interval
+	}
+}
+
+// WithFailoverListener calls the listener on each failover and failback. It is called synchronously and must not block
+func WithFailoverListener(listener func(FailoverEvent)) FailoverOption {
+	return func(c *FailoverConn) {
+		c.listeners = append(c.listeners, listener)
+	}
+}
+
+// WithFailoverLogger sets the logger receiving the failovers and failbacks. The default logger is used otherwise
+func WithFailoverLogger(logger logging.Logger) FailoverOption {
+	return func(c *FailoverConn) {
+		c.logger = logger
+	}
+}
+
+// WithFailoverMetrics sets the provider of the failover metrics. The default provider is used otherwise
+func WithFailoverMetrics(provider metrics.Provider) FailoverOption {
+	return func(c *FailoverConn) {
+		c.metrics = provider
+	}
+}
+
+// FailoverConn sends the RPCs to the primary and fails over to the secondary after consecutive failures or failed
+// health checks of the primary. Once the cooldown elapsed, the primary is probed and the connection fails back after
+// enough successful probes. The failed RPCs are not retried on the secondary.
+// It implements grpc.ClientConnInterface, so generated clients accept it in place of a *grpc.ClientConn
+type FailoverConn struct {
+	primary            *grpc.ClientConn
+	secondary          *grpc.ClientConn
+	primaryTarget      string
+	secondaryTarget    string
+	threshold          int
+	failureCodes       []codes.Code
+	healthCheckService *string
+	cooldown           time.Duration
+	probes             int
+	probeInterval      time.Duration
+	listeners          []func(FailoverEvent)
+	logger             logging.Logger
+	metrics            metrics.Provider
+	failovers          metrics.Counter
+	// owned is set when the connections were dialed by GetFailoverConn and are closed with it
+	owned bool
+
+	mu          sync.Mutex
+	onSecondary bool
+	failures    int
+	// healthFailures counts the consecutive failed health checks of the primary while active
+	healthFailures int
+	failedOver     time.Time
+	successes      int
+	done           chan struct{}
+	closeOnce      sync.Once
+	wg             sync.WaitGroup
+}
+
+var _ grpc.ClientConnInterface = (*FailoverConn)(nil)
+
+// NewFailoverConn creates a failover connection over the primary and secondary connections.
+// Closing it does not close them
+func NewFailoverConn(primary *grpc.ClientConn, secondary *grpc.ClientConn, opts ...FailoverOption) *FailoverConn {
+	c := &FailoverConn{
+		primary:         primary,
+		secondary:       secondary,
+		primaryTarget:   primary.Target(),
+		secondaryTarget: secondary.Target(),
+		threshold:       5,
+		failureCodes:    []codes.Code{codes.Unavailable, codes.DeadlineExceeded},
+		cooldown:        30 * time.Second,
+		probes:          3,
+		probeInterval:   defaultProbeInterval,
+		done:            make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	c.logger = logging.OrDefault(c.logger)
+	c.metrics = metrics.OrDefault(c.metrics)
+	c.failovers = c.metrics.Counter(FailoversMetric)
+	if c.probeInterval <= 0 {
+		c.probeInterval = defaultProbeInterval
+	}
+	c.wg.Add(1)
+	go c.watch()
+	return c
+}
+
+// GetFailoverConn dials the primary and secondary targets and returns the failover connection over them.
+// Closing it closes the connections
+func (b *GrpcConnBuilder) GetFailoverConn(primary string, secondary string, opts ...FailoverOption) (*FailoverConn, error) {
+	primaryConn, err := b.dial(b.getContext(), primary)
+	if err != nil {
+		return nil, fmt.Errorf("unable to connect to the primary. address = %s: %w", primary, err)
+	}
+	secondaryConn, err := b.dial(b.getContext(), secondary)
+	if err != nil {
+		primaryConn.Close()
+		return nil, fmt.Errorf("unable to connect to the secondary. address = %s: %w", secondary, err)
+	}
+	c := NewFailoverConn(primaryConn, secondaryConn, opts...)
+	c.owned = true
+	return c, nil
+}
+
+// Invoke sends the unary RPC to the active connection
+func (c *FailoverConn) Invoke(ctx context.Context, method string, args interface{}, reply interface{}, opts ...grpc.CallOption) error {
+	conn, primary := c.active()
+	err := conn.Invoke(ctx, method, args, reply, opts...)
+	if primary {
+		c.record(err)
+	}
+	return err
+}
+
+// NewStream opens the stream on the active connection. The failure to open the stream and the final status of the
+// streams on the primary, reported by RecvMsg, count toward the failover
+func (c *FailoverConn) NewStream(ctx context.Context, desc *grpc.StreamDesc, method string, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+	conn, primary := c.active()
+	stream, err := conn.NewStream(ctx, desc, method, opts...)
+	if !primary {
+		return stream, err
+	}
+	if err != nil {
+		c.record(err)
+		return nil, err
+	}
+	return &routedClientStream{ClientStream: stream, serverStreams: desc.ServerStreams, finish: c.record}, nil
+}
+
+// OnPrimary tells whether the RPCs are sent to the primary
+func (c *FailoverConn) OnPrimary() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return !c.onSecondary
+}
+
+// Close stops probing the primary, and closes the connections when they were dialed by GetFailoverConn
+func (c *FailoverConn) Close() error {
+	c.closeOnce.Do(func() {
+		close(c.done)
+	})
+	c.wg.Wait()
+	if !c.owned {
+		return nil
+	}
+	err := c.primary.Close()
+	if secondaryErr := c.secondary.Close(); err == nil {
+		err = secondaryErr
+	}
+	return err
+}
+
+func (c *FailoverConn) active() (*grpc.ClientConn, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.onSecondary {
+		return c.secondary, false
+	}
+	return c.primary, true
+}
+
+// record counts the consecutive failures of the primary, failing over once the threshold is reached
+func (c *FailoverConn) record(err error) {
+	if !c.isFailure(err) {
+		c.mu.Lock()
+		c.failures = 0
+		c.mu.Unlock()
+		return
+	}
+	c.mu.Lock()
+	c.failures++
+	reached := c.failures >= c.threshold
+	c.mu.Unlock()
+	if reached {
+		c.failover(fmt.Sprintf("%d consecutive failures, last error: %v", c.threshold, err))
+	}
+}
+
+// recordHealth counts the consecutive failed health checks of the primary, failing over once the threshold is reached
+func (c *FailoverConn) recordHealth(err error) {
+	c.mu.Lock()
+	if err == nil {
+		c.healthFailures = 0
+		c.mu.Unlock()
+		return
+	}
+	c.healthFailures++
+	reached := c.healthFailures >= c.threshold
+	c.mu.Unlock()
+	if reached {
+		c.failover(fmt.Sprintf("%d consecutive failed health checks, last error: %v", c.threshold, err))
+	}
+}
+
+func (c *FailoverConn) isFailure(err error) bool {
+	if err == nil {
+		return false
+	}
+	code := status.Code(err)
+	for _, failureCode := range c.failureCodes {
+		if code == failureCode {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *FailoverConn) failover(reason string) {
+	c.mu.Lock()
+	if c.onSecondary {
+		c.mu.Unlock()
+		return
+	}
+	c.onSecondary = true
+	c.failedOver = time.Now()
+	c.failures = 0
+	c.healthFailures = 0
+	c.successes = 0
+	c.mu.Unlock()
+	c.emit(FailoverEvent{Kind: Failover, From: c.primaryTarget, To: c.secondaryTarget, Reason: reason, Time: time.Now()})
+}
+
+func (c *FailoverConn) failback(reason string) {
+	c.mu.Lock()
+	if !c.onSecondary {
+		c.mu.Unlock()
+		return
+	}
+	c.onSecondary = false
+	c.failures = 0
+	c.healthFailures = 0
+	c.successes = 0
+	c.mu.Unlock()
+	c.emit(FailoverEvent{Kind: Failback, From: c.secondaryTarget, To: c.primaryTarget, Reason: reason, Time: time.Now()})
+}
+
+func (c *FailoverConn) emit(event FailoverEvent) {
+	c.failovers.Add(1, "kind", string(event.Kind))
+	c.logger.Warn("connection "+string(event.Kind), "from", event.From, "to", event.To, "reason", event.Reason)
+	for _, listener := range c.listeners {
+		listener(event)
+	}
+}
+
+// watch health checks the primary while active and probes it once the cooldown elapsed after a failover
+func (c *FailoverConn) watch() {
+	defer c.wg.Done()
+	ticker := time.NewTicker(c.probeInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.done:
+			return
+		case <-ticker.C:
+		}
+		c.mu.Lock()
+		onSecondary, failedOver := c.onSecondary, c.failedOver
+		c.mu.Unlock()
+
+		if !onSecondary {
+			if c.healthCheckService == nil {
+				continue
+			}
+			c.recordHealth(c.probe())
+			continue
+		}
+		if time.Since(failedOver) < c.cooldown {
+			continue
+		}
+		if err := c.probe(); err != nil {
+			c.mu.Lock()
+			c.successes = 0
+			c.mu.Unlock()
+			continue
+		}
+		c.mu.Lock()
+		c.successes++
+		reached := c.successes >= c.probes
+		c.mu.Unlock()
+		if reached {
+			c.failback(fmt.Sprintf("%d successful probes", c.probes))
+		}
+	}
+}
+
+// probe checks the primary within the probe interval: its health when a service is configured, otherwise that it
+// connects and becomes ready
+func (c *FailoverConn) probe() error {
+	ctx, cancel := context.WithTimeout(context.Background(), c.probeInterval)
+	defer cancel()
+	if c.healthCheckService != nil {
+		resp, err := healthpb.NewHealthClient(c.primary).Check(ctx, &healthpb.HealthCheckRequest{Service: *c.healthCheckService})
+		if err != nil {
+			return err
+		}
+		if resp.GetStatus() != healthpb.HealthCheckResponse_SERVING {
+			return fmt.Errorf("service %q is %s", *c.healthCheckService, resp.GetStatus())
+		}
+		return nil
+	}
+	if state := waitForReady(ctx, c.primary); state != connectivity.Ready {
+		return fmt.Errorf("connection is %s", state)
+	}
+	return nil
+}
@@ -0,0 +1,247 @@
+package grpc_client
+
+import (
+	"context"
+	"github.com/apssouza22/grpc-production-go/logging"
+	"github.com/apssouza22/grpc-production-go/metrics"
+	gtest "github.com/apssouza22/grpc-production-go/testing"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/examples/helloworld/helloworld"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// regionGreeter answers with its name, or Unavailable while down
+type regionGreeter struct {
+	name string
+	down int32
+}
+
+func (g *regionGreeter) SayHello(ctx context.Context, in *helloworld.HelloRequest) (*helloworld.HelloReply, error) {
+	if atomic.LoadInt32(&g.down) == 1 {
+		return nil, status.Error(codes.Unavailable, g.name+" is down")
+	}
+	return &helloworld.HelloReply{Message: g.name}, nil
+}
+
+func startRegion(greeter *regionGreeter, healthServer healthpb.HealthServer) gtest.GrpcInProcessingServer {
+	builder := gtest.GrpcInProcessingServerBuilder{}
+	builder.SetLogger(logging.Nop())
+	svr := builder.Build()
+	svr.RegisterService(func(server *grpc.Server) {
+		helloworld.RegisterGreeterServer(server, greeter)
+		healthpb.RegisterHealthServer(server, healthServer)
+	})
+	svr.Start()
+	return svr
+}
+
+func dialRegion(t *testing.T, svr gtest.GrpcInProcessingServer, target string) *grpc.ClientConn {
+	builder := GrpcConnBuilder{}
+	builder.WithInsecure()
+	builder.WithContextDialer(gtest.GetBufDialer(svr.GetListener()))
+	cc, err := builder.GetConn(target)
+	assert.NoError(t, err)
+	return cc
+}
+
+type failoverEvents struct {
+	mu     sync.Mutex
+	events []FailoverEvent
+}
+
+func (e *failoverEvents) add(event FailoverEvent) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.events = append(e.events, event)
+}
+
+func (e *failoverEvents) kinds() []FailoverKind {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	var kinds []FailoverKind
+	for _, event := range e.events {
+		kinds = append(kinds, event.Kind)
+	}
+	return kinds
+}
+
+func TestFailoverOnErrors(t *testing.T) {
+	primary, secondary := &regionGreeter{name: "primary"}, &regionGreeter{name: "secondary"}
+	primaryServer, secondaryServer := startRegion(primary, health.NewServer()), startRegion(secondary, health.NewServer())
+	defer primaryServer.Cleanup()
+	defer secondaryServer.Cleanup()
+	primaryConn, secondaryConn := dialRegion(t, primaryServer, "primary:50051"), dialRegion(t, secondaryServer, "secondary:50051")
+	defer primaryConn.Close()
+	defer secondaryConn.Close()
+
+	events := &failoverEvents{}
+	provider := metrics.NewMemory()
+	cc := NewFailoverConn(primaryConn, secondaryConn,
+		WithFailoverThreshold(3),
+		WithFailbackCooldown(50*time.Millisecond),
+		WithFailbackProbes(2),
+		WithProbeInterval(10*time.Millisecond),
+		WithFailoverListener(events.add),
+		WithFailoverLogger(logging.Nop()),
+		WithFailoverMetrics(provider),
+	)
+	defer cc.Close()
+
+	resp, err := sayHello(cc)
+	assert.NoError(t, err)
+	assert.Equal(t, "primary", resp.Message)
+
+	atomic.StoreInt32(&primary.down, 1)
+	for i := 0; i < 3; i++ {
+		_, err := sayHello(cc)
+		assert.Equal(t, codes.Unavailable, status.Code(err))
+	}
+	assert.False(t, cc.OnPrimary())
+	resp, err = sayHello(cc)
+	assert.NoError(t, err)
+	assert.Equal(t, "secondary", resp.Message)
+
+	atomic.StoreInt32(&primary.down, 0)
+	assert.Eventually(t, cc.OnPrimary, time.Second, 5*time.Millisecond)
+	resp, err = sayHello(cc)
+	assert.NoError(t, err)
+	assert.Equal(t, "primary", resp.Message)
+
+	assert.Equal(t, []FailoverKind{Failover, Failback}, events.kinds())
+	assert.Equal(t, "primary:50051", events.events[0].From)
+	assert.Equal(t, "secondary:50051", events.events[0].To)
+	assert.Contains(t, events.events[0].Reason, "primary is down")
+	assert.Equal(t, float64(1), provider.Value(FailoversMetric, "kind", "failover"))
+	assert.Equal(t, float64(1), provider.Value(FailoversMetric, "kind", "failback"))
+}
+
+func TestFailoverOnStreamErrors(t *testing.T) {
+	primary, secondary := &regionGreeter{name: "primary"}, &regionGreeter{name: "secondary"}
+	primaryServer, secondaryServer := startRegion(primary, health.NewServer()), startRegion(secondary, health.NewServer())
+	defer primaryServer.Cleanup()
+	defer secondaryServer.Cleanup()
+	primaryConn, secondaryConn := dialRegion(t, primaryServer, "primary:50051"), dialRegion(t, secondaryServer, "secondary:50051")
+	defer primaryConn.Close()
+	defer secondaryConn.Close()
+	cc := NewFailoverConn(primaryConn, secondaryConn, WithFailoverThreshold(2), WithFailoverLogger(logging.Nop()))
+	defer cc.Close()
+
+	atomic.StoreInt32(&primary.down, 1)
+	for i := 0; i < 2; i++ {
+		stream, err := cc.NewStream(context.Background(), &grpc.StreamDesc{}, "/helloworld.Greeter/SayHello")
+		assert.NoError(t, err)
+		assert.NoError(t, stream.SendMsg(&helloworld.HelloRequest{}))
+		assert.NoError(t, stream.CloseSend())
+		assert.Equal(t, codes.Unavailable, status.Code(stream.RecvMsg(&helloworld.HelloReply{})))
+	}
+	assert.False(t, cc.OnPrimary())
+}
+
+func TestFailoverDefaultProbeInterval(t *testing.T) {
+	primaryConn, err := grpc.Dial("primary:50051", grpc.WithInsecure())
+	assert.NoError(t, err)
+	defer primaryConn.Close()
+	secondaryConn, err := grpc.Dial("secondary:50051", grpc.WithInsecure())
+	assert.NoError(t, err)
+	defer secondaryConn.Close()
+
+	cc := NewFailoverConn(primaryConn, secondaryConn, WithProbeInterval(0), WithFailoverLogger(logging.Nop()))
+	defer cc.Close()
+	assert.Equal(t, defaultProbeInterval, cc.probeInterval)
+}
+
+func TestFailoverOnHealthCheck(t *testing.T) {
+	primaryHealth := health.NewServer()
+	primaryServer := startRegion(&regionGreeter{name: "primary"}, primaryHealth)
+	secondaryServer := startRegion(&regionGreeter{name: "secondary"}, health.NewServer())
+	defer primaryServer.Cleanup()
+	defer secondaryServer.Cleanup()
+	primaryConn, secondaryConn := dialRegion(t, primaryServer, "primary:50051"), dialRegion(t, secondaryServer, "secondary:50051")
+	defer primaryConn.Close()
+	defer secondaryConn.Close()
+
+	events := &failoverEvents{}
+	cc := NewFailoverConn(primaryConn, secondaryConn,
+		WithFailoverHealthCheck(""),
+		WithFailbackCooldown(0),
+		WithFailbackProbes(2),
+		WithProbeInterval(10*time.Millisecond),
+		WithFailoverListener(events.add),
+		WithFailoverLogger(logging.Nop()),
+	)
+	defer cc.Close()
+
+	primaryHealth.SetServingStatus("", healthpb.HealthCheckResponse_NOT_SERVING)
+	assert.Eventually(t, func() bool { return !cc.OnPrimary() }, time.Second, 5*time.Millisecond)
+	resp, err := sayHello(cc)
+	assert.NoError(t, err)
+	assert.Equal(t, "secondary", resp.Message)
+
+	primaryHealth.SetServingStatus("", healthpb.HealthCheckResponse_SERVING)
+	assert.Eventually(t, cc.OnPrimary, time.Second, 5*time.Millisecond)
+	assert.Equal(t, []FailoverKind{Failover, Failback}, events.kinds())
+	assert.Contains(t, events.events[0].Reason, "NOT_SERVING")
+}
+
+// flakyHealth fails the health checks until the number of failures is reached, it serves afterwards
+type flakyHealth struct {
+	*health.Server
+	checks   int32
+	failures int32
+}
+
+func (h *flakyHealth) Check(ctx context.Context, in *healthpb.HealthCheckRequest) (*healthpb.HealthCheckResponse, error) {
+	if atomic.AddInt32(&h.checks, 1) <= atomic.LoadInt32(&h.failures) {
+		return nil, status.Error(codes.DeadlineExceeded, "health check timed out")
+	}
+	return h.Server.Check(ctx, in)
+}
+
+func TestFailoverHealthCheckThreshold(t *testing.T) {
+	primaryHealth := &flakyHealth{Server: health.NewServer(), failures: 2}
+	primaryServer := startRegion(&regionGreeter{name: "primary"}, primaryHealth)
+	defer primaryServer.Cleanup()
+	secondaryServer := startRegion(&regionGreeter{name: "secondary"}, health.NewServer())
+	defer secondaryServer.Cleanup()
+	primaryConn, secondaryConn := dialRegion(t, primaryServer, "primary:50051"), dialRegion(t, secondaryServer, "secondary:50051")
+	defer primaryConn.Close()
+	defer secondaryConn.Close()
+
+	events := &failoverEvents{}
+	cc := NewFailoverConn(primaryConn, secondaryConn,
+		WithFailoverThreshold(3),
+		WithFailoverHealthCheck(""),
+		WithProbeInterval(10*time.Millisecond),
+		WithFailoverListener(events.add),
+		WithFailoverLogger(logging.Nop()),
+	)
+	defer cc.Close()
+
+	assert.Eventually(t, func() bool { return atomic.LoadInt32(&primaryHealth.checks) >= 5 }, time.Second, 5*time.Millisecond)
+	assert.True(t, cc.OnPrimary())
+	assert.Empty(t, events.kinds())
+}
+
+func TestGetFailoverConn(t *testing.T) {
+	startServer()
+	defer server.Cleanup()
+	builder := GrpcConnBuilder{}
+	builder.WithInsecure()
+	builder.WithContextDialer(gtest.GetBufDialer(server.GetListener()))
+	cc, err := builder.GetFailoverConn("primary:50051", "secondary:50051", WithFailoverLogger(logging.Nop()))
+	assert.NoError(t, err)
+	resp, err := sayHello(cc)
+	assert.NoError(t, err)
+	assert.Equal(t, "This is a mocked service test", resp.Message)
+	assert.NoError(t, cc.Close())
+	_, err = sayHello(cc)
+	assert.Equal(t, codes.Canceled, status.Code(err))
+}
@@ -0,0 +1,268 @@
+package grpc_client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/apssouza22/grpc-production-go/logging"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/connectivity"
+	"sort"
+	"sync"
+	"time"
+)
+
+// DefaultIdleTimeout is how long the connections without handles are kept open when no timeout is configured
+const DefaultIdleTimeout = 5 * time.Minute
+
+// ErrConnManagerClosed is returned by the manager once shut down
+var ErrConnManagerClosed = errors.New("connection manager is shut down")
+
+// ConnManagerOption configures the connection manager
+type ConnManagerOption func(*ConnManager)
+
+// WithIdleTimeout sets how long a connection without handles is kept open. Zero closes it on the last release
+func WithIdleTimeout(timeout time.Duration) ConnManagerOption {
+	return func(m *ConnManager) {
+		m.idleTimeout = timeout
+	}
+}
+
+// WithConnManagerLogger sets the logger receiving the opened and closed connections. The default logger is used otherwise
+func WithConnManagerLogger(logger logging.Logger) ConnManagerOption {
+	return func(m *ConnManager) {
+		m.logger = logger
+	}
+}
+
+// ConnManager shares the client connections per target and options profile, handing out reference counted handles.
+// Connections without handles are closed after the idle timeout
+type ConnManager struct {
+	idleTimeout time.Duration
+	logger      logging.Logger
+	mu          sync.Mutex
+	profiles    map[string]*GrpcConnBuilder
+	conns       map[connKey]*managedConn
+	closed      bool
+}
+
+type connKey struct {
+	target  string
+	profile string
+}
+
+// managedConn is a shared connection with its number of handles
+type managedConn struct {
+	conn      *grpc.ClientConn
+	refs      int
+	idleTimer *time.Timer
+	// ready is closed once the dial finished, err is set when it failed
+	ready chan struct{}
+	err   error
+}
+
+// ConnStatus describes a managed connection
+type ConnStatus struct {
+	Target  string
+	Profile string
+	State   connectivity.State
+	// Handles is the number of handles not released yet
+	Handles int
+}
+
+// NewConnManager creates a connection manager. Register the options profiles before getting connections
+func NewConnManager(opts ...ConnManagerOption) *ConnManager {
+	m := &ConnManager{
+		idleTimeout: DefaultIdleTimeout,
+		profiles:    make(map[string]*GrpcConnBuilder),
+		conns:       make(map[connKey]*managedConn),
+	}
+	for _, opt := range opts {
+		opt(m)
+	}
+	m.logger = logging.OrDefault(m.logger)
+	return m
+}
+
+// RegisterProfile registers the builder dialing the connections of the profile (credentials, interceptors, keepalive...).
+// The builder must not be modified afterwards
+func (m *ConnManager) RegisterProfile(name string, builder *GrpcConnBuilder) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.profiles[name] = builder
+}
+
+// Get returns a handle to the connection to the target dialed with the profile, dialing it on first use.
+// Concurrent first uses wait for the same dial. Release the handle once done with it
+func (m *ConnManager) Get(ctx context.Context, target string, profile string) (*ConnHandle, error) {
+	if target == "" {
+		return nil, fmt.Errorf("target connection parameter missing. address = %s", target)
+	}
+	key := connKey{target: target, profile: profile}
+	m.mu.Lock()
+	if m.closed {
+		m.mu.Unlock()
+		return nil, ErrConnManagerClosed
+	}
+	mc, ok := m.conns[key]
+	if ok {
+		if mc.idleTimer != nil {
+			mc.idleTimer.Stop()
+			mc.idleTimer = nil
+		}
+		mc.refs++
+		m.mu.Unlock()
+		return m.await(ctx, key, mc)
+	}
+	builder, ok := m.profiles[profile]
+	if !ok {
+		m.mu.Unlock()
+		return nil, fmt.Errorf("unknown connection profile %q", profile)
+	}
+	mc = &managedConn{refs: 1, ready: make(chan struct{})}
+	m.conns[key] = mc
+	m.mu.Unlock()
+
+	conn, err := builder.dial(ctx, target)
+	m.mu.Lock()
+	switch {
+	case err != nil:
+		mc.err = fmt.Errorf("unable to connect to client. address = %s: %w", target, err)
+		delete(m.conns, key)
+	case m.closed:
+		mc.err = ErrConnManagerClosed
+		conn.Close()
+	default:
+		mc.conn = conn
+		m.logger.Debug("opened managed connection", "target", target, "profile", profile)
+	}
+	close(mc.ready)
+	m.mu.Unlock()
+	return m.await(ctx, key, mc)
+}
+
+// await waits for the connection dialed by another caller
+func (m *ConnManager) await(ctx context.Context, key connKey, mc *managedConn) (*ConnHandle, error) {
+	select {
+	case <-mc.ready:
+	case <-ctx.Done():
+		m.release(key, mc)
+		return nil, ctx.Err()
+	}
+	if mc.err != nil {
+		m.release(key, mc)
+		return nil, mc.err
+	}
+	return &ConnHandle{manager: m, key: key, conn: mc}, nil
+}
+
+// States returns the status of every managed connection, sorted by target and profile
+func (m *ConnManager) States() []ConnStatus {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	states := make([]ConnStatus, 0, len(m.conns))
+	for key, mc := range m.conns {
+		if mc.conn == nil {
+			continue
+		}
+		states = append(states, ConnStatus{
+			Target:  key.target,
+			Profile: key.profile,
+			State:   mc.conn.GetState(),
+			Handles: mc.refs,
+		})
+	}
+	sort.Slice(states, func(i, j int) bool {
+		if states[i].Target != states[j].Target {
+			return states[i].Target < states[j].Target
+		}
+		return states[i].Profile < states[j].Profile
+	})
+	return states
+}
+
+// Shutdown closes every connection, including the ones with handles not released yet
+func (m *ConnManager) Shutdown() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.closed = true
+	var firstErr error
+	for key, mc := range m.conns {
+		delete(m.conns, key)
+		if mc.idleTimer != nil {
+			mc.idleTimer.Stop()
+		}
+		if mc.conn == nil {
+			// Still dialing, the dialer closes it
+			continue
+		}
+		if err := mc.conn.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+func (m *ConnManager) release(key connKey, mc *managedConn) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	mc.refs--
+	if mc.refs > 0 || m.conns[key] != mc {
+		return
+	}
+	if m.idleTimeout <= 0 {
+		m.closeIdle(key, mc)
+		return
+	}
+	mc.idleTimer = time.AfterFunc(m.idleTimeout, func() {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		if mc.refs == 0 && m.conns[key] == mc {
+			m.closeIdle(key, mc)
+		}
+	})
+}
+
+// closeIdle closes the connection without handles, with the lock held
+func (m *ConnManager) closeIdle(key connKey, mc *managedConn) {
+	delete(m.conns, key)
+	if err := mc.conn.Close(); err != nil {
+		m.logger.Warn("failed to close idle connection", "target", key.target, "profile", key.profile, "err", err)
+		return
+	}
+	m.logger.Debug("closed idle managed connection", "target", key.target, "profile", key.profile)
+}
+
+// ConnHandle is a reference to a shared connection. It implements grpc.ClientConnInterface
+type ConnHandle struct {
+	manager *ConnManager
+	key     connKey
+	conn    *managedConn
+	once    sync.Once
+}
+
+var _ grpc.ClientConnInterface = (*ConnHandle)(nil)
+
+// Conn returns the shared connection, for the generated clients requiring a *grpc.ClientConn.
+// Never close it, release the handle instead
+func (h *ConnHandle) Conn() *grpc.ClientConn {
+	return h.conn.conn
+}
+
+// Invoke sends the unary RPC through the shared connection
+func (h *ConnHandle) Invoke(ctx context.Context, method string, args interface{}, reply interface{}, opts ...grpc.CallOption) error {
+	return h.conn.conn.Invoke(ctx, method, args, reply, opts...)
+}
+
+// NewStream opens the stream on the shared connection
+func (h *ConnHandle) NewStream(ctx context.Context, desc *grpc.StreamDesc, method string, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+	return h.conn.conn.NewStream(ctx, desc, method, opts...)
+}
+
+// Release gives the handle back. The connection is closed once idle for the idle timeout.
+// Releasing a handle twice is a no-op
+func (h *ConnHandle) Release() {
+	h.once.Do(func() {
+		h.manager.release(h.key, h.conn)
+	})
+}
@@ -0,0 +1,87 @@
+package grpc_client
+
+import (
+	"context"
+	"github.com/apssouza22/grpc-production-go/logging"
+	gtest "github.com/apssouza22/grpc-production-go/testing"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/connectivity"
+	"testing"
+	"time"
+)
+
+func newTestConnManager(opts ...ConnManagerOption) *ConnManager {
+	builder := &GrpcConnBuilder{}
+	builder.WithInsecure()
+	builder.WithOptions(grpc.WithContextDialer(gtest.GetBufDialer(server.GetListener())))
+	manager := NewConnManager(append([]ConnManagerOption{WithConnManagerLogger(logging.Nop())}, opts...)...)
+	manager.RegisterProfile("default", builder)
+	return manager
+}
+
+func TestConnManagerSharesConnections(t *testing.T) {
+	startServer()
+	defer server.Cleanup()
+	manager := newTestConnManager()
+	defer manager.Shutdown()
+
+	first, err := manager.Get(context.Background(), "localhost:50051", "default")
+	assert.NoError(t, err)
+	second, err := manager.Get(context.Background(), "localhost:50051", "default")
+	assert.NoError(t, err)
+	assert.True(t, first.Conn() == second.Conn())
+	other, err := manager.Get(context.Background(), "other:50051", "default")
+	assert.NoError(t, err)
+	assert.True(t, first.Conn() != other.Conn())
+
+	resp, err := sayHello(first)
+	assert.NoError(t, err)
+	assert.Equal(t, "This is a mocked service test", resp.Message)
+
+	states := manager.States()
+	assert.Len(t, states, 2)
+	assert.Equal(t, "localhost:50051", states[0].Target)
+	assert.Equal(t, 2, states[0].Handles)
+	assert.Equal(t, connectivity.Ready, states[0].State)
+
+	_, err = manager.Get(context.Background(), "localhost:50051", "unknown")
+	assert.Error(t, err)
+}
+
+func TestConnManagerClosesIdleConnections(t *testing.T) {
+	startServer()
+	defer server.Cleanup()
+	manager := newTestConnManager(WithIdleTimeout(20 * time.Millisecond))
+	defer manager.Shutdown()
+
+	first, _ := manager.Get(context.Background(), "localhost:50051", "default")
+	second, _ := manager.Get(context.Background(), "localhost:50051", "default")
+	conn := first.Conn()
+	first.Release()
+	first.Release()
+	assert.Equal(t, 1, manager.States()[0].Handles)
+
+	second.Release()
+	reused, _ := manager.Get(context.Background(), "localhost:50051", "default")
+	assert.True(t, conn == reused.Conn())
+	reused.Release()
+
+	assert.Eventually(t, func() bool {
+		return len(manager.States()) == 0
+	}, time.Second, 5*time.Millisecond)
+	assert.Equal(t, connectivity.Shutdown, conn.GetState())
+}
+
+func TestConnManagerShutdown(t *testing.T) {
+	startServer()
+	defer server.Cleanup()
+	manager := newTestConnManager(WithIdleTimeout(0))
+	handle, _ := manager.Get(context.Background(), "localhost:50051", "default")
+	assert.NoError(t, manager.Shutdown())
+	assert.Equal(t, connectivity.Shutdown, handle.Conn().GetState())
+	handle.Release()
+
+	_, err := manager.Get(context.Background(), "localhost:50051", "default")
+	assert.Equal(t, ErrConnManagerClosed, err)
+}
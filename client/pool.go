@@ -0,0 +1,280 @@
+package grpc_client
+
+import (
+	"context"
+	"fmt"
+	"github.com/apssouza22/grpc-production-go/logging"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/connectivity"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// poolDialTimeout bounds the dials and health checks of the replaced connections
+const poolDialTimeout = 10 * time.Second
+
+// poolDrainPollInterval is how often a replaced connection is checked for RPCs still in flight
+const poolDrainPollInterval = 10 * time.Millisecond
+
+// PoolOption configures the connection pool
+type PoolOption func(*ConnPool)
+
+// WithPoolHealthCheckInterval sets how often the sub-connections are checked. The default is 10s, zero disables the checks
+func WithPoolHealthCheckInterval(interval time.Duration) PoolOption {
+	return func(p *ConnPool) {
+		p.healthCheckInterval = interval
+	}
+}
+
+// WithPoolHealthCheckService also checks the sub-connections with the gRPC health checking protocol for the service.
+// Only the connectivity state is checked otherwise
+func WithPoolHealthCheckService(service string) PoolOption {
+	return func(p *ConnPool) {
+		p.healthCheckService = &service
+	}
+}
+
+// WithPoolDrainTimeout sets how long a replaced connection is kept open for its RPCs and streams in flight
+// before being closed. The default is 30s
+func WithPoolDrainTimeout(timeout time.Duration) PoolOption {
+	return func(p *ConnPool) {
+		p.drainTimeout = timeout
+	}
+}
+
+// WithPoolLogger sets the logger receiving the replacements of the sub-connections. The default logger is used otherwise
+func WithPoolLogger(logger logging.Logger) PoolOption {
+	return func(p *ConnPool) {
+		p.logger = logger
+	}
+}
+
+// ConnPool keeps N connections to the same target and sends each RPC through the least loaded one.
+// It implements grpc.ClientConnInterface, so generated clients accept it in place of a *grpc.ClientConn
+type ConnPool struct {
+	dial                func(ctx context.Context) (*grpc.ClientConn, error)
+	healthCheckInterval time.Duration
+	healthCheckService  *string
+	drainTimeout        time.Duration
+	logger              logging.Logger
+	mu                  sync.RWMutex
+	conns               []*pooledConn
+	closed              bool
+	done                chan struct{}
+	wg                  sync.WaitGroup
+}
+
+// pooledConn is a sub-connection with its number of RPCs in flight
+type pooledConn struct {
+	conn     *grpc.ClientConn
+	inFlight int64
+}
+
+var _ grpc.ClientConnInterface = (*ConnPool)(nil)
+
+// NewConnPool dials size connections with the dial function
+func NewConnPool(ctx context.Context, size int, dial func(ctx context.Context) (*grpc.ClientConn, error), opts ...PoolOption) (*ConnPool, error) {
+	if size <= 0 {
+		return nil, fmt.Errorf("invalid pool size %d", size)
+	}
+	p := &ConnPool{
+		dial:                dial,
+		healthCheckInterval: 10 * time.Second,
+		drainTimeout:        30 * time.Second,
+		done:                make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(p)
+	}
+	p.logger = logging.OrDefault(p.logger)
+	for i := 0; i < size; i++ {
+		conn, err := dial(ctx)
+		if err != nil {
+			p.Close()
+			return nil, fmt.Errorf("unable to dial pooled connection %d: %w", i, err)
+		}
+		p.conns = append(p.conns, &pooledConn{conn: conn})
+	}
+	if p.healthCheckInterval > 0 {
+		p.wg.Add(1)
+		go p.watch()
+	}
+	return p, nil
+}
+
+// Invoke sends the unary RPC through the least loaded connection
+func (p *ConnPool) Invoke(ctx context.Context, method string, args interface{}, reply interface{}, opts ...grpc.CallOption) error {
+	pc, err := p.pick()
+	if err != nil {
+		return err
+	}
+	defer atomic.AddInt64(&pc.inFlight, -1)
+	return pc.conn.Invoke(ctx, method, args, reply, opts...)
+}
+
+// NewStream opens the stream on the least loaded connection. The stream counts as load until it finishes
+func (p *ConnPool) NewStream(ctx context.Context, desc *grpc.StreamDesc, method string, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+	pc, err := p.pick()
+	if err != nil {
+		return nil, err
+	}
+	stream, err := pc.conn.NewStream(ctx, desc, method, opts...)
+	if err != nil {
+		atomic.AddInt64(&pc.inFlight, -1)
+		return nil, err
+	}
+	go func() {
+		// The stream context is canceled once the stream finishes, whatever the reason
+		<-stream.Context().Done()
+		atomic.AddInt64(&pc.inFlight, -1)
+	}()
+	return stream, nil
+}
+
+// Size returns the number of connections
+func (p *ConnPool) Size() int {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return len(p.conns)
+}
+
+// Close stops the health checks and closes every connection
+func (p *ConnPool) Close() error {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return nil
+	}
+	p.closed = true
+	close(p.done)
+	conns := p.conns
+	p.mu.Unlock()
+
+	p.wg.Wait()
+	var firstErr error
+	for _, pc := range conns {
+		if err := pc.conn.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// pick returns the healthy connection with the fewest RPCs in flight, counting the new one
+func (p *ConnPool) pick() (*pooledConn, error) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if p.closed {
+		return nil, grpc.ErrClientConnClosing
+	}
+	var best *pooledConn
+	bestHealthy := false
+	for _, pc := range p.conns {
+		healthy := isUsable(pc.conn.GetState())
+		if best == nil || (healthy && !bestHealthy) ||
+			(healthy == bestHealthy && atomic.LoadInt64(&pc.inFlight) < atomic.LoadInt64(&best.inFlight)) {
+			best, bestHealthy = pc, healthy
+		}
+	}
+	atomic.AddInt64(&best.inFlight, 1)
+	return best, nil
+}
+
+func (p *ConnPool) watch() {
+	defer p.wg.Done()
+	ticker := time.NewTicker(p.healthCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-p.done:
+			return
+		case <-ticker.C:
+			p.checkHealth()
+		}
+	}
+}
+
+// checkHealth replaces the broken connections
+func (p *ConnPool) checkHealth() {
+	p.mu.RLock()
+	conns := append([]*pooledConn{}, p.conns...)
+	p.mu.RUnlock()
+	for i, pc := range conns {
+		if p.healthy(pc.conn) {
+			continue
+		}
+		p.replace(i, pc)
+	}
+}
+
+func (p *ConnPool) healthy(conn *grpc.ClientConn) bool {
+	state := conn.GetState()
+	if !isUsable(state) {
+		return false
+	}
+	if p.healthCheckService == nil || state != connectivity.Ready {
+		return true
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), poolDialTimeout)
+	defer cancel()
+	resp, err := healthpb.NewHealthClient(conn).Check(ctx, &healthpb.HealthCheckRequest{Service: *p.healthCheckService})
+	return err == nil && resp.GetStatus() == healthpb.HealthCheckResponse_SERVING
+}
+
+// replace dials a new connection in place of the broken one, which is closed once drained
+func (p *ConnPool) replace(i int, broken *pooledConn) {
+	ctx, cancel := context.WithTimeout(context.Background(), poolDialTimeout)
+	defer cancel()
+	conn, err := p.dial(ctx)
+	if err != nil {
+		p.logger.Warn("unable to replace broken pooled connection", "target", broken.conn.Target(), "err", err)
+		return
+	}
+	p.mu.Lock()
+	if p.closed || p.conns[i] != broken {
+		p.mu.Unlock()
+		conn.Close()
+		return
+	}
+	p.conns[i] = &pooledConn{conn: conn}
+	p.wg.Add(1)
+	p.mu.Unlock()
+	p.logger.Info("replaced broken pooled connection", "target", conn.Target(), "state", broken.conn.GetState().String())
+	go p.drain(broken)
+}
+
+// drain closes the replaced connection once its RPCs and streams are finished, at the latest after the drain timeout
+// or when the pool is closed
+func (p *ConnPool) drain(pc *pooledConn) {
+	defer p.wg.Done()
+	defer pc.conn.Close()
+	timeout := time.NewTimer(p.drainTimeout)
+	defer timeout.Stop()
+	ticker := time.NewTicker(poolDrainPollInterval)
+	defer ticker.Stop()
+	for atomic.LoadInt64(&pc.inFlight) > 0 {
+		select {
+		case <-timeout.C:
+			return
+		case <-p.done:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func isUsable(state connectivity.State) bool {
+	return state != connectivity.TransientFailure && state != connectivity.Shutdown
+}
+
+// GetPool returns a pool of size connections to the server, built with the options and credentials of the builder
+func (b *GrpcConnBuilder) GetPool(addr string, size int, opts ...PoolOption) (*ConnPool, error) {
+	if addr == "" {
+		return nil, fmt.Errorf("target connection parameter missing. address = %s", addr)
+	}
+	return NewConnPool(b.getContext(), size, func(ctx context.Context) (*grpc.ClientConn, error) {
+		return b.dial(ctx, addr)
+	}, opts...)
+}
@@ -0,0 +1,136 @@
+package grpc_client
+
+import (
+	"context"
+	"github.com/apssouza22/grpc-production-go/logging"
+	gtest "github.com/apssouza22/grpc-production-go/testing"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/connectivity"
+	"google.golang.org/grpc/examples/helloworld/helloworld"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func newTestPool(t *testing.T, size int) *ConnPool {
+	clientBuilder := GrpcConnBuilder{}
+	clientBuilder.WithInsecure()
+	clientBuilder.WithOptions(grpc.WithContextDialer(gtest.GetBufDialer(server.GetListener())))
+	pool, err := clientBuilder.GetPool("localhost:50051", size, WithPoolHealthCheckInterval(0), WithPoolLogger(logging.Nop()))
+	assert.NoError(t, err)
+	return pool
+}
+
+func TestConnPool(t *testing.T) {
+	startServer()
+	defer server.Cleanup()
+	pool := newTestPool(t, 3)
+	defer pool.Close()
+	assert.Equal(t, 3, pool.Size())
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			resp, err := sayHello(pool)
+			assert.NoError(t, err)
+			assert.Equal(t, "This is a mocked service test", resp.Message)
+		}()
+	}
+	wg.Wait()
+	for _, pc := range pool.conns {
+		assert.Equal(t, int64(0), pc.inFlight)
+	}
+}
+
+func TestConnPoolPicksLeastLoaded(t *testing.T) {
+	startServer()
+	defer server.Cleanup()
+	pool := newTestPool(t, 3)
+	defer pool.Close()
+	pool.conns[0].inFlight = 5
+	pool.conns[1].inFlight = 1
+	pool.conns[2].inFlight = 3
+
+	picked, err := pool.pick()
+	assert.NoError(t, err)
+	assert.Equal(t, pool.conns[1], picked)
+	assert.Equal(t, int64(2), picked.inFlight)
+
+	pool.conns[1].conn.Close()
+	picked, _ = pool.pick()
+	assert.Equal(t, pool.conns[2], picked)
+}
+
+func TestConnPoolReplacesBrokenConnections(t *testing.T) {
+	startServer()
+	defer server.Cleanup()
+	pool := newTestPool(t, 2)
+	defer pool.Close()
+	broken := pool.conns[0]
+	broken.conn.Close()
+
+	pool.checkHealth()
+	assert.True(t, broken != pool.conns[0])
+
+	_, err := sayHello(pool)
+	assert.NoError(t, err)
+}
+
+func TestConnPoolDrainsReplacedConnections(t *testing.T) {
+	startServer()
+	defer server.Cleanup()
+	pool := newTestPool(t, 1)
+	defer pool.Close()
+	replaced := pool.conns[0]
+	atomic.AddInt64(&replaced.inFlight, 1)
+
+	pool.replace(0, replaced)
+	assert.True(t, replaced != pool.conns[0])
+	time.Sleep(50 * time.Millisecond)
+	assert.NotEqual(t, connectivity.Shutdown, replaced.conn.GetState())
+
+	atomic.AddInt64(&replaced.inFlight, -1)
+	assert.Eventually(t, func() bool {
+		return replaced.conn.GetState() == connectivity.Shutdown
+	}, time.Second, 5*time.Millisecond)
+}
+
+func TestConnPoolDrainTimeout(t *testing.T) {
+	startServer()
+	defer server.Cleanup()
+	clientBuilder := GrpcConnBuilder{}
+	clientBuilder.WithInsecure()
+	clientBuilder.WithOptions(grpc.WithContextDialer(gtest.GetBufDialer(server.GetListener())))
+	pool, err := clientBuilder.GetPool("localhost:50051", 1, WithPoolHealthCheckInterval(0), WithPoolDrainTimeout(20*time.Millisecond), WithPoolLogger(logging.Nop()))
+	assert.NoError(t, err)
+	defer pool.Close()
+	replaced := pool.conns[0]
+	atomic.AddInt64(&replaced.inFlight, 1)
+
+	pool.replace(0, replaced)
+	assert.Eventually(t, func() bool {
+		return replaced.conn.GetState() == connectivity.Shutdown
+	}, time.Second, 5*time.Millisecond)
+}
+
+func TestConnPoolClose(t *testing.T) {
+	startServer()
+	defer server.Cleanup()
+	pool := newTestPool(t, 2)
+	assert.NoError(t, pool.Close())
+	assert.NoError(t, pool.Close())
+
+	_, err := sayHello(pool)
+	assert.Equal(t, grpc.ErrClientConnClosing, err)
+}
+
+// sayHello calls the greeter through the interface, as the generated helloworld client predates grpc.ClientConnInterface
+func sayHello(cc grpc.ClientConnInterface) (*helloworld.HelloReply, error) {
+	reply := &helloworld.HelloReply{}
+	err := cc.Invoke(context.Background(), "/helloworld.Greeter/SayHello", &helloworld.HelloRequest{Name: "test"}, reply)
+	return reply, err
+}
@@ -0,0 +1,318 @@
+package grpc_client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/apssouza22/grpc-production-go/metrics"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"hash/fnv"
+	"io"
+	"math/rand"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// GroupRequestsMetric counts the RPCs routed to each group, labeled by group, method and code
+	GroupRequestsMetric = "grpc_client_group_requests_total"
+	// GroupRequestDurationMetric observes the duration in seconds of the RPCs routed to each group, labeled by group and method
+	GroupRequestDurationMetric = "grpc_client_group_request_duration_seconds"
+)
+
+// TargetGroup is a group of backends receiving a share of the traffic, e.g. the stable or the canary release
+type TargetGroup struct {
+	Name string
+	// Target is dialed by GrpcConnBuilder.GetGroupRouter
+	Target string
+	// Weight is the share of the traffic of the group. A zero weight only receives the pinned requests
+	Weight uint32
+}
+
+// RouterOption configures the group router
+type RouterOption func(*GroupRouter)
+
+// WithPinHeader routes the requests whose outgoing metadata key has the value (compared case insensitively) to the group,
+// e.g. WithPinHeader("x-canary", "true", "canary")
+func WithPinHeader(key string, value string, group string) RouterOption {
+	return func(r *GroupRouter) {
+		r.pins = append(r.pins, pinRule{key: strings.ToLower(key), value: value, group: group})
+	}
+}
+
+// WithStickyKey routes all the requests with the same key to the same group, as long as the weights do not change.
+// The key function returns false for the requests routed randomly
+func WithStickyKey(key func(ctx context.Context) (string, bool)) RouterOption {
+	return func(r *GroupRouter) {
+		r.stickyKey = key
+	}
+}
+
+// WithStickyHeader routes all the requests with the same value of the outgoing metadata key, e.g. the user ID, to the same group
+func WithStickyHeader(key string) RouterOption {
+	return WithStickyKey(func(ctx context.Context) (string, bool) {
+		md, _ := metadata.FromOutgoingContext(ctx)
+		values := md.Get(key)
+		if len(values) == 0 || values[0] == "" {
+			return "", false
+		}
+		return values[0], true
+	})
+}
+
+// WithRouterMetrics sets the provider of the per-group metrics. The default provider is used otherwise
+func WithRouterMetrics(provider metrics.Provider) RouterOption {
+	return func(r *GroupRouter) {
+		r.metrics = provider
+	}
+}
+
+type pinRule struct {
+	key   string
+	value string
+	group string
+}
+
+// routedGroup is a group with its connection
+type routedGroup struct {
+	name   string
+	weight uint32
+	conn   grpc.ClientConnInterface
+}
+
+// GroupRouter splits the RPCs between target groups by weight, for canary releases. A request is routed, in order,
+// to the group pinned by its metadata, to the group of its sticky key or to a random group picked by weight.
+// It implements grpc.ClientConnInterface, so generated clients accept it in place of a *grpc.ClientConn
+type GroupRouter struct {
+	pins      []pinRule
+	stickyKey func(ctx context.Context) (string, bool)
+	metrics   metrics.Provider
+	requests  metrics.Counter
+	durations metrics.Histogram
+	closers   []io.Closer
+	mu        sync.RWMutex
+	groups    []*routedGroup
+	total     uint32
+	rand      *rand.Rand
+	randMu    sync.Mutex
+}
+
+var _ grpc.ClientConnInterface = (*GroupRouter)(nil)
+
+// NewGroupRouter creates a router sending the RPCs of each group through its connection
+func NewGroupRouter(groups []TargetGroup, conns map[string]grpc.ClientConnInterface, opts ...RouterOption) (*GroupRouter, error) {
+	r := &GroupRouter{rand: rand.New(rand.NewSource(time.Now().UnixNano()))}
+	for _, opt := range opts {
+		opt(r)
+	}
+	r.metrics = metrics.OrDefault(r.metrics)
+	r.requests = r.metrics.Counter(GroupRequestsMetric)
+	r.durations = r.metrics.Histogram(GroupRequestDurationMetric)
+
+	names := make(map[string]bool, len(groups))
+	for _, group := range groups {
+		if group.Name == "" || names[group.Name] {
+			return nil, fmt.Errorf("invalid or duplicate group name %q", group.Name)
+		}
+		names[group.Name] = true
+		conn, ok := conns[group.Name]
+		if !ok {
+			return nil, fmt.Errorf("no connection for the group %q", group.Name)
+		}
+		r.groups = append(r.groups, &routedGroup{name: group.Name, weight: group.Weight, conn: conn})
+		r.total += group.Weight
+	}
+	if r.total == 0 {
+		return nil, errors.New("the total weight of the groups must be positive")
+	}
+	for _, pin := range r.pins {
+		if !names[pin.group] {
+			return nil, fmt.Errorf("unknown pinned group %q", pin.group)
+		}
+	}
+	return r, nil
+}
+
+// GetGroupRouter dials the target of each group and returns the router splitting the RPCs between them.
+// Closing the router closes the connections
+func (b *GrpcConnBuilder) GetGroupRouter(groups []TargetGroup, opts ...RouterOption) (*GroupRouter, error) {
+	conns := make(map[string]grpc.ClientConnInterface, len(groups))
+	var closers []io.Closer
+	closeAll := func() {
+		for _, closer := range closers {
+			closer.Close()
+		}
+	}
+	for _, group := range groups {
+		if _, ok := conns[group.Name]; ok {
+			continue
+		}
+		cc, err := b.dial(b.getContext(), group.Target)
+		if err != nil {
+			closeAll()
+			return nil, fmt.Errorf("unable to connect to the group %q. address = %s: %w", group.Name, group.Target, err)
+		}
+		conns[group.Name] = cc
+		closers = append(closers, cc)
+	}
+	r, err := NewGroupRouter(groups, conns, opts...)
+	if err != nil {
+		closeAll()
+		return nil, err
+	}
+	r.closers = closers
+	return r, nil
+}
+
+// SetWeights changes the weights of the groups, e.g. to ramp up the canary. The groups not listed keep their weight
+func (r *GroupRouter) SetWeights(weights map[string]uint32) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	total := r.total
+	for name, weight := range weights {
+		group := r.group(name)
+		if group == nil {
+			return fmt.Errorf("unknown group %q", name)
+		}
+		total = total - group.weight + weight
+	}
+	if total == 0 {
+		return errors.New("the total weight of the groups must be positive")
+	}
+	groups := make([]*routedGroup, len(r.groups))
+	for i, group := range r.groups {
+		updated := *group
+		if weight, ok := weights[group.name]; ok {
+			updated.weight = weight
+		}
+		groups[i] = &updated
+	}
+	r.groups = groups
+	r.total = total
+	return nil
+}
+
+// Invoke sends the unary RPC to the group of the request
+func (r *GroupRouter) Invoke(ctx context.Context, method string, args interface{}, reply interface{}, opts ...grpc.CallOption) error {
+	group := r.route(ctx)
+	start := time.Now()
+	err := group.conn.Invoke(ctx, method, args, reply, opts...)
+	r.observe(group.name, method, start, err)
+	return err
+}
+
+// NewStream opens the stream on the group of the request. The stream is counted once RecvMsg returns its final status,
+// or once its context is canceled when the caller gives up on it
+func (r *GroupRouter) NewStream(ctx context.Context, desc *grpc.StreamDesc, method string, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+	group := r.route(ctx)
+	start := time.Now()
+	stream, err := group.conn.NewStream(ctx, desc, method, opts...)
+	if err != nil {
+		r.observe(group.name, method, start, err)
+		return nil, err
+	}
+	routed := &routedClientStream{ClientStream: stream, serverStreams: desc.ServerStreams, finish: func(err error) {
+		r.observe(group.name, method, start, err)
+	}}
+	go func() {
+		// The stream context is canceled once the stream finishes, RecvMsg reports the status unless the caller gave up
+		<-stream.Context().Done()
+		if err := ctx.Err(); err != nil {
+			routed.once.Do(func() {
+				routed.finish(status.FromContextError(err).Err())
+			})
+		}
+	}()
+	return routed, nil
+}
+
+// Close closes the connections dialed by GetGroupRouter
+func (r *GroupRouter) Close() error {
+	var firstErr error
+	for _, closer := range r.closers {
+		if err := closer.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// route picks the group of the request: pinned, sticky or random by weight
+func (r *GroupRouter) route(ctx context.Context) *routedGroup {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if len(r.pins) > 0 {
+		md, _ := metadata.FromOutgoingContext(ctx)
+		for _, pin := range r.pins {
+			for _, value := range md.Get(pin.key) {
+				if strings.EqualFold(value, pin.value) {
+					return r.group(pin.group)
+				}
+			}
+		}
+	}
+	var point uint32
+	if key, ok := r.sticky(ctx); ok {
+		hash := fnv.New32a()
+		hash.Write([]byte(key))
+		point = hash.Sum32() % r.total
+	} else {
+		r.randMu.Lock()
+		point = uint32(r.rand.Int63n(int64(r.total)))
+		r.randMu.Unlock()
+	}
+	for _, group := range r.groups {
+		if point < group.weight {
+			return group
+		}
+		point -= group.weight
+	}
+	return r.groups[len(r.groups)-1]
+}
+
+func (r *GroupRouter) sticky(ctx context.Context) (string, bool) {
+	if r.stickyKey == nil {
+		return "", false
+	}
+	return r.stickyKey(ctx)
+}
+
+func (r *GroupRouter) group(name string) *routedGroup {
+	for _, group := range r.groups {
+		if group.name == name {
+			return group
+		}
+	}
+	return nil
+}
+
+func (r *GroupRouter) observe(group string, method string, start time.Time, err error) {
+	r.requests.Add(1, "group", group, "method", method, "code", status.Code(err).String())
+	r.durations.Observe(time.Since(start).Seconds(), "group", group, "method", method)
+}
+
+// routedClientStream reports the final status of the stream
+type routedClientStream struct {
+	grpc.ClientStream
+	// serverStreams is false when the server sends a single response, the first RecvMsg is then the last one
+	serverStreams bool
+	finish        func(err error)
+	once          sync.Once
+}
+
+func (s *routedClientStream) RecvMsg(m interface{}) error {
+	err := s.ClientStream.RecvMsg(m)
+	if err != nil || !s.serverStreams {
+		finalErr := err
+		if err == io.EOF {
+			finalErr = nil
+		}
+		s.once.Do(func() {
+			s.finish(finalErr)
+		})
+	}
+	return err
+}
@@ -0,0 +1,163 @@
+package grpc_client
+
+import (
+	"context"
+	"fmt"
+	"github.com/apssouza22/grpc-production-go/metrics"
+	gtest "github.com/apssouza22/grpc-production-go/testing"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"sync"
+	"testing"
+	"time"
+)
+
+// groupConn records the calls routed to its group
+type groupConn struct {
+	mu      sync.Mutex
+	calls   int
+	err     error
+	streams bool
+}
+
+func (c *groupConn) Invoke(ctx context.Context, method string, args interface{}, reply interface{}, opts ...grpc.CallOption) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.calls++
+	return c.err
+}
+
+func (c *groupConn) NewStream(ctx context.Context, desc *grpc.StreamDesc, method string, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+	if !c.streams {
+		return nil, status.Error(codes.Unimplemented, "streams not supported")
+	}
+	return &groupStream{ctx: ctx}, nil
+}
+
+// groupStream is a stream whose context is the one of the call
+type groupStream struct {
+	grpc.ClientStream
+	ctx context.Context
+}
+
+func (s *groupStream) Context() context.Context {
+	return s.ctx
+}
+
+func newTestGroupRouter(t *testing.T, stable uint32, canary uint32, opts ...RouterOption) (*GroupRouter, *groupConn, *groupConn) {
+	stableConn, canaryConn := &groupConn{}, &groupConn{}
+	router, err := NewGroupRouter(
+		[]TargetGroup{{Name: "stable", Weight: stable}, {Name: "canary", Weight: canary}},
+		map[string]grpc.ClientConnInterface{"stable": stableConn, "canary": canaryConn},
+		opts...,
+	)
+	assert.NoError(t, err)
+	return router, stableConn, canaryConn
+}
+
+func TestGroupRouterSplitsByWeight(t *testing.T) {
+	router, stable, canary := newTestGroupRouter(t, 90, 10)
+	for i := 0; i < 1000; i++ {
+		assert.NoError(t, router.Invoke(context.Background(), "/helloworld.Greeter/SayHello", nil, nil))
+	}
+	assert.InDelta(t, 900, stable.calls, 60)
+	assert.InDelta(t, 100, canary.calls, 60)
+
+	assert.NoError(t, router.SetWeights(map[string]uint32{"stable": 0, "canary": 1}))
+	for i := 0; i < 10; i++ {
+		assert.NoError(t, router.Invoke(context.Background(), "/helloworld.Greeter/SayHello", nil, nil))
+	}
+	assert.Equal(t, 1000, stable.calls+canary.calls-10)
+	assert.InDelta(t, 110, canary.calls, 60)
+	assert.Error(t, router.SetWeights(map[string]uint32{"unknown": 1}))
+	assert.Error(t, router.SetWeights(map[string]uint32{"canary": 0}))
+}
+
+func TestGroupRouterPinHeader(t *testing.T) {
+	router, stable, canary := newTestGroupRouter(t, 1, 0, WithPinHeader("x-canary", "true", "canary"))
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "x-canary", "TRUE")
+	for i := 0; i < 5; i++ {
+		assert.NoError(t, router.Invoke(ctx, "/helloworld.Greeter/SayHello", nil, nil))
+	}
+	assert.NoError(t, router.Invoke(context.Background(), "/helloworld.Greeter/SayHello", nil, nil))
+	assert.Equal(t, 5, canary.calls)
+	assert.Equal(t, 1, stable.calls)
+}
+
+func TestGroupRouterStickyHeader(t *testing.T) {
+	router, stable, canary := newTestGroupRouter(t, 1, 1, WithStickyHeader("x-user-id"))
+	seen := make(map[*groupConn]bool)
+	for user := 0; user < 20; user++ {
+		ctx := metadata.AppendToOutgoingContext(context.Background(), "x-user-id", fmt.Sprintf("user-%d", user))
+		stableBefore, canaryBefore := stable.calls, canary.calls
+		for i := 0; i < 5; i++ {
+			assert.NoError(t, router.Invoke(ctx, "/helloworld.Greeter/SayHello", nil, nil))
+		}
+		// All the calls of the user go to the same group
+		assert.True(t, stable.calls-stableBefore == 5 || canary.calls-canaryBefore == 5)
+		if stable.calls > stableBefore {
+			seen[stable] = true
+		} else {
+			seen[canary] = true
+		}
+	}
+	assert.Len(t, seen, 2)
+}
+
+func TestGroupRouterMetrics(t *testing.T) {
+	provider := metrics.NewMemory()
+	router, _, canary := newTestGroupRouter(t, 0, 1, WithRouterMetrics(provider))
+	assert.NoError(t, router.Invoke(context.Background(), "/helloworld.Greeter/SayHello", nil, nil))
+	canary.err = status.Error(codes.Unavailable, "down")
+	assert.Error(t, router.Invoke(context.Background(), "/helloworld.Greeter/SayHello", nil, nil))
+
+	assert.Equal(t, float64(1), provider.Value(GroupRequestsMetric, "group", "canary", "method", "/helloworld.Greeter/SayHello", "code", "OK"))
+	assert.Equal(t, float64(1), provider.Value(GroupRequestsMetric, "group", "canary", "method", "/helloworld.Greeter/SayHello", "code", "Unavailable"))
+	assert.Len(t, provider.Observations(GroupRequestDurationMetric, "group", "canary", "method", "/helloworld.Greeter/SayHello"), 2)
+}
+
+func TestGroupRouterStreamCanceled(t *testing.T) {
+	provider := metrics.NewMemory()
+	router, _, canary := newTestGroupRouter(t, 0, 1, WithRouterMetrics(provider))
+	canary.streams = true
+	ctx, cancel := context.WithCancel(context.Background())
+	_, err := router.NewStream(ctx, &grpc.StreamDesc{ServerStreams: true}, "/helloworld.Greeter/Watch")
+	assert.NoError(t, err)
+	cancel()
+
+	assert.Eventually(t, func() bool {
+		return provider.Value(GroupRequestsMetric, "group", "canary", "method", "/helloworld.Greeter/Watch", "code", "Canceled") == 1
+	}, time.Second, 5*time.Millisecond)
+}
+
+func TestGroupRouterValidation(t *testing.T) {
+	conns := map[string]grpc.ClientConnInterface{"stable": &groupConn{}}
+	_, err := NewGroupRouter([]TargetGroup{{Name: "stable", Weight: 1}, {Name: "stable", Weight: 1}}, conns)
+	assert.Error(t, err)
+	_, err = NewGroupRouter([]TargetGroup{{Name: "canary", Weight: 1}}, conns)
+	assert.Error(t, err)
+	_, err = NewGroupRouter([]TargetGroup{{Name: "stable"}}, conns)
+	assert.Error(t, err)
+	_, err = NewGroupRouter([]TargetGroup{{Name: "stable", Weight: 1}}, conns, WithPinHeader("x-canary", "true", "canary"))
+	assert.Error(t, err)
+}
+
+func TestGetGroupRouter(t *testing.T) {
+	startServer()
+	defer server.Cleanup()
+	builder := GrpcConnBuilder{}
+	builder.WithInsecure()
+	builder.WithContextDialer(gtest.GetBufDialer(server.GetListener()))
+	router, err := builder.GetGroupRouter([]TargetGroup{
+		{Name: "stable", Target: "stable:50051", Weight: 9},
+		{Name: "canary", Target: "canary:50051", Weight: 1},
+	})
+	assert.NoError(t, err)
+	defer router.Close()
+	resp, err := sayHello(router)
+	assert.NoError(t, err)
+	assert.Equal(t, "This is a mocked service test", resp.Message)
+}
@@ -0,0 +1,267 @@
+package grpc_client
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/apssouza22/grpc-production-go/balancing"
+	"github.com/apssouza22/grpc-production-go/logging"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/balancer"
+	"google.golang.org/grpc/balancer/roundrobin"
+	"google.golang.org/grpc/codes"
+	_ "google.golang.org/grpc/health" // registers the client side health checking
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+)
+
+// The load balancing policies accepted by WithLoadBalancingPolicy, in addition to any policy registered with gRPC
+const (
+	PickFirst          = grpc.PickFirstBalancerName
+	RoundRobin         = roundrobin.Name
+	WeightedRoundRobin = balancing.WeightedRoundRobin
+)
+
+// MethodConfig configures the calls to a set of methods
+type MethodConfig struct {
+	// Methods are the methods configured, as "/package.Service/Method", or "/package.Service/" for all the methods of the service
+	Methods []string
+	// Timeout is the default deadline of the calls. Zero means no timeout
+	Timeout time.Duration
+	// WaitForReady makes the calls wait for the connection to be ready instead of failing fast. Nil keeps the default
+	WaitForReady *bool
+	// MaxRequestBytes and MaxResponseBytes cap the size of the messages. Zero keeps the default
+	MaxRequestBytes  int
+	MaxResponseBytes int
+	// Retry retries the failed calls. Retries are only performed when the GRPC_GO_RETRY environment variable is "on"
+	Retry *RetryPolicy
+}
+
+// RetryPolicy retries the calls failing with one of the retryable codes, with an exponential backoff
+type RetryPolicy struct {
+	// MaxAttempts counts the original call, it must be at least 2
+	MaxAttempts       int
+	InitialBackoff    time.Duration
+	MaxBackoff        time.Duration
+	BackoffMultiplier float64
+	RetryableCodes    []codes.Code
+}
+
+// WithLoadBalancingPolicy sets the load balancing policy: PickFirst (the default), RoundRobin, WeightedRoundRobin
+// or any other policy registered with gRPC. It replaces the policy of the service config file
+func (b *GrpcConnBuilder) WithLoadBalancingPolicy(policy string) {
+	b.lbPolicy = policy
+}
+
+// WithMethodConfig adds the method configs, in addition to the ones of the service config file
+func (b *GrpcConnBuilder) WithMethodConfig(configs ...MethodConfig) {
+	b.methodConfigs = append(b.methodConfigs, configs...)
+}
+
+// WithServiceConfigFile loads the service config from the JSON file when the connection is built.
+// See https://github.com/grpc/grpc/blob/master/doc/service_config.md for the format
+func (b *GrpcConnBuilder) WithServiceConfigFile(path string) {
+	b.serviceConfigFile = path
+}
+
+// WithHealthCheck checks the health of the service on each backend with the gRPC health checking protocol.
+// The backends not serving are not picked. It requires a policy supporting it such as RoundRobin or WeightedRoundRobin
+func (b *GrpcConnBuilder) WithHealthCheck(service string) {
+	b.healthCheckService = &service
+}
+
+// serviceConfigJSON is the JSON representation of the service config
+type serviceConfigJSON struct {
+	LoadBalancingPolicy string                       `json:"loadBalancingPolicy,omitempty"`
+	LoadBalancingConfig []map[string]json.RawMessage `json:"loadBalancingConfig,omitempty"`
+	MethodConfig        []methodConfigJSON           `json:"methodConfig,omitempty"`
+	RetryThrottling     json.RawMessage              `json:"retryThrottling,omitempty"`
+	HealthCheckConfig   *healthCheckConfigJSON       `json:"healthCheckConfig,omitempty"`
+}
+
+type methodConfigJSON struct {
+	Name                    []methodNameJSON `json:"name"`
+	WaitForReady            *bool            `json:"waitForReady,omitempty"`
+	Timeout                 string           `json:"timeout,omitempty"`
+	MaxRequestMessageBytes  int              `json:"maxRequestMessageBytes,omitempty"`
+	MaxResponseMessageBytes int              `json:"maxResponseMessageBytes,omitempty"`
+	RetryPolicy             *retryPolicyJSON `json:"retryPolicy,omitempty"`
+}
+
+type methodNameJSON struct {
+	Service string `json:"service"`
+	Method  string `json:"method,omitempty"`
+}
+
+type retryPolicyJSON struct {
+	MaxAttempts          int          `json:"maxAttempts"`
+	InitialBackoff       string       `json:"initialBackoff"`
+	MaxBackoff           string       `json:"maxBackoff"`
+	BackoffMultiplier    float64      `json:"backoffMultiplier"`
+	RetryableStatusCodes []codes.Code `json:"retryableStatusCodes"`
+}
+
+type healthCheckConfigJSON struct {
+	ServiceName string `json:"serviceName"`
+}
+
+// serviceConfigOption returns the dial option setting the service config, nil when nothing is configured.
+// The config is validated, so the mistakes surface when the connection is built rather than when it is used:
+// gRPC parses it when dialing and the checks it lacks are done here
+func (b *GrpcConnBuilder) serviceConfigOption() (grpc.DialOption, error) {
+	if b.serviceConfigFile == "" && b.lbPolicy == "" && len(b.methodConfigs) == 0 && b.healthCheckService == nil {
+		return nil, nil
+	}
+	sc := &serviceConfigJSON{}
+	if b.serviceConfigFile != "" {
+		var err error
+		if sc, err = loadServiceConfig(b.serviceConfigFile); err != nil {
+			return nil, err
+		}
+	}
+	if b.lbPolicy != "" {
+		sc.LoadBalancingPolicy = b.lbPolicy
+		sc.LoadBalancingConfig = nil
+	}
+	for _, config := range b.methodConfigs {
+		mc, err := config.toJSON()
+		if err != nil {
+			return nil, err
+		}
+		sc.MethodConfig = append(sc.MethodConfig, mc)
+	}
+	if b.healthCheckService != nil {
+		sc.HealthCheckConfig = &healthCheckConfigJSON{ServiceName: *b.healthCheckService}
+	}
+	if err := sc.validate(); err != nil {
+		return nil, fmt.Errorf("invalid service config: %w", err)
+	}
+	if sc.hasRetryPolicy() && !strings.EqualFold(os.Getenv("GRPC_GO_RETRY"), "on") {
+		logging.OrDefault(b.logger).Warn("the retry policies are ignored unless the GRPC_GO_RETRY environment variable is on")
+	}
+	raw, err := json.Marshal(sc)
+	if err != nil {
+		return nil, fmt.Errorf("unable to encode the service config: %w", err)
+	}
+	return grpc.WithDefaultServiceConfig(string(raw)), nil
+}
+
+func loadServiceConfig(path string) (*serviceConfigJSON, error) {
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read the service config file: %w", err)
+	}
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.DisallowUnknownFields()
+	sc := &serviceConfigJSON{}
+	if err := decoder.Decode(sc); err != nil {
+		return nil, fmt.Errorf("invalid service config file %s: %w", path, err)
+	}
+	return sc, nil
+}
+
+// validate checks what the gRPC parser accepts silently, the parser itself runs when the connection is dialed
+func (sc *serviceConfigJSON) validate() error {
+	policy := sc.LoadBalancingPolicy
+	if len(sc.LoadBalancingConfig) > 0 {
+		// gRPC uses the first registered policy of the list and rejects the list without any
+		policy = ""
+		for _, config := range sc.LoadBalancingConfig {
+			for name := range config {
+				if policy == "" && balancer.Get(name) != nil {
+					policy = name
+				}
+			}
+		}
+	} else if policy != "" && balancer.Get(policy) == nil {
+		return fmt.Errorf("unknown load balancing policy %q", policy)
+	}
+	if sc.HealthCheckConfig != nil && (policy == "" || policy == PickFirst) {
+		return fmt.Errorf("health checking requires a load balancing policy supporting it, such as %s", RoundRobin)
+	}
+
+	seen := make(map[methodNameJSON]bool)
+	for _, mc := range sc.MethodConfig {
+		if err := mc.validate(); err != nil {
+			return err
+		}
+		for _, name := range mc.Name {
+			if seen[name] {
+				return fmt.Errorf("duplicate method config for /%s/%s", name.Service, name.Method)
+			}
+			seen[name] = true
+		}
+	}
+	return nil
+}
+
+func (sc *serviceConfigJSON) hasRetryPolicy() bool {
+	for _, mc := range sc.MethodConfig {
+		if mc.RetryPolicy != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// validate rejects the retry policies gRPC ignores rather than failing
+func (mc methodConfigJSON) validate() error {
+	retry := mc.RetryPolicy
+	if retry == nil {
+		return nil
+	}
+	if retry.MaxAttempts < 2 {
+		return fmt.Errorf("retry policy maxAttempts must be at least 2, got %d", retry.MaxAttempts)
+	}
+	if retry.BackoffMultiplier <= 0 {
+		return fmt.Errorf("retry policy backoffMultiplier must be positive")
+	}
+	if len(retry.RetryableStatusCodes) == 0 {
+		return fmt.Errorf("retry policy without retryableStatusCodes")
+	}
+	return nil
+}
+
+func (c MethodConfig) toJSON() (methodConfigJSON, error) {
+	mc := methodConfigJSON{
+		WaitForReady:            c.WaitForReady,
+		MaxRequestMessageBytes:  c.MaxRequestBytes,
+		MaxResponseMessageBytes: c.MaxResponseBytes,
+	}
+	for _, method := range c.Methods {
+		parts := strings.Split(strings.TrimPrefix(method, "/"), "/")
+		if len(parts) != 2 || parts[0] == "" {
+			return mc, fmt.Errorf("invalid method %q, expected /package.Service/Method or /package.Service/", method)
+		}
+		mc.Name = append(mc.Name, methodNameJSON{Service: parts[0], Method: parts[1]})
+	}
+	if c.Timeout < 0 {
+		return mc, fmt.Errorf("negative timeout for %v", c.Methods)
+	}
+	if c.MaxRequestBytes < 0 || c.MaxResponseBytes < 0 {
+		return mc, fmt.Errorf("negative max message size for %v", c.Methods)
+	}
+	if c.Timeout > 0 {
+		mc.Timeout = formatConfigDuration(c.Timeout)
+	}
+	if c.Retry != nil {
+		if c.Retry.InitialBackoff <= 0 || c.Retry.MaxBackoff <= 0 {
+			return mc, fmt.Errorf("retry policy backoffs must be positive for %v", c.Methods)
+		}
+		mc.RetryPolicy = &retryPolicyJSON{
+			MaxAttempts:          c.Retry.MaxAttempts,
+			InitialBackoff:       formatConfigDuration(c.Retry.InitialBackoff),
+			MaxBackoff:           formatConfigDuration(c.Retry.MaxBackoff),
+			BackoffMultiplier:    c.Retry.BackoffMultiplier,
+			RetryableStatusCodes: c.Retry.RetryableCodes,
+		}
+	}
+	return mc, nil
+}
+
+// formatConfigDuration formats the duration the way the service config expects it, e.g. "1.500000000s"
+func formatConfigDuration(d time.Duration) string {
+	return fmt.Sprintf("%d.%09ds", d/time.Second, d%time.Second)
+}
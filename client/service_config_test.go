@@ -0,0 +1,162 @@
+package grpc_client
+
+import (
+	"github.com/apssouza22/grpc-production-go/logging"
+	gtest "github.com/apssouza22/grpc-production-go/testing"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+)
+
+func newServiceConfigBuilder() *GrpcConnBuilder {
+	builder := &GrpcConnBuilder{}
+	builder.WithInsecure()
+	builder.WithLogger(logging.Nop())
+	builder.WithOptions(grpc.WithContextDialer(gtest.GetBufDialer(server.GetListener())))
+	return builder
+}
+
+func writeServiceConfig(t *testing.T, content string) string {
+	file, err := ioutil.TempFile("", "service_config*.json")
+	assert.NoError(t, err)
+	defer file.Close()
+	_, err = file.WriteString(content)
+	assert.NoError(t, err)
+	return file.Name()
+}
+
+func TestServiceConfig(t *testing.T) {
+	startServer()
+	defer server.Cleanup()
+	builder := newServiceConfigBuilder()
+	builder.WithLoadBalancingPolicy(RoundRobin)
+	builder.WithHealthCheck("")
+	builder.WithMethodConfig(MethodConfig{
+		Methods: []string{"/helloworld.Greeter/"},
+		Retry: &RetryPolicy{
+			MaxAttempts:       3,
+			InitialBackoff:    100 * time.Millisecond,
+			MaxBackoff:        time.Second,
+			BackoffMultiplier: 2,
+			RetryableCodes:    []codes.Code{codes.Unavailable},
+		},
+	})
+	cc, err := builder.GetConn("localhost:50051")
+	assert.NoError(t, err)
+	defer cc.Close()
+	resp, err := sayHello(cc)
+	assert.NoError(t, err)
+	assert.Equal(t, "This is a mocked service test", resp.Message)
+}
+
+func TestServiceConfigMethodTimeout(t *testing.T) {
+	startServer()
+	defer server.Cleanup()
+	builder := newServiceConfigBuilder()
+	builder.WithMethodConfig(MethodConfig{Methods: []string{"/helloworld.Greeter/SayHello"}, Timeout: time.Nanosecond})
+	cc, err := builder.GetConn("localhost:50051")
+	assert.NoError(t, err)
+	defer cc.Close()
+	_, err = sayHello(cc)
+	assert.Equal(t, codes.DeadlineExceeded, status.Code(err))
+}
+
+func TestServiceConfigFile(t *testing.T) {
+	startServer()
+	defer server.Cleanup()
+	path := writeServiceConfig(t, `{
+		"loadBalancingConfig": [{"unknown_policy": {}}, {"round_robin": {}}],
+		"methodConfig": [{"name": [{"service": "helloworld.Greeter"}], "timeout": "0.000000001s"}]
+	}`)
+	defer os.Remove(path)
+	builder := newServiceConfigBuilder()
+	builder.WithServiceConfigFile(path)
+	cc, err := builder.GetConn("localhost:50051")
+	assert.NoError(t, err)
+	defer cc.Close()
+	_, err = sayHello(cc)
+	assert.Equal(t, codes.DeadlineExceeded, status.Code(err))
+}
+
+func TestServiceConfigValidation(t *testing.T) {
+	tests := []struct {
+		name      string
+		configure func(b *GrpcConnBuilder)
+		want      string
+	}{
+		{"unknown policy", func(b *GrpcConnBuilder) { b.WithLoadBalancingPolicy("random") }, `unknown load balancing policy "random"`},
+		{"health check with pick first", func(b *GrpcConnBuilder) { b.WithHealthCheck("") }, "health checking requires"},
+		{"invalid method", func(b *GrpcConnBuilder) {
+			b.WithMethodConfig(MethodConfig{Methods: []string{"SayHello"}})
+		}, `invalid method "SayHello"`},
+		{"duplicate method", func(b *GrpcConnBuilder) {
+			b.WithMethodConfig(MethodConfig{Methods: []string{"/helloworld.Greeter/"}}, MethodConfig{Methods: []string{"/helloworld.Greeter/"}})
+		}, "duplicate method config"},
+		{"single attempt", func(b *GrpcConnBuilder) {
+			b.WithMethodConfig(MethodConfig{Methods: []string{"/helloworld.Greeter/"}, Retry: &RetryPolicy{
+				MaxAttempts: 1, InitialBackoff: time.Millisecond, MaxBackoff: time.Second, BackoffMultiplier: 2, RetryableCodes: []codes.Code{codes.Unavailable},
+			}})
+		}, "maxAttempts must be at least 2"},
+		{"no retryable codes", func(b *GrpcConnBuilder) {
+			b.WithMethodConfig(MethodConfig{Methods: []string{"/helloworld.Greeter/"}, Retry: &RetryPolicy{
+				MaxAttempts: 2, InitialBackoff: time.Millisecond, MaxBackoff: time.Second, BackoffMultiplier: 2,
+			}})
+		}, "without retryableStatusCodes"},
+		{"no backoff", func(b *GrpcConnBuilder) {
+			b.WithMethodConfig(MethodConfig{Methods: []string{"/helloworld.Greeter/"}, Retry: &RetryPolicy{MaxAttempts: 2}})
+		}, "backoffs must be positive"},
+		{"missing file", func(b *GrpcConnBuilder) { b.WithServiceConfigFile("/does/not/exist.json") }, "unable to read the service config file"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			builder := &GrpcConnBuilder{}
+			builder.WithInsecure()
+			tt.configure(builder)
+			_, err := builder.GetConn("localhost:50051")
+			if assert.Error(t, err) {
+				assert.Contains(t, err.Error(), tt.want)
+			}
+		})
+	}
+}
+
+func TestServiceConfigFileValidation(t *testing.T) {
+	path := writeServiceConfig(t, `{"methodConfig": [{"name": [{"service": "helloworld.Greeter"}], "timeout": "1m"}]}`)
+	defer os.Remove(path)
+	builder := &GrpcConnBuilder{}
+	builder.WithInsecure()
+	builder.WithServiceConfigFile(path)
+	_, err := builder.GetConn("localhost:50051")
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "service config is invalid")
+	}
+
+	path = writeServiceConfig(t, `{"loadBalancingConfig": [{"unknown_policy": {}}]}`)
+	defer os.Remove(path)
+	builder.WithServiceConfigFile(path)
+	_, err = builder.GetConn("localhost:50051")
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "no supported policies found")
+	}
+
+	path = writeServiceConfig(t, `{"loadBalancingConfig": [{"pick_first": {}}], "healthCheckConfig": {"serviceName": ""}}`)
+	defer os.Remove(path)
+	builder.WithServiceConfigFile(path)
+	_, err = builder.GetConn("localhost:50051")
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "health checking requires")
+	}
+
+	path = writeServiceConfig(t, `{"loadBalancingPolicy": "round_robin", "unknownField": true}`)
+	defer os.Remove(path)
+	builder.WithServiceConfigFile(path)
+	_, err = builder.GetConn("localhost:50051")
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), `unknown field "unknownField"`)
+	}
+}
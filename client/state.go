@@ -0,0 +1,292 @@
+package grpc_client
+
+import (
+	"context"
+	"fmt"
+	"github.com/apssouza22/grpc-production-go/logging"
+	"github.com/apssouza22/grpc-production-go/metrics"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/connectivity"
+	"google.golang.org/grpc/credentials"
+	"net"
+	"sync"
+	"time"
+)
+
+const (
+	// ConnStateChangesMetric counts the connectivity state transitions, labeled by target and state
+	ConnStateChangesMetric = "grpc_client_connection_state_changes_total"
+	// ConnStateMetric is 1 for the current connectivity state of the connection and 0 for the others, labeled by target and state
+	ConnStateMetric = "grpc_client_connection_state"
+)
+
+// StateChange is a connectivity state transition of a monitored connection
+type StateChange struct {
+	Target string
+	From   connectivity.State
+	To     connectivity.State
+	// Err is the last transport failure, set when the connection moves to TRANSIENT_FAILURE
+	Err  error
+	Time time.Time
+}
+
+// NotReadyError is returned by WaitForReady when the connection did not become ready
+type NotReadyError struct {
+	Target string
+	// State is the connectivity state when the wait ended
+	State connectivity.State
+	// LastErr is the last transport failure (dial or handshake), nil when none was recorded
+	LastErr error
+	// Err is the reason the wait ended: the context error or grpc.ErrClientConnClosing
+	Err error
+}
+
+func (e *NotReadyError) Error() string {
+	if e.LastErr == nil {
+		return fmt.Sprintf("connection to %s not ready (state %s): %v", e.Target, e.State, e.Err)
+	}
+	return fmt.Sprintf("connection to %s not ready (state %s): %v: last transport failure: %v", e.Target, e.State, e.Err, e.LastErr)
+}
+
+// Unwrap returns the reason the wait ended, so errors.Is(err, context.DeadlineExceeded) works
+func (e *NotReadyError) Unwrap() error {
+	return e.Err
+}
+
+// MonitorOption configures a monitored connection
+type MonitorOption func(*MonitoredConn)
+
+// WithStateListener subscribes the listener to the state transitions from the start. See MonitoredConn.Subscribe
+func WithStateListener(listener func(StateChange)) MonitorOption {
+	return func(c *MonitoredConn) {
+		c.subscribe(listener)
+	}
+}
+
+// WithMonitorLogger sets the logger receiving the state transitions. The default logger is used otherwise
+func WithMonitorLogger(logger logging.Logger) MonitorOption {
+	return func(c *MonitoredConn) {
+		c.logger = logger
+	}
+}
+
+// WithMonitorMetrics sets the provider of the connection state metrics. The default provider is used otherwise
+func WithMonitorMetrics(provider metrics.Provider) MonitorOption {
+	return func(c *MonitoredConn) {
+		c.metrics = provider
+	}
+}
+
+// MonitoredConn is a client connection watching its connectivity state. It logs and counts the transitions,
+// notifies the subscribers and remembers the last transport failure to explain why the connection is not ready
+type MonitoredConn struct {
+	*grpc.ClientConn
+	target    string
+	logger    logging.Logger
+	metrics   metrics.Provider
+	changes   metrics.Counter
+	gauge     metrics.Gauge
+	mu        sync.Mutex
+	listeners map[int]func(StateChange)
+	nextID    int
+	lastErr   error
+	cancel    context.CancelFunc
+	wg        sync.WaitGroup
+}
+
+// GetMonitoredConn returns a monitored connection to the server, with the transport credentials when they were set.
+// The TLS handshake failures are recorded, and so are the dial failures (refused, DNS, ...) of the dialer set with
+// WithContextDialer, or of the direct dialer replacing the default gRPC one. The default gRPC dialer is kept when the
+// environment sets a proxy for the address, its failures are then only known from the state transitions
+func (b *GrpcConnBuilder) GetMonitoredConn(addr string, opts ...MonitorOption) (*MonitoredConn, error) {
+	if addr == "" {
+		return nil, fmt.Errorf("target connection parameter missing. address = %s", addr)
+	}
+	c := &MonitoredConn{
+		target:    addr,
+		listeners: make(map[int]func(StateChange)),
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	c.logger = logging.OrDefault(c.logger).With("target", addr)
+	c.metrics = metrics.OrDefault(c.metrics)
+	c.changes = c.metrics.Counter(ConnStateChangesMetric)
+	c.gauge = c.metrics.Gauge(ConnStateMetric)
+
+	dialOpts, err := b.dialOptions()
+	if err != nil {
+		return nil, err
+	}
+	if b.dialer != nil {
+		dialOpts = append(dialOpts, grpc.WithContextDialer(c.recordingDialer(b.dialer)))
+	} else if !proxied(addr) {
+		// Placed first, so a dialer passed to WithOptions still replaces it
+		dialOpts = append([]grpc.DialOption{grpc.WithContextDialer(c.recordingDialer(directDialer))}, dialOpts...)
+	}
+	if b.transportCredentials != nil {
+		dialOpts = append(dialOpts, grpc.WithTransportCredentials(&recordingCredentials{
+			TransportCredentials: b.transportCredentials,
+			record:               c.recordFailure,
+		}))
+	}
+	cc, err := grpc.DialContext(b.getContext(), addr, dialOpts...)
+	if err != nil {
+		if lastErr := c.LastError(); lastErr != nil {
+			return nil, fmt.Errorf("unable to connect to client. address = %s. error = %v: last transport failure: %w", addr, err, lastErr)
+		}
+		return nil, fmt.Errorf("unable to connect to client. address = %s. error = %w", addr, err)
+	}
+	c.ClientConn = cc
+	ctx, cancel := context.WithCancel(context.Background())
+	c.cancel = cancel
+	c.wg.Add(1)
+	go c.watch(ctx)
+	return c, nil
+}
+
+// Subscribe calls the listener on each state transition until unsubscribed.
+// The listeners are called one at a time from the watching goroutine and must not block
+func (c *MonitoredConn) Subscribe(listener func(StateChange)) (unsubscribe func()) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.subscribe(listener)
+}
+
+func (c *MonitoredConn) subscribe(listener func(StateChange)) func() {
+	id := c.nextID
+	c.nextID++
+	c.listeners[id] = listener
+	return func() {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		delete(c.listeners, id)
+	}
+}
+
+// LastError returns the last transport failure since the connection was last ready, nil when none
+func (c *MonitoredConn) LastError() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.lastErr
+}
+
+// WaitForReady blocks until the connection is ready, asking it to reconnect without waiting for the backoff.
+// It fails once the context is done or the connection closed, with a NotReadyError naming the last transport failure.
+// The connection only leaves IDLE on its own or with the next RPC, the ClientConn cannot be asked to connect
+func (c *MonitoredConn) WaitForReady(ctx context.Context) error {
+	switch state := waitForReady(ctx, c.ClientConn); state {
+	case connectivity.Ready:
+		return nil
+	case connectivity.Shutdown:
+		return &NotReadyError{Target: c.target, State: state, LastErr: c.LastError(), Err: grpc.ErrClientConnClosing}
+	default:
+		return &NotReadyError{Target: c.target, State: state, LastErr: c.LastError(), Err: ctx.Err()}
+	}
+}
+
+// waitForReady asks the connection to reconnect without waiting for the backoff, then waits until it is ready,
+// closed or the context is done. It returns the state when the wait ended
+func waitForReady(ctx context.Context, cc *grpc.ClientConn) connectivity.State {
+	if cc.GetState() != connectivity.Ready {
+		cc.ResetConnectBackoff()
+	}
+	for {
+		state := cc.GetState()
+		if state == connectivity.Ready || state == connectivity.Shutdown || !cc.WaitForStateChange(ctx, state) {
+			return state
+		}
+	}
+}
+
+// Close closes the connection and stops watching it
+func (c *MonitoredConn) Close() error {
+	err := c.ClientConn.Close()
+	c.cancel()
+	c.wg.Wait()
+	return err
+}
+
+// watch reports the state transitions until the connection is closed. The connection starts IDLE,
+// the transitions happening while the dial returns are reported as a single one
+func (c *MonitoredConn) watch(ctx context.Context) {
+	defer c.wg.Done()
+	from := connectivity.Idle
+	c.gauge.Set(1, "target", c.target, "state", from.String())
+	for {
+		if to := c.GetState(); to != from {
+			c.transition(from, to)
+			from = to
+		}
+		if from == connectivity.Shutdown || !c.WaitForStateChange(ctx, from) {
+			return
+		}
+	}
+}
+
+func (c *MonitoredConn) transition(from connectivity.State, to connectivity.State) {
+	change := StateChange{Target: c.target, From: from, To: to, Time: time.Now()}
+	c.mu.Lock()
+	switch to {
+	case connectivity.Ready:
+		c.lastErr = nil
+	case connectivity.TransientFailure:
+		if c.lastErr == nil {
+			// The failures of the default gRPC dialer are not seen, only the transition tells the dial failed
+			c.lastErr = fmt.Errorf("connection to %s failed (state %s)", c.target, to)
+		}
+		change.Err = c.lastErr
+	}
+	listeners := make([]func(StateChange), 0, len(c.listeners))
+	for _, listener := range c.listeners {
+		listeners = append(listeners, listener)
+	}
+	c.mu.Unlock()
+
+	c.changes.Add(1, "target", c.target, "state", to.String())
+	c.gauge.Set(0, "target", c.target, "state", from.String())
+	c.gauge.Set(1, "target", c.target, "state", to.String())
+	if to == connectivity.TransientFailure {
+		c.logger.Warn("connection state changed", "from", from.String(), "to", to.String(), "err", change.Err)
+	} else {
+		c.logger.Info("connection state changed", "from", from.String(), "to", to.String())
+	}
+	for _, listener := range listeners {
+		listener(change)
+	}
+}
+
+func (c *MonitoredConn) recordFailure(err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.lastErr = err
+}
+
+// recordingDialer records the dial failures of the dialer
+func (c *MonitoredConn) recordingDialer(dialer func(ctx context.Context, addr string) (net.Conn, error)) func(ctx context.Context, addr string) (net.Conn, error) {
+	return func(ctx context.Context, addr string) (net.Conn, error) {
+		conn, err := dialer(ctx, addr)
+		if err != nil {
+			c.recordFailure(err)
+		}
+		return conn, err
+	}
+}
+
+// recordingCredentials records the TLS handshake failures
+type recordingCredentials struct {
+	credentials.TransportCredentials
+	record func(err error)
+}
+
+func (c *recordingCredentials) ClientHandshake(ctx context.Context, authority string, rawConn net.Conn) (net.Conn, credentials.AuthInfo, error) {
+	conn, info, err := c.TransportCredentials.ClientHandshake(ctx, authority, rawConn)
+	if err != nil {
+		c.record(fmt.Errorf("tls handshake: %w", err))
+	}
+	return conn, info, err
+}
+
+func (c *recordingCredentials) Clone() credentials.TransportCredentials {
+	return &recordingCredentials{TransportCredentials: c.TransportCredentials.Clone(), record: c.record}
+}
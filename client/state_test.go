@@ -0,0 +1,128 @@
+package grpc_client
+
+import (
+	"context"
+	"errors"
+	"github.com/apssouza22/grpc-production-go/logging"
+	"github.com/apssouza22/grpc-production-go/metrics"
+	gtest "github.com/apssouza22/grpc-production-go/testing"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/connectivity"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestMonitoredConnWaitForReady(t *testing.T) {
+	startServer()
+	defer server.Cleanup()
+	builder := &GrpcConnBuilder{}
+	builder.WithInsecure()
+	builder.WithContextDialer(gtest.GetBufDialer(server.GetListener()))
+	cc, err := builder.GetMonitoredConn("localhost:50051", WithMonitorLogger(logging.Nop()))
+	assert.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	assert.NoError(t, cc.WaitForReady(ctx))
+	assert.Nil(t, cc.LastError())
+	resp, err := sayHello(cc)
+	assert.NoError(t, err)
+	assert.Equal(t, "This is a mocked service test", resp.Message)
+
+	assert.NoError(t, cc.Close())
+	err = cc.WaitForReady(ctx)
+	assert.True(t, errors.Is(err, grpc.ErrClientConnClosing))
+}
+
+func TestMonitoredConnReportsTransportFailures(t *testing.T) {
+	var mu sync.Mutex
+	var changes []StateChange
+	provider := metrics.NewMemory()
+	builder := &GrpcConnBuilder{}
+	builder.WithInsecure()
+	builder.WithContextDialer(func(ctx context.Context, addr string) (net.Conn, error) {
+		return nil, errors.New("connection refused by test")
+	})
+	cc, err := builder.GetMonitoredConn("localhost:50051",
+		WithMonitorLogger(logging.Nop()),
+		WithMonitorMetrics(provider),
+		WithStateListener(func(change StateChange) {
+			mu.Lock()
+			defer mu.Unlock()
+			changes = append(changes, change)
+		}),
+	)
+	assert.NoError(t, err)
+	defer cc.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	err = cc.WaitForReady(ctx)
+	assert.True(t, errors.Is(err, context.DeadlineExceeded))
+	assert.Contains(t, err.Error(), "connection refused by test")
+	var notReady *NotReadyError
+	assert.True(t, errors.As(err, &notReady))
+	assert.Equal(t, "localhost:50051", notReady.Target)
+
+	mu.Lock()
+	defer mu.Unlock()
+	var failure *StateChange
+	for i := range changes {
+		if changes[i].To == connectivity.TransientFailure {
+			failure = &changes[i]
+			break
+		}
+	}
+	if assert.NotNil(t, failure) {
+		assert.Contains(t, failure.Err.Error(), "connection refused by test")
+	}
+	assert.True(t, provider.Value(ConnStateChangesMetric, "target", "localhost:50051", "state", "TRANSIENT_FAILURE") >= 1)
+}
+
+func TestMonitoredConnUnsubscribe(t *testing.T) {
+	startServer()
+	defer server.Cleanup()
+	builder := &GrpcConnBuilder{}
+	builder.WithInsecure()
+	builder.WithContextDialer(gtest.GetBufDialer(server.GetListener()))
+	cc, err := builder.GetMonitoredConn("localhost:50051", WithMonitorLogger(logging.Nop()))
+	assert.NoError(t, err)
+
+	var mu sync.Mutex
+	calls := 0
+	unsubscribe := cc.Subscribe(func(change StateChange) {
+		mu.Lock()
+		defer mu.Unlock()
+		calls++
+	})
+	unsubscribe()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	assert.NoError(t, cc.WaitForReady(ctx))
+	assert.NoError(t, cc.Close())
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, 0, calls)
+}
+
+func TestMonitoredConnRecordsDefaultDialerFailures(t *testing.T) {
+	builder := &GrpcConnBuilder{}
+	builder.WithInsecure()
+	cc, err := builder.GetMonitoredConn("127.0.0.1:1", WithMonitorLogger(logging.Nop()))
+	assert.NoError(t, err)
+	defer cc.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	err = cc.WaitForReady(ctx)
+	var notReady *NotReadyError
+	if assert.True(t, errors.As(err, &notReady)) && assert.Error(t, notReady.LastErr) {
+		var opErr *net.OpError
+		assert.True(t, errors.As(notReady.LastErr, &opErr))
+		assert.Contains(t, notReady.LastErr.Error(), "connection refused")
+		assert.Contains(t, err.Error(), "connection refused")
+	}
+}
@@ -0,0 +1,49 @@
+package clientinterceptor
+
+import (
+	"context"
+	"github.com/apssouza22/grpc-production-go/baggage"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+//UnaryPropagateBaggage sends the context bag (see baggage.FromContext) to the downstream call
+// A baggage header already set in the outgoing metadata is kept
+func UnaryPropagateBaggage() grpc.UnaryClientInterceptor {
+	return func(
+		ctx context.Context,
+		method string,
+		req interface{},
+		reply interface{},
+		cc *grpc.ClientConn,
+		invoker grpc.UnaryInvoker,
+		opts ...grpc.CallOption,
+	) error {
+		return invoker(withOutgoingBaggage(ctx), method, req, reply, cc, opts...)
+	}
+}
+
+//StreamPropagateBaggage sends the context bag (see baggage.FromContext) to the downstream stream
+// A baggage header already set in the outgoing metadata is kept
+func StreamPropagateBaggage() grpc.StreamClientInterceptor {
+	return func(
+		ctx context.Context,
+		desc *grpc.StreamDesc,
+		cc *grpc.ClientConn,
+		method string,
+		streamer grpc.Streamer,
+		opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		return streamer(withOutgoingBaggage(ctx), desc, cc, method, opts...)
+	}
+}
+
+func withOutgoingBaggage(ctx context.Context) context.Context {
+	bag := baggage.FromContext(ctx)
+	if bag.Len() == 0 {
+		return ctx
+	}
+	if md, ok := metadata.FromOutgoingContext(ctx); ok && len(md.Get(baggage.Header)) > 0 {
+		return ctx
+	}
+	return metadata.AppendToOutgoingContext(ctx, baggage.Header, bag.Encode())
+}
@@ -0,0 +1,37 @@
+package clientinterceptor
+
+import (
+	"context"
+	"github.com/apssouza22/grpc-production-go/baggage"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"testing"
+)
+
+func TestUnaryPropagateBaggage(t *testing.T) {
+	interceptor := UnaryPropagateBaggage()
+	var forwarded []string
+	rpc := func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+		md, _ := metadata.FromOutgoingContext(ctx)
+		forwarded = md.Get(baggage.Header)
+		return nil
+	}
+	interceptor(context.Background(), "test", "req", "reply", nil, rpc)
+	assert.Empty(t, forwarded)
+
+	ctx := baggage.WithLocale(baggage.WithTenant(context.Background(), "acme"), "en")
+	interceptor(ctx, "test", "req", "reply", nil, rpc)
+	assert.Equal(t, []string{"locale=en,tenant-id=acme"}, forwarded)
+}
+
+func TestStreamPropagateBaggage(t *testing.T) {
+	interceptor := StreamPropagateBaggage()
+	ctx := baggage.WithTenant(context.Background(), "acme")
+	rpc := func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		md, _ := metadata.FromOutgoingContext(ctx)
+		assert.Equal(t, []string{"tenant-id=acme"}, md.Get(baggage.Header))
+		return nil, nil
+	}
+	interceptor(ctx, &grpc.StreamDesc{StreamName: "test"}, nil, "test", rpc)
+}
@@ -0,0 +1,372 @@
+package clientinterceptor
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"github.com/apssouza22/grpc-production-go/internal/glob"
+	"github.com/golang/protobuf/proto"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CredentialHeaders are the outgoing metadata keys carrying credentials. The calls and responses shared between
+// callers are always told apart on them. The calls with a grpc.PerRPCCredentials call option are never shared,
+// their credentials are only known once sent
+var CredentialHeaders = []string{"authorization", "proxy-authorization", "cookie", "user", "pass", "password", "x-api-key"}
+
+// CoalescingOption configures the coalescing interceptor
+type CoalescingOption func(*coalescingConfig)
+
+type coalescingConfig struct {
+	methods      []string
+	metadataKeys []string
+}
+
+// WithCoalescedMethods enables the coalescing of the methods matching the globs, e.g. "/config.Config/Get*".
+// No method is coalesced otherwise
+func WithCoalescedMethods(globs ...string) CoalescingOption {
+	return func(c *coalescingConfig) {
+		c.methods = append(c.methods, globs...)
+	}
+}
+
+// WithCoalescingMetadata adds the outgoing metadata keys telling apart two calls, e.g. the tenant.
+// Only the CredentialHeaders are used otherwise, the other keys such as the request id or the tracing headers
+// do not prevent the coalescing
+func WithCoalescingMetadata(keys ...string) CoalescingOption {
+	return func(c *coalescingConfig) {
+		c.metadataKeys = append(c.metadataKeys, lowerAll(keys)...)
+	}
+}
+
+// coalescer tracks the calls in flight
+type coalescer struct {
+	cfg   *coalescingConfig
+	mu    sync.Mutex
+	calls map[string]*coalescedCall
+}
+
+// coalescedCall is the single RPC shared by the identical calls
+type coalescedCall struct {
+	done    chan struct{}
+	cancel  context.CancelFunc
+	waiters int
+	// deadlines are the deadlines of the waiters, unbounded counts the waiters without deadline
+	deadlines []time.Time
+	unbounded int
+	// deadline is the deadline of the shared RPC, the one of the caller starting it. The later callers start a new call.
+	// Zero when none
+	deadline time.Time
+	// timer cancels the call at the latest deadline of its waiters, expired is set once it did
+	timer   *time.Timer
+	expired bool
+	reply   proto.Message
+	header  metadata.MD
+	trailer metadata.MD
+	err     error
+}
+
+// UnaryCoalescing coalesces the identical unary calls in flight (same method, request, credentials and metadata
+// selected by WithCoalescingMetadata) into a single RPC whose reply is fanned out to every caller.
+// The calls with a grpc.PerRPCCredentials call option are not coalesced.
+// The shared RPC carries the outgoing metadata of the first caller.
+// Each caller observes its own deadline and cancellation. The shared RPC is sent with the deadline of the caller
+// starting it, and canceled earlier once every caller gave up or is past its deadline. A caller with a later deadline
+// makes a new call when the shared RPC runs out of time, and so do the callers coming after that deadline,
+// so a hanging RPC is not kept alive by the traffic
+func UnaryCoalescing(opts ...CoalescingOption) grpc.UnaryClientInterceptor {
+	cfg := &coalescingConfig{metadataKeys: append([]string{}, CredentialHeaders...)}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	c := &coalescer{cfg: cfg, calls: make(map[string]*coalescedCall)}
+	return func(
+		ctx context.Context,
+		method string,
+		req interface{},
+		reply interface{},
+		cc *grpc.ClientConn,
+		invoker grpc.UnaryInvoker,
+		opts ...grpc.CallOption,
+	) error {
+		if !glob.MatchAny(cfg.methods, method) || hasPerRPCCredentials(opts) {
+			return invoker(ctx, method, req, reply, cc, opts...)
+		}
+		reqMsg, ok := req.(proto.Message)
+		if !ok {
+			return invoker(ctx, method, req, reply, cc, opts...)
+		}
+		replyMsg, ok := reply.(proto.Message)
+		if !ok {
+			return invoker(ctx, method, req, reply, cc, opts...)
+		}
+		key, err := c.key(ctx, method, reqMsg)
+		if err != nil {
+			return invoker(ctx, method, req, reply, cc, opts...)
+		}
+		return c.invoke(ctx, key, method, reqMsg, replyMsg, cc, invoker, opts)
+	}
+}
+
+func (c *coalescer) key(ctx context.Context, method string, req proto.Message) (string, error) {
+	var buf proto.Buffer
+	buf.SetDeterministic(true)
+	if err := buf.Marshal(req); err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(buf.Bytes())
+
+	md, _ := metadata.FromOutgoingContext(ctx)
+	keys := append([]string{}, c.cfg.metadataKeys...)
+	sort.Strings(keys)
+	parts := []string{method, hex.EncodeToString(sum[:])}
+	for _, key := range keys {
+		for _, value := range md.Get(key) {
+			parts = append(parts, key+"="+value)
+		}
+	}
+	return strings.Join(parts, "\x00"), nil
+}
+
+func (c *coalescer) invoke(
+	ctx context.Context,
+	key string,
+	method string,
+	req proto.Message,
+	reply proto.Message,
+	cc *grpc.ClientConn,
+	invoker grpc.UnaryInvoker,
+	opts []grpc.CallOption,
+) error {
+	call := c.await(ctx, key, method, req, reply, cc, invoker, opts)
+	for call.outlived(ctx) {
+		call = c.await(ctx, key, method, req, reply, cc, invoker, opts)
+	}
+	if call == nil {
+		return status.FromContextError(ctx.Err()).Err()
+	}
+	fillHeaderTrailerOptions(opts, call.header, call.trailer)
+	if call.err != nil {
+		return call.err
+	}
+	reply.Reset()
+	proto.Merge(reply, call.reply)
+	return nil
+}
+
+// await joins the call in flight for the key, starting it when there is none, and waits for it.
+// It returns nil when the context is done first
+func (c *coalescer) await(
+	ctx context.Context,
+	key string,
+	method string,
+	req proto.Message,
+	reply proto.Message,
+	cc *grpc.ClientConn,
+	invoker grpc.UnaryInvoker,
+	opts []grpc.CallOption,
+) *coalescedCall {
+	c.mu.Lock()
+	call, ok := c.calls[key]
+	if ok && !call.deadline.IsZero() && !time.Now().Before(call.deadline) {
+		ok = false
+	}
+	if !ok {
+		call = &coalescedCall{
+			done:  make(chan struct{}),
+			reply: reflect.New(reflect.TypeOf(reply).Elem()).Interface().(proto.Message),
+		}
+		callCtx, cancel := context.WithCancel(detachedContext{ctx})
+		if deadline, ok := ctx.Deadline(); ok {
+			call.deadline = deadline
+			callCtx, cancel = context.WithDeadline(detachedContext{ctx}, deadline)
+		}
+		call.cancel = cancel
+		c.calls[key] = call
+		go c.run(callCtx, key, call, method, proto.Clone(req), cc, invoker, sharedCallOptions(opts, call))
+	}
+	c.join(key, call, ctx)
+	c.mu.Unlock()
+
+	select {
+	case <-call.done:
+		c.leave(key, call, ctx)
+		return call
+	case <-ctx.Done():
+		c.leave(key, call, ctx)
+		return nil
+	}
+}
+
+// outlived checks whether the finished call ran out of time before the deadline of the caller, which makes a new call
+func (call *coalescedCall) outlived(ctx context.Context) bool {
+	if call == nil || call.deadline.IsZero() || ctx.Err() != nil || status.Code(call.err) != codes.DeadlineExceeded {
+		return false
+	}
+	deadline, ok := ctx.Deadline()
+	return !ok || deadline.After(call.deadline)
+}
+
+func (c *coalescer) run(
+	ctx context.Context,
+	key string,
+	call *coalescedCall,
+	method string,
+	req proto.Message,
+	cc *grpc.ClientConn,
+	invoker grpc.UnaryInvoker,
+	opts []grpc.CallOption,
+) {
+	err := invoker(ctx, method, req, call.reply, cc, opts...)
+	c.mu.Lock()
+	if c.calls[key] == call {
+		delete(c.calls, key)
+	}
+	if call.timer != nil {
+		call.timer.Stop()
+	}
+	if call.expired && err != nil {
+		err = status.FromContextError(context.DeadlineExceeded).Err()
+	}
+	// Closed while holding the lock, so the waiters leaving afterwards see the call finished
+	call.err = err
+	close(call.done)
+	c.mu.Unlock()
+	call.cancel()
+}
+
+// join registers a caller, extending the deadline of the shared RPC to the caller's one. c.mu must be held
+func (c *coalescer) join(key string, call *coalescedCall, ctx context.Context) {
+	call.waiters++
+	if deadline, ok := ctx.Deadline(); ok {
+		call.deadlines = append(call.deadlines, deadline)
+	} else {
+		call.unbounded++
+	}
+	c.schedule(key, call)
+}
+
+// leave unregisters a caller, canceling the shared RPC when nobody waits for it anymore
+func (c *coalescer) leave(key string, call *coalescedCall, ctx context.Context) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	select {
+	case <-call.done:
+		return
+	default:
+	}
+	call.waiters--
+	if deadline, ok := ctx.Deadline(); ok {
+		for i, d := range call.deadlines {
+			if d.Equal(deadline) {
+				call.deadlines = append(call.deadlines[:i], call.deadlines[i+1:]...)
+				break
+			}
+		}
+	} else {
+		call.unbounded--
+	}
+	if call.waiters > 0 {
+		c.schedule(key, call)
+		return
+	}
+	if c.calls[key] == call {
+		delete(c.calls, key)
+	}
+	call.cancel()
+}
+
+// schedule cancels the shared RPC at the latest deadline of its waiters, before its own deadline once the caller
+// starting it left. It runs until its own deadline while one of them has no deadline. c.mu must be held
+func (c *coalescer) schedule(key string, call *coalescedCall) {
+	if call.unbounded > 0 || len(call.deadlines) == 0 {
+		if call.timer != nil {
+			call.timer.Stop()
+		}
+		return
+	}
+	latest := call.deadlines[0]
+	for _, deadline := range call.deadlines[1:] {
+		if deadline.After(latest) {
+			latest = deadline
+		}
+	}
+	if call.timer == nil {
+		call.timer = time.AfterFunc(time.Until(latest), func() {
+			c.expire(key, call)
+		})
+		return
+	}
+	call.timer.Reset(time.Until(latest))
+}
+
+// expire cancels the shared RPC whose waiters are all past their deadline
+func (c *coalescer) expire(key string, call *coalescedCall) {
+	c.mu.Lock()
+	if c.calls[key] == call {
+		delete(c.calls, key)
+	}
+	call.expired = true
+	c.mu.Unlock()
+	call.cancel()
+}
+
+// sharedCallOptions replaces the header and trailer options of the first caller by the ones of the shared call
+func sharedCallOptions(opts []grpc.CallOption, call *coalescedCall) []grpc.CallOption {
+	return append(withoutHeaderTrailerOptions(opts), grpc.Header(&call.header), grpc.Trailer(&call.trailer))
+}
+
+// withoutHeaderTrailerOptions returns a copy of the options without the header and trailer ones,
+// for calls whose result is delivered to other callers
+func withoutHeaderTrailerOptions(opts []grpc.CallOption) []grpc.CallOption {
+	filtered := make([]grpc.CallOption, 0, len(opts)+2)
+	for _, opt := range opts {
+		switch opt.(type) {
+		case grpc.HeaderCallOption, grpc.TrailerCallOption:
+			continue
+		}
+		filtered = append(filtered, opt)
+	}
+	return filtered
+}
+
+// hasPerRPCCredentials checks whether the call carries its own credentials, which are not part of the outgoing metadata
+func hasPerRPCCredentials(opts []grpc.CallOption) bool {
+	for _, opt := range opts {
+		if _, ok := opt.(grpc.PerRPCCredsCallOption); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// fillHeaderTrailerOptions copies the header and trailer into the header and trailer options of a caller
+func fillHeaderTrailerOptions(opts []grpc.CallOption, header metadata.MD, trailer metadata.MD) {
+	for _, opt := range opts {
+		switch o := opt.(type) {
+		case grpc.HeaderCallOption:
+			*o.HeaderAddr = header.Copy()
+		case grpc.TrailerCallOption:
+			*o.TrailerAddr = trailer.Copy()
+		}
+	}
+}
+
+// detachedContext keeps the values (outgoing metadata, tracing span, ...) of the first caller
+// without its deadline and cancellation
+type detachedContext struct {
+	parent context.Context
+}
+
+func (detachedContext) Deadline() (time.Time, bool)         { return time.Time{}, false }
+func (detachedContext) Done() <-chan struct{}               { return nil }
+func (detachedContext) Err() error                          { return nil }
+func (d detachedContext) Value(key interface{}) interface{} { return d.parent.Value(key) }
@@ -0,0 +1,267 @@
+package clientinterceptor
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/examples/helloworld/helloworld"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// blockingInvoker replies once released, counting the RPCs
+type blockingInvoker struct {
+	calls   int32
+	release chan struct{}
+	ctxErr  chan error
+}
+
+func newBlockingInvoker() *blockingInvoker {
+	return &blockingInvoker{release: make(chan struct{}), ctxErr: make(chan error, 1)}
+}
+
+func (i *blockingInvoker) invoke(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+	atomic.AddInt32(&i.calls, 1)
+	select {
+	case <-i.release:
+	case <-ctx.Done():
+		i.ctxErr <- ctx.Err()
+		return status.FromContextError(ctx.Err()).Err()
+	}
+	for _, opt := range opts {
+		if header, ok := opt.(grpc.HeaderCallOption); ok {
+			*header.HeaderAddr = metadata.Pairs("served-by", "backend-1")
+		}
+	}
+	reply.(*helloworld.HelloReply).Message = "hello " + req.(*helloworld.HelloRequest).Name
+	return nil
+}
+
+func TestUnaryCoalescing(t *testing.T) {
+	interceptor := UnaryCoalescing(WithCoalescedMethods("/greeter/*"))
+	invoker := newBlockingInvoker()
+
+	var wg sync.WaitGroup
+	replies := make([]*helloworld.HelloReply, 10)
+	headers := make([]metadata.MD, 10)
+	for i := range replies {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			replies[i] = &helloworld.HelloReply{}
+			err := interceptor(context.Background(), "/greeter/SayHello", &helloworld.HelloRequest{Name: "alice"}, replies[i], nil, invoker.invoke, grpc.Header(&headers[i]))
+			assert.NoError(t, err)
+		}(i)
+	}
+	time.Sleep(20 * time.Millisecond)
+	close(invoker.release)
+	wg.Wait()
+
+	assert.Equal(t, int32(1), atomic.LoadInt32(&invoker.calls))
+	for i := range replies {
+		assert.Equal(t, "hello alice", replies[i].Message)
+		assert.Equal(t, []string{"backend-1"}, headers[i].Get("served-by"))
+	}
+}
+
+func TestUnaryCoalescingKeepsDistinctCallsApart(t *testing.T) {
+	interceptor := UnaryCoalescing(WithCoalescedMethods("/greeter/*"))
+	invoker := newBlockingInvoker()
+	close(invoker.release)
+
+	call := func(ctx context.Context, method string, name string) {
+		interceptor(ctx, method, &helloworld.HelloRequest{Name: name}, &helloworld.HelloReply{}, nil, invoker.invoke)
+	}
+	call(context.Background(), "/greeter/SayHello", "alice")
+	call(context.Background(), "/greeter/SayHello", "alice")
+	call(context.Background(), "/greeter/SayHello", "bob")
+	call(metadata.AppendToOutgoingContext(context.Background(), "authorization", "token"), "/greeter/SayHello", "alice")
+	call(metadata.AppendToOutgoingContext(context.Background(), "user", "alice", "pass", "secret"), "/greeter/SayHello", "alice")
+	call(context.Background(), "/other/SayHello", "alice")
+	assert.Equal(t, int32(6), atomic.LoadInt32(&invoker.calls))
+}
+
+// tokenCredentials sends the token as authorization metadata
+type tokenCredentials string
+
+func (c tokenCredentials) GetRequestMetadata(ctx context.Context, uri ...string) (map[string]string, error) {
+	return map[string]string{"authorization": "Bearer " + string(c)}, nil
+}
+
+func (c tokenCredentials) RequireTransportSecurity() bool {
+	return false
+}
+
+func TestUnaryCoalescingSkipsPerRPCCredentials(t *testing.T) {
+	interceptor := UnaryCoalescing(WithCoalescedMethods("/greeter/*"))
+	invoker := newBlockingInvoker()
+
+	var wg sync.WaitGroup
+	for _, token := range []string{"alice", "bob"} {
+		wg.Add(1)
+		go func(token string) {
+			defer wg.Done()
+			interceptor(context.Background(), "/greeter/SayHello", &helloworld.HelloRequest{Name: "alice"}, &helloworld.HelloReply{}, nil, invoker.invoke, grpc.PerRPCCredentials(tokenCredentials(token)))
+		}(token)
+	}
+	time.Sleep(20 * time.Millisecond)
+	close(invoker.release)
+	wg.Wait()
+	assert.Equal(t, int32(2), atomic.LoadInt32(&invoker.calls))
+}
+
+func TestUnaryCoalescingIgnoresOtherMetadata(t *testing.T) {
+	interceptor := UnaryCoalescing(WithCoalescedMethods("/greeter/*"))
+	invoker := newBlockingInvoker()
+
+	var wg sync.WaitGroup
+	for _, requestID := range []string{"r1", "r2"} {
+		wg.Add(1)
+		go func(requestID string) {
+			defer wg.Done()
+			ctx := metadata.AppendToOutgoingContext(context.Background(), "user", "alice", "x-request-id", requestID)
+			interceptor(ctx, "/greeter/SayHello", &helloworld.HelloRequest{Name: "alice"}, &helloworld.HelloReply{}, nil, invoker.invoke)
+		}(requestID)
+	}
+	time.Sleep(20 * time.Millisecond)
+	close(invoker.release)
+	wg.Wait()
+	assert.Equal(t, int32(1), atomic.LoadInt32(&invoker.calls))
+}
+
+func TestUnaryCoalescingSelectedMetadata(t *testing.T) {
+	interceptor := UnaryCoalescing(WithCoalescedMethods("/greeter/*"), WithCoalescingMetadata("Tenant"))
+	invoker := newBlockingInvoker()
+
+	var wg sync.WaitGroup
+	for _, requestID := range []string{"r1", "r2"} {
+		wg.Add(1)
+		go func(requestID string) {
+			defer wg.Done()
+			ctx := metadata.AppendToOutgoingContext(context.Background(), "tenant", "acme", "x-request-id", requestID)
+			interceptor(ctx, "/greeter/SayHello", &helloworld.HelloRequest{Name: "alice"}, &helloworld.HelloReply{}, nil, invoker.invoke)
+		}(requestID)
+	}
+	time.Sleep(20 * time.Millisecond)
+	close(invoker.release)
+	wg.Wait()
+	assert.Equal(t, int32(1), atomic.LoadInt32(&invoker.calls))
+}
+
+func TestUnaryCoalescingWaiterDeadlines(t *testing.T) {
+	interceptor := UnaryCoalescing(WithCoalescedMethods("/greeter/*"))
+	invoker := newBlockingInvoker()
+
+	long, cancelLong := context.WithTimeout(context.Background(), time.Second)
+	defer cancelLong()
+	longErr := make(chan error, 1)
+	reply := &helloworld.HelloReply{}
+	go func() {
+		longErr <- interceptor(long, "/greeter/SayHello", &helloworld.HelloRequest{Name: "alice"}, reply, nil, invoker.invoke)
+	}()
+	time.Sleep(5 * time.Millisecond)
+	short, cancelShort := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancelShort()
+	shortErr := interceptor(short, "/greeter/SayHello", &helloworld.HelloRequest{Name: "alice"}, &helloworld.HelloReply{}, nil, invoker.invoke)
+
+	assert.Equal(t, codes.DeadlineExceeded, status.Code(shortErr))
+	close(invoker.release)
+	assert.NoError(t, <-longErr)
+	assert.Equal(t, "hello alice", reply.Message)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&invoker.calls))
+}
+
+func TestUnaryCoalescingSendsTheDeadline(t *testing.T) {
+	interceptor := UnaryCoalescing(WithCoalescedMethods("/greeter/*"))
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	want, _ := ctx.Deadline()
+	var got time.Time
+	var ok bool
+	err := interceptor(ctx, "/greeter/SayHello", &helloworld.HelloRequest{Name: "alice"}, &helloworld.HelloReply{}, nil,
+		func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+			got, ok = ctx.Deadline()
+			return nil
+		})
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, want, got)
+}
+
+func TestUnaryCoalescingLaterDeadlineMakesANewCall(t *testing.T) {
+	interceptor := UnaryCoalescing(WithCoalescedMethods("/greeter/*"))
+	invoker := newBlockingInvoker()
+
+	short, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	shortErr := make(chan error, 1)
+	go func() {
+		shortErr <- interceptor(short, "/greeter/SayHello", &helloworld.HelloRequest{Name: "alice"}, &helloworld.HelloReply{}, nil, invoker.invoke)
+	}()
+	time.Sleep(5 * time.Millisecond)
+	longErr := make(chan error, 1)
+	reply := &helloworld.HelloReply{}
+	go func() {
+		longErr <- interceptor(context.Background(), "/greeter/SayHello", &helloworld.HelloRequest{Name: "alice"}, reply, nil, invoker.invoke)
+	}()
+
+	assert.Equal(t, codes.DeadlineExceeded, status.Code(<-shortErr))
+	assert.Equal(t, context.DeadlineExceeded, <-invoker.ctxErr)
+	close(invoker.release)
+	assert.NoError(t, <-longErr)
+	assert.Equal(t, "hello alice", reply.Message)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&invoker.calls))
+}
+
+func TestUnaryCoalescingCancelsWhenEveryWaiterLeft(t *testing.T) {
+	interceptor := UnaryCoalescing(WithCoalescedMethods("/greeter/*"))
+	invoker := newBlockingInvoker()
+	defer close(invoker.release)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- interceptor(ctx, "/greeter/SayHello", &helloworld.HelloRequest{Name: "alice"}, &helloworld.HelloReply{}, nil, invoker.invoke)
+	}()
+	time.Sleep(5 * time.Millisecond)
+	cancel()
+	assert.Equal(t, codes.Canceled, status.Code(<-done))
+	assert.Equal(t, context.Canceled, <-invoker.ctxErr)
+}
+
+func TestUnaryCoalescingBoundsHangingCalls(t *testing.T) {
+	interceptor := UnaryCoalescing(WithCoalescedMethods("/greeter/*"))
+	var calls, canceled int32
+	hanging := func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+		atomic.AddInt32(&calls, 1)
+		<-ctx.Done()
+		atomic.AddInt32(&canceled, 1)
+		return status.FromContextError(ctx.Err()).Err()
+	}
+
+	// Overlapping waiters keep the key busy for longer than any of their deadlines
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(context.Background(), 30*time.Millisecond)
+			defer cancel()
+			err := interceptor(ctx, "/greeter/SayHello", &helloworld.HelloRequest{Name: "alice"}, &helloworld.HelloReply{}, nil, hanging)
+			assert.Equal(t, codes.DeadlineExceeded, status.Code(err))
+		}()
+		time.Sleep(10 * time.Millisecond)
+	}
+	wg.Wait()
+
+	assert.Eventually(t, func() bool {
+		return atomic.LoadInt32(&canceled) == atomic.LoadInt32(&calls)
+	}, time.Second, 5*time.Millisecond)
+	assert.True(t, atomic.LoadInt32(&calls) > 1)
+	assert.True(t, atomic.LoadInt32(&calls) < 20)
+}
@@ -0,0 +1,62 @@
+package clientinterceptor
+
+import (
+	"context"
+	"github.com/apssouza22/grpc-production-go/grpcerrors"
+	"google.golang.org/grpc"
+)
+
+//UnaryDecodeErrors converts the status errors returned by the call into *grpcerrors.Error with their details decoded,
+// so callers can use errors.Is against grpcerrors sentinels
+func UnaryDecodeErrors() grpc.UnaryClientInterceptor {
+	return func(
+		ctx context.Context,
+		method string,
+		req interface{},
+		reply interface{},
+		cc *grpc.ClientConn,
+		invoker grpc.UnaryInvoker,
+		opts ...grpc.CallOption,
+	) error {
+		return decodeError(invoker(ctx, method, req, reply, cc, opts...))
+	}
+}
+
+//StreamDecodeErrors converts the status errors returned by the stream into *grpcerrors.Error with their details decoded
+func StreamDecodeErrors() grpc.StreamClientInterceptor {
+	return func(
+		ctx context.Context,
+		desc *grpc.StreamDesc,
+		cc *grpc.ClientConn,
+		method string,
+		streamer grpc.Streamer,
+		opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		stream, err := streamer(ctx, desc, cc, method, opts...)
+		if err != nil {
+			return nil, decodeError(err)
+		}
+		return &decodingClientStream{ClientStream: stream}, nil
+	}
+}
+
+// decodingClientStream decodes the errors returned by the stream
+type decodingClientStream struct {
+	grpc.ClientStream
+}
+
+// SendMsg decodes the error of the sent message
+func (s *decodingClientStream) SendMsg(m interface{}) error {
+	return decodeError(s.ClientStream.SendMsg(m))
+}
+
+// RecvMsg decodes the error of the received message, io.EOF is returned untouched
+func (s *decodingClientStream) RecvMsg(m interface{}) error {
+	return decodeError(s.ClientStream.RecvMsg(m))
+}
+
+func decodeError(err error) error {
+	if decoded, ok := grpcerrors.FromError(err); ok {
+		return decoded
+	}
+	return err
+}
@@ -0,0 +1,29 @@
+package clientinterceptor
+
+import (
+	"context"
+	"errors"
+	"github.com/apssouza22/grpc-production-go/grpcerrors"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"testing"
+)
+
+func TestUnaryDecodeErrors(t *testing.T) {
+	interceptor := UnaryDecodeErrors()
+	sts, _ := status.New(codes.NotFound, "user not found").WithDetails(&errdetails.ErrorInfo{Reason: "USER_NOT_FOUND"})
+	rpc := func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+		return sts.Err()
+	}
+	err := interceptor(context.Background(), "test", "req", "reply", nil, rpc)
+	assert.True(t, errors.Is(err, &grpcerrors.Error{Reason: "USER_NOT_FOUND"}))
+	assert.Equal(t, codes.NotFound, status.Code(err))
+
+	rpc = func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+		return nil
+	}
+	assert.NoError(t, interceptor(context.Background(), "test", "req", "reply", nil, rpc))
+}
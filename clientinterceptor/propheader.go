@@ -2,14 +2,141 @@ package clientinterceptor
 
 import (
 	"context"
+	"fmt"
+	"github.com/apssouza22/grpc-production-go/internal/glob"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/metadata"
+	"sort"
 	"strings"
 )
 
+// DefaultDeniedHeaders are never propagated unless DisableDefaultDeny is set.
+// They hold credentials or are transport headers owned by the gRPC runtime
+var DefaultDeniedHeaders = []string{
+	":*",
+	"authorization",
+	"proxy-authorization",
+	"cookie",
+	"set-cookie",
+	"user",
+	"pass",
+	"password",
+	"x-api-key",
+	"content-type",
+	"content-length",
+	"user-agent",
+	"te",
+	"host",
+	"connection",
+	"keep-alive",
+	"transfer-encoding",
+	"upgrade",
+	"grpc-*",
+}
+
+// HeaderPropagationConfig selects and transforms the incoming metadata copied into the outgoing calls.
+// Keys are matched in lower case, the deny lists always win over the allow lists
+type HeaderPropagationConfig struct {
+	// Allow are globs of the keys to propagate. Empty allows every key not denied
+	Allow []string
+	// AllowPrefixes propagates the keys starting with any of the prefixes, in addition to Allow
+	AllowPrefixes []string
+	// Deny are globs of the keys never propagated, in addition to DefaultDeniedHeaders
+	Deny []string
+	// DisableDefaultDeny stops denying DefaultDeniedHeaders
+	DisableDefaultDeny bool
+	// Rename maps incoming keys to the key used in the outgoing metadata. Two keys cannot be renamed to the same key,
+	// and a key cannot be renamed to a key propagated as is: deny the target or rename it too
+	Rename map[string]string
+	// Transform maps incoming keys to a function transforming their values. Returning false drops the value
+	Transform map[string]func(value string) (string, bool)
+	// MaxBytes caps the total size of the propagated keys and values. Zero means no limit
+	MaxBytes int
+}
+
+type headerPropagator struct {
+	allow         []string
+	allowPrefixes []string
+	deny          []string
+	rename        map[string]string
+	transform     map[string]func(value string) (string, bool)
+	maxBytes      int
+}
+
+// Validate checks that the renames do not collide, which would propagate the values of several keys under the same key
+func (c HeaderPropagationConfig) Validate() error {
+	_, err := newHeaderPropagator(c)
+	return err
+}
+
+func newHeaderPropagator(config HeaderPropagationConfig) (*headerPropagator, error) {
+	p := &headerPropagator{
+		allow:         lowerAll(config.Allow),
+		allowPrefixes: lowerAll(config.AllowPrefixes),
+		deny:          lowerAll(config.Deny),
+		rename:        make(map[string]string, len(config.Rename)),
+		transform:     make(map[string]func(value string) (string, bool), len(config.Transform)),
+		maxBytes:      config.MaxBytes,
+	}
+	if !config.DisableDefaultDeny {
+		p.deny = append(p.deny, DefaultDeniedHeaders...)
+	}
+	sources := make(map[string]string, len(config.Rename))
+	for from, to := range config.Rename {
+		from, to = strings.ToLower(from), strings.ToLower(to)
+		if _, ok := p.rename[from]; ok {
+			return nil, fmt.Errorf("header %q renamed twice", from)
+		}
+		if source, ok := sources[to]; ok {
+			return nil, fmt.Errorf("headers %q and %q both renamed to %q", source, from, to)
+		}
+		p.rename[from] = to
+		sources[to] = from
+	}
+	for to, from := range sources {
+		if _, renamed := p.rename[to]; !renamed && p.selected(to) {
+			return nil, fmt.Errorf("header %q renamed to %q, which is propagated as is", from, to)
+		}
+	}
+	for key, fn := range config.Transform {
+		p.transform[strings.ToLower(key)] = fn
+	}
+	return p, nil
+}
+
+// mustHeaderPropagator panics on an invalid config, see HeaderPropagationConfig.Validate
+func mustHeaderPropagator(config HeaderPropagationConfig) *headerPropagator {
+	p, err := newHeaderPropagator(config)
+	if err != nil {
+		panic("clientinterceptor: invalid header propagation config: " + err.Error())
+	}
+	return p
+}
+
 //UnaryPropagateHeaderInterceptor copy given fields from Incoming request into Outgoing request
-// Empty array will make the interceptor copy all metadata in the context
+// Empty array will make the interceptor copy all metadata in the context, except DefaultDeniedHeaders.
+// The given fields are copied even when denied by default, e.g. authorization
 func UnaryPropagateHeaderInterceptor(fields []string) grpc.UnaryClientInterceptor {
+	return UnaryPropagateHeaderInterceptorWithConfig(legacyPropagationConfig(fields))
+}
+
+//StreamPropagateHeaderInterceptor copy given fields from Incoming request into Outgoing request
+// Empty array will make the interceptor copy all metadata in the context, except DefaultDeniedHeaders.
+// The given fields are copied even when denied by default, e.g. authorization
+func StreamPropagateHeaderInterceptor(fields []string) grpc.StreamClientInterceptor {
+	return StreamPropagateHeaderInterceptorWithConfig(legacyPropagationConfig(fields))
+}
+
+// legacyPropagationConfig only denies DefaultDeniedHeaders when every key is copied,
+// the fields listed explicitly are propagated as they were before the deny list existed
+func legacyPropagationConfig(fields []string) HeaderPropagationConfig {
+	return HeaderPropagationConfig{Allow: fields, DisableDefaultDeny: len(fields) > 0}
+}
+
+//UnaryPropagateHeaderInterceptorWithConfig copy the Incoming metadata selected by the config into Outgoing request.
+// It panics when the config is invalid, see HeaderPropagationConfig.Validate
+func UnaryPropagateHeaderInterceptorWithConfig(config HeaderPropagationConfig) grpc.UnaryClientInterceptor {
+	propagator := mustHeaderPropagator(config)
 	return func(
 		ctx context.Context,
 		method string,
@@ -19,19 +146,15 @@ func UnaryPropagateHeaderInterceptor(fields []string) grpc.UnaryClientIntercepto
 		invoker grpc.UnaryInvoker,
 		opts ...grpc.CallOption,
 	) error {
-		md, ok := metadata.FromIncomingContext(ctx)
-		if ok {
-			pairs := transformMapToPairs(md, fields)
-			ctx = metadata.AppendToOutgoingContext(ctx, pairs...)
-		}
-		err := invoker(ctx, method, req, reply, cc, opts...)
+		err := invoker(propagator.outgoingContext(ctx), method, req, reply, cc, opts...)
 		return err
 	}
 }
 
-//StreamPropagateHeaderInterceptor copy given fields from Incoming request into Outgoing request
-// Empty array will make the interceptor copy all metadata in the context
-func StreamPropagateHeaderInterceptor(fields []string) grpc.StreamClientInterceptor {
+//StreamPropagateHeaderInterceptorWithConfig copy the Incoming metadata selected by the config into Outgoing request.
+// It panics when the config is invalid, see HeaderPropagationConfig.Validate
+func StreamPropagateHeaderInterceptorWithConfig(config HeaderPropagationConfig) grpc.StreamClientInterceptor {
+	propagator := mustHeaderPropagator(config)
 	return func(
 		ctx context.Context,
 		desc *grpc.StreamDesc,
@@ -39,34 +162,83 @@ func StreamPropagateHeaderInterceptor(fields []string) grpc.StreamClientIntercep
 		method string,
 		streamer grpc.Streamer,
 		opts ...grpc.CallOption) (grpc.ClientStream, error) {
-		md, ok := metadata.FromIncomingContext(ctx)
-		if ok {
-			pairs := transformMapToPairs(md, fields)
-			ctx = metadata.AppendToOutgoingContext(ctx, pairs...)
-		}
-		stream, err := streamer(ctx, desc, cc, method, opts...)
+		stream, err := streamer(propagator.outgoingContext(ctx), desc, cc, method, opts...)
 		return stream, err
 	}
 }
 
-func transformMapToPairs(md map[string][]string, fields []string) []string {
+func (p *headerPropagator) outgoingContext(ctx context.Context) context.Context {
+	incoming, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return ctx
+	}
+	outgoing, _ := metadata.FromOutgoingContext(ctx)
+	pairs := p.pairs(incoming, outgoing)
+	if len(pairs) == 0 {
+		return ctx
+	}
+	return metadata.AppendToOutgoingContext(ctx, pairs...)
+}
+
+// pairs returns the key/value pairs to append to the outgoing metadata.
+// Keys already present in the outgoing metadata are skipped
+func (p *headerPropagator) pairs(incoming metadata.MD, outgoing metadata.MD) []string {
+	keys := make([]string, 0, len(incoming))
+	for key := range incoming {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
 	var kv []string
-	for key, value := range md {
-		if len(fields) > 0 && !contains(fields, key) {
+	size := 0
+	for _, key := range keys {
+		key = strings.ToLower(key)
+		if !p.selected(key) {
+			continue
+		}
+		outKey := key
+		if renamed, ok := p.rename[key]; ok {
+			outKey = renamed
+		}
+		if len(outgoing.Get(outKey)) > 0 {
 			continue
 		}
-		for _, v := range value {
-			kv = append(kv, key, v)
+		for _, value := range incoming.Get(key) {
+			if transform, ok := p.transform[key]; ok {
+				var keep bool
+				if value, keep = transform(value); !keep {
+					continue
+				}
+			}
+			if p.maxBytes > 0 && size+len(outKey)+len(value) > p.maxBytes {
+				continue
+			}
+			size += len(outKey) + len(value)
+			kv = append(kv, outKey, value)
 		}
 	}
 	return kv
 }
 
-func contains(a []string, x string) bool {
-	for _, n := range a {
-		if strings.ToLower(x) == strings.ToLower(n) {
+func (p *headerPropagator) selected(key string) bool {
+	if glob.MatchAny(p.deny, key) {
+		return false
+	}
+	if len(p.allow) == 0 && len(p.allowPrefixes) == 0 {
+		return true
+	}
+	for _, prefix := range p.allowPrefixes {
+		if strings.HasPrefix(key, prefix) {
 			return true
 		}
 	}
-	return false
+	return glob.MatchAny(p.allow, key)
+}
+
+func lowerAll(values []string) []string {
+	lowered := make([]string, len(values))
+	for i, value := range values {
+		lowered[i] = strings.ToLower(value)
+	}
+	return lowered
 }
@@ -5,6 +5,7 @@ import (
 	"github.com/stretchr/testify/assert"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/metadata"
+	"strings"
 	"testing"
 )
 
@@ -27,6 +28,18 @@ func TestUnaryPropagateHeaderInterceptor(t *testing.T) {
 	interceptor(ctx, "test", "req", "reply", nil, rpc)
 }
 
+func TestUnaryPropagateHeaderInterceptorKeepsListedDeniedHeaders(t *testing.T) {
+	interceptor := UnaryPropagateHeaderInterceptor([]string{"authorization"})
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("authorization", "Bearer token", "cookie", "session=1"))
+	rpc := func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+		mds, _ := metadata.FromOutgoingContext(ctx)
+		assert.Equal(t, []string{"Bearer token"}, mds.Get("authorization"))
+		assert.Empty(t, mds.Get("cookie"))
+		return nil
+	}
+	interceptor(ctx, "test", "req", "reply", nil, rpc)
+}
+
 func TestUnaryPropagateAllHeaderInterceptor(t *testing.T) {
 	fields := []string{}
 	md := make(map[string]string)
@@ -65,3 +78,97 @@ func TestStreamPropagateHeaderInterceptor(t *testing.T) {
 	}
 	interceptor(ctx, &grpc.StreamDesc{StreamName: "test"}, nil, "test", rpc)
 }
+
+func TestPropagateAllSkipsDefaultDeniedHeaders(t *testing.T) {
+	md := metadata.Pairs(
+		"traceId", "123",
+		"authorization", "Bearer secret",
+		"user", "user",
+		"pass", "123",
+		":authority", "localhost",
+		"content-type", "application/grpc",
+	)
+	ctx := metadata.NewIncomingContext(context.Background(), md)
+	interceptor := UnaryPropagateHeaderInterceptor([]string{})
+	rpc := func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+		mds, _ := metadata.FromOutgoingContext(ctx)
+		assert.Equal(t, metadata.Pairs("traceid", "123"), mds)
+		return nil
+	}
+	interceptor(ctx, "test", "req", "reply", nil, rpc)
+}
+
+func TestPropagateDoesNotDuplicateOutgoingKeys(t *testing.T) {
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("tenant", "incoming"))
+	ctx = metadata.AppendToOutgoingContext(ctx, "tenant", "explicit")
+	interceptor := UnaryPropagateHeaderInterceptor(nil)
+	rpc := func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+		mds, _ := metadata.FromOutgoingContext(ctx)
+		assert.Equal(t, []string{"explicit"}, mds.Get("tenant"))
+		return nil
+	}
+	interceptor(ctx, "test", "req", "reply", nil, rpc)
+}
+
+func TestPropagateHeaderWithConfig(t *testing.T) {
+	md := metadata.Pairs(
+		"x-client-id", "453",
+		"x-client-secret", "shh",
+		"x-locale", "en",
+		"session-id", "session",
+		"authorization", "Bearer token",
+		"big", strings.Repeat("a", 100),
+	)
+	ctx := metadata.NewIncomingContext(context.Background(), md)
+	interceptor := StreamPropagateHeaderInterceptorWithConfig(HeaderPropagationConfig{
+		Allow:              []string{"session-*", "big", "authorization"},
+		AllowPrefixes:      []string{"x-"},
+		Deny:               []string{"*-secret"},
+		DisableDefaultDeny: true,
+		Rename:             map[string]string{"x-locale": "locale"},
+		Transform: map[string]func(string) (string, bool){
+			"session-id": func(value string) (string, bool) {
+				return strings.ToUpper(value), true
+			},
+			"authorization": func(value string) (string, bool) {
+				return "", false
+			},
+		},
+		MaxBytes: 64,
+	})
+	rpc := func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, opts ...grpc.CallOption) (stream grpc.ClientStream, e error) {
+		mds, _ := metadata.FromOutgoingContext(ctx)
+		assert.Equal(t, metadata.Pairs(
+			"x-client-id", "453",
+			"locale", "en",
+			"session-id", "SESSION",
+		), mds)
+		return nil, nil
+	}
+	interceptor(ctx, &grpc.StreamDesc{StreamName: "test"}, nil, "test", rpc)
+}
+
+func TestHeaderPropagationConfigRejectsRenameCollisions(t *testing.T) {
+	assert.Error(t, HeaderPropagationConfig{
+		Allow:  []string{"x-a", "x-b"},
+		Rename: map[string]string{"x-a": "x-out", "X-B": "x-out"},
+	}.Validate())
+	assert.Error(t, HeaderPropagationConfig{
+		Allow:  []string{"x-a", "x-b"},
+		Rename: map[string]string{"x-a": "x-b"},
+	}.Validate())
+	assert.Error(t, HeaderPropagationConfig{
+		Rename: map[string]string{"x-a": "x-b"},
+	}.Validate())
+	assert.NoError(t, HeaderPropagationConfig{
+		Rename: map[string]string{"x-a": "x-b"},
+		Deny:   []string{"x-b"},
+	}.Validate())
+	assert.NoError(t, HeaderPropagationConfig{
+		Allow:  []string{"x-a", "x-b"},
+		Rename: map[string]string{"x-a": "x-b", "x-b": "x-a"},
+	}.Validate())
+	assert.Panics(t, func() {
+		UnaryPropagateHeaderInterceptorWithConfig(HeaderPropagationConfig{Rename: map[string]string{"x-a": "x-b"}})
+	})
+}
@@ -0,0 +1,49 @@
+package clientinterceptor
+
+import (
+	"context"
+	"github.com/apssouza22/grpc-production-go/requestid"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+//UnaryPropagateRequestID forwards the request id of the incoming call (see requestid.FromContext) to the downstream call
+// A request id already set in the outgoing metadata is kept
+func UnaryPropagateRequestID() grpc.UnaryClientInterceptor {
+	return func(
+		ctx context.Context,
+		method string,
+		req interface{},
+		reply interface{},
+		cc *grpc.ClientConn,
+		invoker grpc.UnaryInvoker,
+		opts ...grpc.CallOption,
+	) error {
+		return invoker(withOutgoingRequestID(ctx), method, req, reply, cc, opts...)
+	}
+}
+
+//StreamPropagateRequestID forwards the request id of the incoming call (see requestid.FromContext) to the downstream stream
+// A request id already set in the outgoing metadata is kept
+func StreamPropagateRequestID() grpc.StreamClientInterceptor {
+	return func(
+		ctx context.Context,
+		desc *grpc.StreamDesc,
+		cc *grpc.ClientConn,
+		method string,
+		streamer grpc.Streamer,
+		opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		return streamer(withOutgoingRequestID(ctx), desc, cc, method, opts...)
+	}
+}
+
+func withOutgoingRequestID(ctx context.Context) context.Context {
+	if md, ok := metadata.FromOutgoingContext(ctx); ok && len(md.Get(requestid.Header)) > 0 {
+		return ctx
+	}
+	id, ok := requestid.FromContext(ctx)
+	if !ok {
+		return ctx
+	}
+	return metadata.AppendToOutgoingContext(ctx, requestid.Header, id)
+}
@@ -0,0 +1,41 @@
+package clientinterceptor
+
+import (
+	"context"
+	"github.com/apssouza22/grpc-production-go/requestid"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"testing"
+)
+
+func TestUnaryPropagateRequestID(t *testing.T) {
+	interceptor := UnaryPropagateRequestID()
+	var forwarded []string
+	rpc := func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+		md, _ := metadata.FromOutgoingContext(ctx)
+		forwarded = md.Get(requestid.Header)
+		return nil
+	}
+	ctx := requestid.NewContext(context.Background(), "req-1")
+	interceptor(ctx, "test", "req", "reply", nil, rpc)
+	assert.Equal(t, []string{"req-1"}, forwarded)
+
+	ctx = metadata.AppendToOutgoingContext(ctx, requestid.Header, "explicit")
+	interceptor(ctx, "test", "req", "reply", nil, rpc)
+	assert.Equal(t, []string{"explicit"}, forwarded)
+
+	interceptor(context.Background(), "test", "req", "reply", nil, rpc)
+	assert.Empty(t, forwarded)
+}
+
+func TestStreamPropagateRequestID(t *testing.T) {
+	interceptor := StreamPropagateRequestID()
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(requestid.Header, "incoming"))
+	rpc := func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		md, _ := metadata.FromOutgoingContext(ctx)
+		assert.Equal(t, []string{"incoming"}, md.Get(requestid.Header))
+		return nil, nil
+	}
+	interceptor(ctx, &grpc.StreamDesc{StreamName: "test"}, nil, "test", rpc)
+}
@@ -0,0 +1,298 @@
+package clientinterceptor
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"github.com/apssouza22/grpc-production-go/internal/lru"
+	"github.com/golang/protobuf/proto"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CacheControlHeader is the header (or trailer) carrying the cache directives of the response,
+// e.g. `cache-control: max-age=60, stale-while-revalidate=30, stale-if-error=600`.
+// Sent in the request, `no-cache` bypasses the cache
+const CacheControlHeader = "cache-control"
+
+// ResponseCacheOption configures the client response cache
+type ResponseCacheOption func(*ResponseCache)
+
+// WithResponseCacheSize bounds the cache by number of responses and total encoded size. Zero means no limit.
+// The default is 10000 responses and 32MB
+func WithResponseCacheSize(maxEntries int, maxBytes int64) ResponseCacheOption {
+	return func(c *ResponseCache) {
+		c.cache = lru.New(maxEntries, maxBytes)
+	}
+}
+
+// WithResponseCacheVary adds the outgoing metadata keys telling apart two identical requests, e.g. the tenant.
+// The requests are always told apart on the CredentialHeaders and the calls with a grpc.PerRPCCredentials call option
+// are never cached, so responses are never shared across credentials
+func WithResponseCacheVary(keys ...string) ResponseCacheOption {
+	return func(c *ResponseCache) {
+		c.vary = append(c.vary, lowerAll(keys)...)
+	}
+}
+
+// WithRevalidationTimeout sets the timeout of the background calls refreshing the stale responses. The default is 10s
+func WithRevalidationTimeout(timeout time.Duration) ResponseCacheOption {
+	return func(c *ResponseCache) {
+		c.revalidationTimeout = timeout
+	}
+}
+
+// ResponseCache caches the unary responses as directed by the cache-control header or trailer of the server.
+// Responses without max-age, or with no-store or no-cache, are not cached and evict the response cached for the request.
+// The calls with a grpc.PerRPCCredentials call option bypass the cache
+type ResponseCache struct {
+	cache               *lru.Cache
+	vary                []string
+	revalidationTimeout time.Duration
+	mu                  sync.Mutex
+	revalidating        map[string]bool
+}
+
+// cachedResponse is a response with the directives of the server
+type cachedResponse struct {
+	reply      proto.Message
+	header     metadata.MD
+	trailer    metadata.MD
+	fetchedAt  time.Time
+	directives cacheDirectives
+}
+
+type cacheDirectives struct {
+	maxAge               time.Duration
+	staleWhileRevalidate time.Duration
+	staleIfError         time.Duration
+	noStore              bool
+}
+
+// NewResponseCache creates a client response cache. Register its interceptor with UnaryClientInterceptor
+func NewResponseCache(opts ...ResponseCacheOption) *ResponseCache {
+	c := &ResponseCache{
+		cache:               lru.New(10000, 32<<20),
+		vary:                append([]string{}, CredentialHeaders...),
+		revalidationTimeout: 10 * time.Second,
+		revalidating:        make(map[string]bool),
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// UnaryClientInterceptor returns the interceptor serving the cached responses.
+// Fresh responses are served from the cache; responses stale for less than stale-while-revalidate are served
+// while refreshed in background; responses stale for less than stale-if-error are served when the call fails
+func (c *ResponseCache) UnaryClientInterceptor() grpc.UnaryClientInterceptor {
+	return func(
+		ctx context.Context,
+		method string,
+		req interface{},
+		reply interface{},
+		cc *grpc.ClientConn,
+		invoker grpc.UnaryInvoker,
+		opts ...grpc.CallOption,
+	) error {
+		if hasPerRPCCredentials(opts) {
+			return invoker(ctx, method, req, reply, cc, opts...)
+		}
+		reqMsg, ok := req.(proto.Message)
+		if !ok {
+			return invoker(ctx, method, req, reply, cc, opts...)
+		}
+		replyMsg, ok := reply.(proto.Message)
+		if !ok {
+			return invoker(ctx, method, req, reply, cc, opts...)
+		}
+		key, err := c.key(ctx, method, reqMsg)
+		if err != nil {
+			return invoker(ctx, method, req, reply, cc, opts...)
+		}
+		var cached *cachedResponse
+		if !requestsNoCache(ctx) {
+			if value, ok := c.cache.Get(key); ok {
+				cached = value.(*cachedResponse)
+			}
+		}
+		if cached != nil {
+			age := c.cache.Now().Sub(cached.fetchedAt)
+			if age < cached.directives.maxAge {
+				return cached.serve(replyMsg, opts)
+			}
+			if age < cached.directives.maxAge+cached.directives.staleWhileRevalidate {
+				c.revalidate(ctx, key, method, reqMsg, replyMsg, cc, invoker, opts)
+				return cached.serve(replyMsg, opts)
+			}
+		}
+
+		err = c.fetch(ctx, key, method, reqMsg, replyMsg, cc, invoker, opts)
+		if err != nil && cached != nil && isStaleIfErrorCode(status.Code(err)) &&
+			c.cache.Now().Sub(cached.fetchedAt) < cached.directives.maxAge+cached.directives.staleIfError {
+			return cached.serve(replyMsg, opts)
+		}
+		return err
+	}
+}
+
+// Purge removes every cached response
+func (c *ResponseCache) Purge() {
+	c.cache.RemoveFunc(func(key string) bool {
+		return true
+	})
+}
+
+// fetch calls the server and caches the response when the directives allow it, evicting the cached one otherwise
+func (c *ResponseCache) fetch(
+	ctx context.Context,
+	key string,
+	method string,
+	req proto.Message,
+	reply proto.Message,
+	cc *grpc.ClientConn,
+	invoker grpc.UnaryInvoker,
+	opts []grpc.CallOption,
+) error {
+	var header, trailer metadata.MD
+	callOpts := append(append([]grpc.CallOption{}, opts...), grpc.Header(&header), grpc.Trailer(&trailer))
+	if err := invoker(ctx, method, req, reply, cc, callOpts...); err != nil {
+		return err
+	}
+	directives := parseCacheControl(append(header.Get(CacheControlHeader), trailer.Get(CacheControlHeader)...))
+	if directives.noStore || directives.maxAge <= 0 {
+		c.cache.Remove(key)
+		return nil
+	}
+	entry := &cachedResponse{
+		reply:      proto.Clone(reply),
+		header:     header,
+		trailer:    trailer,
+		fetchedAt:  c.cache.Now(),
+		directives: directives,
+	}
+	keep := directives.staleWhileRevalidate
+	if directives.staleIfError > keep {
+		keep = directives.staleIfError
+	}
+	c.cache.Add(key, entry, int64(len(key)+proto.Size(reply)), entry.fetchedAt.Add(directives.maxAge+keep))
+	return nil
+}
+
+// revalidate refreshes the stale response in background, once at a time per key
+func (c *ResponseCache) revalidate(
+	ctx context.Context,
+	key string,
+	method string,
+	req proto.Message,
+	reply proto.Message,
+	cc *grpc.ClientConn,
+	invoker grpc.UnaryInvoker,
+	opts []grpc.CallOption,
+) {
+	c.mu.Lock()
+	if c.revalidating[key] {
+		c.mu.Unlock()
+		return
+	}
+	c.revalidating[key] = true
+	c.mu.Unlock()
+
+	req = proto.Clone(req)
+	fresh := proto.Clone(reply)
+	fresh.Reset()
+	opts = withoutHeaderTrailerOptions(opts)
+	go func() {
+		defer func() {
+			c.mu.Lock()
+			delete(c.revalidating, key)
+			c.mu.Unlock()
+		}()
+		revalidateCtx, cancel := context.WithTimeout(detachedContext{ctx}, c.revalidationTimeout)
+		defer cancel()
+		_ = c.fetch(revalidateCtx, key, method, req, fresh, cc, invoker, opts)
+	}()
+}
+
+func (c *ResponseCache) key(ctx context.Context, method string, req proto.Message) (string, error) {
+	var buf proto.Buffer
+	buf.SetDeterministic(true)
+	if err := buf.Marshal(req); err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(buf.Bytes())
+	parts := []string{method, hex.EncodeToString(sum[:])}
+	md, _ := metadata.FromOutgoingContext(ctx)
+	keys := append([]string{}, c.vary...)
+	sort.Strings(keys)
+	for _, key := range keys {
+		for _, value := range md.Get(key) {
+			parts = append(parts, key+"="+value)
+		}
+	}
+	return strings.Join(parts, "\x00"), nil
+}
+
+// serve copies the cached response into the reply and the header and trailer options
+func (r *cachedResponse) serve(reply proto.Message, opts []grpc.CallOption) error {
+	reply.Reset()
+	proto.Merge(reply, r.reply)
+	fillHeaderTrailerOptions(opts, r.header, r.trailer)
+	return nil
+}
+
+// parseCacheControl parses the max-age, stale-while-revalidate, stale-if-error, no-store and no-cache directives
+func parseCacheControl(values []string) cacheDirectives {
+	var directives cacheDirectives
+	for _, value := range values {
+		for _, directive := range strings.Split(value, ",") {
+			name, arg := strings.TrimSpace(directive), ""
+			if i := strings.IndexByte(name, '='); i >= 0 {
+				name, arg = strings.TrimSpace(name[:i]), strings.Trim(strings.TrimSpace(name[i+1:]), `"`)
+			}
+			seconds, _ := strconv.Atoi(arg)
+			switch strings.ToLower(name) {
+			case "max-age":
+				directives.maxAge = time.Duration(seconds) * time.Second
+			case "stale-while-revalidate":
+				directives.staleWhileRevalidate = time.Duration(seconds) * time.Second
+			case "stale-if-error":
+				directives.staleIfError = time.Duration(seconds) * time.Second
+			case "no-store", "no-cache":
+				directives.noStore = true
+			}
+		}
+	}
+	return directives
+}
+
+// requestsNoCache reports whether the caller asked to bypass the cache
+func requestsNoCache(ctx context.Context) bool {
+	md, _ := metadata.FromOutgoingContext(ctx)
+	for _, value := range md.Get(CacheControlHeader) {
+		for _, directive := range strings.Split(value, ",") {
+			switch strings.ToLower(strings.TrimSpace(directive)) {
+			case "no-cache", "no-store":
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// isStaleIfErrorCode reports the server side failures allowing a stale response to be served
+func isStaleIfErrorCode(code codes.Code) bool {
+	switch code {
+	case codes.Unavailable, codes.DeadlineExceeded, codes.Internal, codes.Unknown, codes.ResourceExhausted:
+		return true
+	}
+	return false
+}
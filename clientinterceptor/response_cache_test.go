@@ -0,0 +1,200 @@
+package clientinterceptor
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/examples/helloworld/helloworld"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"sync"
+	"testing"
+	"time"
+)
+
+// cacheDirectedInvoker replies with the configured cache-control header or error
+type cacheDirectedInvoker struct {
+	mu           sync.Mutex
+	calls        int
+	cacheControl string
+	inTrailer    bool
+	err          error
+	revalidated  chan struct{}
+}
+
+func (i *cacheDirectedInvoker) invoke(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+	i.mu.Lock()
+	i.calls++
+	calls, err, cacheControl, inTrailer := i.calls, i.err, i.cacheControl, i.inTrailer
+	i.mu.Unlock()
+	if i.revalidated != nil {
+		defer func() { i.revalidated <- struct{}{} }()
+	}
+	if err != nil {
+		return err
+	}
+	for _, opt := range opts {
+		switch o := opt.(type) {
+		case grpc.HeaderCallOption:
+			if !inTrailer {
+				*o.HeaderAddr = metadata.Pairs(CacheControlHeader, cacheControl)
+			}
+		case grpc.TrailerCallOption:
+			if inTrailer {
+				*o.TrailerAddr = metadata.Pairs(CacheControlHeader, cacheControl)
+			}
+		}
+	}
+	reply.(*helloworld.HelloReply).Message = "hello " + req.(*helloworld.HelloRequest).Name + " #" + string(rune('0'+calls))
+	return nil
+}
+
+func (i *cacheDirectedInvoker) callCount() int {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	return i.calls
+}
+
+func cachedCall(interceptor grpc.UnaryClientInterceptor, ctx context.Context, invoker *cacheDirectedInvoker, opts ...grpc.CallOption) (*helloworld.HelloReply, error) {
+	reply := &helloworld.HelloReply{}
+	err := interceptor(ctx, "/config.Config/Get", &helloworld.HelloRequest{Name: "alice"}, reply, nil, invoker.invoke, opts...)
+	return reply, err
+}
+
+func TestResponseCacheMaxAge(t *testing.T) {
+	cache := NewResponseCache()
+	now := time.Now()
+	cache.cache.Now = func() time.Time { return now }
+	interceptor := cache.UnaryClientInterceptor()
+	invoker := &cacheDirectedInvoker{cacheControl: "public, max-age=60"}
+
+	first, err := cachedCall(interceptor, context.Background(), invoker)
+	assert.NoError(t, err)
+	var header metadata.MD
+	second, err := cachedCall(interceptor, context.Background(), invoker, grpc.Header(&header))
+	assert.NoError(t, err)
+	assert.Equal(t, first.Message, second.Message)
+	assert.Equal(t, []string{"public, max-age=60"}, header.Get(CacheControlHeader))
+	assert.Equal(t, 1, invoker.callCount())
+
+	now = now.Add(time.Minute)
+	third, _ := cachedCall(interceptor, context.Background(), invoker)
+	assert.Equal(t, "hello alice #2", third.Message)
+}
+
+func TestResponseCacheDirectivesInTrailer(t *testing.T) {
+	interceptor := NewResponseCache().UnaryClientInterceptor()
+	invoker := &cacheDirectedInvoker{cacheControl: "max-age=60", inTrailer: true}
+	cachedCall(interceptor, context.Background(), invoker)
+	cachedCall(interceptor, context.Background(), invoker)
+	assert.Equal(t, 1, invoker.callCount())
+}
+
+func TestResponseCacheNotCacheable(t *testing.T) {
+	for _, cacheControl := range []string{"", "no-store, max-age=60", "no-cache", "max-age=0"} {
+		interceptor := NewResponseCache().UnaryClientInterceptor()
+		invoker := &cacheDirectedInvoker{cacheControl: cacheControl}
+		cachedCall(interceptor, context.Background(), invoker)
+		cachedCall(interceptor, context.Background(), invoker)
+		assert.Equal(t, 2, invoker.callCount(), cacheControl)
+	}
+}
+
+func TestResponseCacheNoStoreEvicts(t *testing.T) {
+	interceptor := NewResponseCache().UnaryClientInterceptor()
+	invoker := &cacheDirectedInvoker{cacheControl: "max-age=60"}
+	cachedCall(interceptor, context.Background(), invoker)
+	invoker.mu.Lock()
+	invoker.cacheControl = "no-store"
+	invoker.mu.Unlock()
+	reply, _ := cachedCall(interceptor, metadata.AppendToOutgoingContext(context.Background(), CacheControlHeader, "no-cache"), invoker)
+	assert.Equal(t, "hello alice #2", reply.Message)
+	reply, _ = cachedCall(interceptor, context.Background(), invoker)
+	assert.Equal(t, "hello alice #3", reply.Message)
+}
+
+func TestResponseCacheRequestNoCache(t *testing.T) {
+	interceptor := NewResponseCache().UnaryClientInterceptor()
+	invoker := &cacheDirectedInvoker{cacheControl: "max-age=60"}
+	cachedCall(interceptor, context.Background(), invoker)
+	reply, _ := cachedCall(interceptor, metadata.AppendToOutgoingContext(context.Background(), CacheControlHeader, "no-cache"), invoker)
+	assert.Equal(t, "hello alice #2", reply.Message)
+	reply, _ = cachedCall(interceptor, context.Background(), invoker)
+	assert.Equal(t, "hello alice #2", reply.Message)
+}
+
+func TestResponseCacheVary(t *testing.T) {
+	interceptor := NewResponseCache().UnaryClientInterceptor()
+	invoker := &cacheDirectedInvoker{cacheControl: "max-age=60"}
+	cachedCall(interceptor, metadata.AppendToOutgoingContext(context.Background(), "authorization", "alice"), invoker)
+	cachedCall(interceptor, metadata.AppendToOutgoingContext(context.Background(), "authorization", "bob"), invoker)
+	cachedCall(interceptor, metadata.AppendToOutgoingContext(context.Background(), "authorization", "alice"), invoker)
+	assert.Equal(t, 2, invoker.callCount())
+
+	cachedCall(interceptor, metadata.AppendToOutgoingContext(context.Background(), "user", "alice", "pass", "secret"), invoker)
+	cachedCall(interceptor, metadata.AppendToOutgoingContext(context.Background(), "user", "bob", "pass", "secret"), invoker)
+	cachedCall(interceptor, metadata.AppendToOutgoingContext(context.Background(), "user", "alice", "pass", "secret"), invoker)
+	assert.Equal(t, 4, invoker.callCount())
+}
+
+func TestResponseCacheSkipsPerRPCCredentials(t *testing.T) {
+	cache := NewResponseCache()
+	interceptor := cache.UnaryClientInterceptor()
+	invoker := &cacheDirectedInvoker{cacheControl: "max-age=60"}
+	cachedCall(interceptor, context.Background(), invoker, grpc.PerRPCCredentials(tokenCredentials("alice")))
+	reply, _ := cachedCall(interceptor, context.Background(), invoker, grpc.PerRPCCredentials(tokenCredentials("bob")))
+	assert.Equal(t, 2, invoker.callCount())
+	assert.Equal(t, "hello alice #2", reply.Message)
+	assert.Equal(t, 0, cache.cache.Len())
+}
+
+func TestResponseCacheStaleWhileRevalidate(t *testing.T) {
+	cache := NewResponseCache()
+	now := time.Now()
+	cache.cache.Now = func() time.Time { return now }
+	interceptor := cache.UnaryClientInterceptor()
+	invoker := &cacheDirectedInvoker{cacheControl: "max-age=60, stale-while-revalidate=30"}
+	cachedCall(interceptor, context.Background(), invoker)
+
+	invoker.revalidated = make(chan struct{}, 1)
+	now = now.Add(70 * time.Second)
+	stale, err := cachedCall(interceptor, context.Background(), invoker)
+	assert.NoError(t, err)
+	assert.Equal(t, "hello alice #1", stale.Message)
+	<-invoker.revalidated
+	assert.Eventually(t, func() bool {
+		reply, _ := cachedCall(interceptor, context.Background(), invoker)
+		return reply.Message == "hello alice #2"
+	}, time.Second, 5*time.Millisecond)
+	assert.Equal(t, 2, invoker.callCount())
+}
+
+func TestResponseCacheStaleIfError(t *testing.T) {
+	cache := NewResponseCache()
+	now := time.Now()
+	cache.cache.Now = func() time.Time { return now }
+	interceptor := cache.UnaryClientInterceptor()
+	invoker := &cacheDirectedInvoker{cacheControl: "max-age=60, stale-if-error=600"}
+	cachedCall(interceptor, context.Background(), invoker)
+
+	invoker.err = status.Error(codes.Unavailable, "down")
+	now = now.Add(5 * time.Minute)
+	reply, err := cachedCall(interceptor, context.Background(), invoker)
+	assert.NoError(t, err)
+	assert.Equal(t, "hello alice #1", reply.Message)
+
+	invoker.err = status.Error(codes.NotFound, "gone")
+	_, err = cachedCall(interceptor, context.Background(), invoker)
+	assert.Equal(t, codes.NotFound, status.Code(err))
+
+	invoker.err = status.Error(codes.Unavailable, "down")
+	now = now.Add(10 * time.Minute)
+	_, err = cachedCall(interceptor, context.Background(), invoker)
+	assert.Equal(t, codes.Unavailable, status.Code(err))
+}
+
+func TestParseCacheControl(t *testing.T) {
+	directives := parseCacheControl([]string{`max-age="60", Stale-While-Revalidate=5`, "stale-if-error=10"})
+	assert.Equal(t, cacheDirectives{maxAge: time.Minute, staleWhileRevalidate: 5 * time.Second, staleIfError: 10 * time.Second}, directives)
+}
@@ -2,15 +2,39 @@ package clientinterceptor
 
 import (
 	"context"
+	"github.com/apssouza22/grpc-production-go/logging"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
-	"log"
 	"time"
 )
 
+// TimeoutOption configures the timeout interceptors
+type TimeoutOption func(*timeoutConfig)
+
+type timeoutConfig struct {
+	logger logging.Logger
+}
+
+// WithTimeoutLogger sets the logger receiving the timed out calls. The default logger is used otherwise
+func WithTimeoutLogger(logger logging.Logger) TimeoutOption {
+	return func(c *timeoutConfig) {
+		c.logger = logger
+	}
+}
+
+func newTimeoutConfig(opts []TimeoutOption) *timeoutConfig {
+	cfg := &timeoutConfig{}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	cfg.logger = logging.OrDefault(cfg.logger)
+	return cfg
+}
+
 //UnaryTimeoutInterceptor monitor the DeadlineExceeded error and log it
-func UnaryTimeoutInterceptor() grpc.UnaryClientInterceptor {
+func UnaryTimeoutInterceptor(opts ...TimeoutOption) grpc.UnaryClientInterceptor {
+	cfg := newTimeoutConfig(opts)
 	return func(
 		ctx context.Context,
 		method string,
@@ -22,12 +46,13 @@ func UnaryTimeoutInterceptor() grpc.UnaryClientInterceptor {
 	) error {
 		start := time.Now()
 		err := invoker(ctx, method, req, reply, cc, opts...)
-		return handleError(err, method, start)
+		return cfg.handleError(err, method, start)
 	}
 }
 
 //StreamTimeoutInterceptor monitor the DeadlineExceeded error and log it
-func StreamTimeoutInterceptor() grpc.StreamClientInterceptor {
+func StreamTimeoutInterceptor(opts ...TimeoutOption) grpc.StreamClientInterceptor {
+	cfg := newTimeoutConfig(opts)
 	return func(
 		ctx context.Context,
 		desc *grpc.StreamDesc,
@@ -37,12 +62,12 @@ func StreamTimeoutInterceptor() grpc.StreamClientInterceptor {
 		opts ...grpc.CallOption) (grpc.ClientStream, error) {
 		start := time.Now()
 		stream, err := streamer(ctx, desc, cc, method, opts...)
-		err = handleError(err, method, start)
+		err = cfg.handleError(err, method, start)
 		return stream, err
 	}
 }
 
-func handleError(err error, method string, start time.Time) error {
+func (c *timeoutConfig) handleError(err error, method string, start time.Time) error {
 	if err == nil {
 		return err
 	}
@@ -53,10 +78,10 @@ func handleError(err error, method string, start time.Time) error {
 	if statusErr.Code() != codes.DeadlineExceeded {
 		return err
 	}
-	log.Printf(
-		"Timeout - Invoked RPC method=%s; Duration=%s; Error=%+v",
-		method,
-		time.Since(start), err,
+	c.logger.Warn("Timeout - Invoked RPC",
+		"method", method,
+		"duration", time.Since(start),
+		"err", err,
 	)
 	return err
 }
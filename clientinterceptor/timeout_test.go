@@ -0,0 +1,37 @@
+package clientinterceptor
+
+import (
+	"context"
+	"github.com/apssouza22/grpc-production-go/logging"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"testing"
+)
+
+func TestUnaryTimeoutInterceptorLogsDeadlineExceeded(t *testing.T) {
+	logger := &warnRecorder{}
+	interceptor := UnaryTimeoutInterceptor(WithTimeoutLogger(logger))
+	rpc := func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+		return status.Error(codes.DeadlineExceeded, "too slow")
+	}
+	err := interceptor(context.Background(), "/test.Service/Method", "req", "reply", nil, rpc)
+	assert.Equal(t, codes.DeadlineExceeded, status.Code(err))
+	assert.Equal(t, 1, logger.warnings)
+
+	rpc = func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+		return status.Error(codes.NotFound, "missing")
+	}
+	interceptor(context.Background(), "/test.Service/Method", "req", "reply", nil, rpc)
+	assert.Equal(t, 1, logger.warnings)
+}
+
+type warnRecorder struct {
+	logging.Logger
+	warnings int
+}
+
+func (l *warnRecorder) Warn(msg string, keyvals ...interface{}) {
+	l.warnings++
+}
@@ -0,0 +1,149 @@
+// Package grpcerrors decodes the rich status details (ErrorInfo, RetryInfo, LocalizedMessage, DebugInfo,
+// BadRequest) returned by the servers into typed errors
+package grpcerrors
+
+import (
+	"fmt"
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"strings"
+	"time"
+)
+
+// Error is a gRPC status error with its details decoded
+type Error struct {
+	Code    codes.Code
+	Message string
+	// Reason, Domain and Metadata come from the ErrorInfo detail
+	Reason   string
+	Domain   string
+	Metadata map[string]string
+	// RetryDelay comes from the RetryInfo detail, zero when the call should not be retried
+	RetryDelay time.Duration
+	// Locale and LocalizedMessage come from the LocalizedMessage detail
+	Locale           string
+	LocalizedMessage string
+	// DebugDetail and StackEntries come from the DebugInfo detail, only sent by non production servers
+	DebugDetail  string
+	StackEntries []string
+	// FieldViolations come from the BadRequest detail
+	FieldViolations []*errdetails.BadRequest_FieldViolation
+
+	status *status.Status
+}
+
+// FromError decodes the status error. It returns false for nil and for errors not carrying a gRPC status
+func FromError(err error) (*Error, bool) {
+	if err == nil {
+		return nil, false
+	}
+	if e, ok := err.(*Error); ok {
+		return e, true
+	}
+	sts, ok := status.FromError(err)
+	if !ok {
+		return nil, false
+	}
+	return FromStatus(sts), true
+}
+
+// FromStatus decodes the details of the status
+func FromStatus(sts *status.Status) *Error {
+	e := &Error{Code: sts.Code(), Message: sts.Message(), status: sts}
+	for _, detail := range sts.Details() {
+		switch d := detail.(type) {
+		case *errdetails.ErrorInfo:
+			e.Reason = d.Reason
+			e.Domain = d.Domain
+			e.Metadata = d.Metadata
+		case *errdetails.RetryInfo:
+			if delay, err := ptypes.Duration(d.RetryDelay); err == nil {
+				e.RetryDelay = delay
+			}
+		case *errdetails.LocalizedMessage:
+			e.Locale = d.Locale
+			e.LocalizedMessage = d.Message
+		case *errdetails.DebugInfo:
+			e.DebugDetail = d.Detail
+			e.StackEntries = d.StackEntries
+		case *errdetails.BadRequest:
+			e.FieldViolations = append(e.FieldViolations, d.FieldViolations...)
+		}
+	}
+	return e
+}
+
+// Error formats the code, domain, reason and message of the error like the gRPC status errors
+func (e *Error) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "rpc error: code = %s", e.code())
+	if e.Domain != "" {
+		fmt.Fprintf(&b, " domain = %s", e.Domain)
+	}
+	if e.Reason != "" {
+		fmt.Fprintf(&b, " reason = %s", e.Reason)
+	}
+	fmt.Fprintf(&b, " desc = %s", e.Message)
+	return b.String()
+}
+
+// GRPCStatus returns the underlying status, so status.Code and status.Convert keep working on the decoded error.
+// An error built without Code, e.g. a sentinel, has the Unknown code. The status of a built error carries its
+// Reason, Domain, RetryDelay, LocalizedMessage and FieldViolations as details, so a handler can return it as is
+func (e *Error) GRPCStatus() *status.Status {
+	if e.status != nil {
+		return e.status
+	}
+	sts := status.New(e.code(), e.Message)
+	var details []proto.Message
+	if e.Reason != "" || e.Domain != "" {
+		details = append(details, &errdetails.ErrorInfo{Reason: e.Reason, Domain: e.Domain, Metadata: e.Metadata})
+	}
+	if e.RetryDelay > 0 {
+		details = append(details, &errdetails.RetryInfo{RetryDelay: ptypes.DurationProto(e.RetryDelay)})
+	}
+	if e.LocalizedMessage != "" {
+		details = append(details, &errdetails.LocalizedMessage{Locale: e.Locale, Message: e.LocalizedMessage})
+	}
+	if len(e.FieldViolations) > 0 {
+		details = append(details, &errdetails.BadRequest{FieldViolations: e.FieldViolations})
+	}
+	if len(details) == 0 {
+		return sts
+	}
+	detailed, err := sts.WithDetails(details...)
+	if err != nil {
+		return sts
+	}
+	return detailed
+}
+
+// code returns the code of the error, Unknown when unset as an error cannot have the OK code
+func (e *Error) code() codes.Code {
+	if e.Code == codes.OK {
+		return codes.Unknown
+	}
+	return e.Code
+}
+
+// Is matches a target *Error on its non zero Code, Domain and Reason, allowing sentinels like
+// `var ErrNotFound = &grpcerrors.Error{Domain: "users", Reason: "USER_NOT_FOUND"}` to be used with errors.Is
+func (e *Error) Is(target error) bool {
+	t, ok := target.(*Error)
+	if !ok {
+		return false
+	}
+	if t.Code != codes.OK && t.Code != e.Code {
+		return false
+	}
+	if t.Domain != "" && t.Domain != e.Domain {
+		return false
+	}
+	if t.Reason != "" && t.Reason != e.Reason {
+		return false
+	}
+	return t.Code != codes.OK || t.Domain != "" || t.Reason != ""
+}
@@ -0,0 +1,76 @@
+package grpcerrors
+
+import (
+	"errors"
+	"github.com/golang/protobuf/ptypes"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"testing"
+	"time"
+)
+
+func TestFromError(t *testing.T) {
+	sts, err := status.New(codes.NotFound, "user not found").WithDetails(
+		&errdetails.ErrorInfo{Reason: "USER_NOT_FOUND", Domain: "users", Metadata: map[string]string{"id": "42"}},
+		&errdetails.RetryInfo{RetryDelay: ptypes.DurationProto(time.Second)},
+		&errdetails.LocalizedMessage{Locale: "pt", Message: "usuário não encontrado"},
+		&errdetails.DebugInfo{Detail: "select failed"},
+		&errdetails.BadRequest{FieldViolations: []*errdetails.BadRequest_FieldViolation{{Field: "id", Description: "unknown"}}},
+	)
+	assert.NoError(t, err)
+
+	decoded, ok := FromError(sts.Err())
+	assert.True(t, ok)
+	assert.Equal(t, codes.NotFound, decoded.Code)
+	assert.Equal(t, "user not found", decoded.Message)
+	assert.Equal(t, "USER_NOT_FOUND", decoded.Reason)
+	assert.Equal(t, "users", decoded.Domain)
+	assert.Equal(t, map[string]string{"id": "42"}, decoded.Metadata)
+	assert.Equal(t, time.Second, decoded.RetryDelay)
+	assert.Equal(t, "usuário não encontrado", decoded.LocalizedMessage)
+	assert.Equal(t, "select failed", decoded.DebugDetail)
+	assert.Len(t, decoded.FieldViolations, 1)
+	assert.Equal(t, codes.NotFound, status.Code(decoded))
+	assert.Equal(t, "rpc error: code = NotFound domain = users reason = USER_NOT_FOUND desc = user not found", decoded.Error())
+}
+
+func TestSentinelWithoutCode(t *testing.T) {
+	errDisabled := &Error{Domain: "users", Reason: "USER_DISABLED", Message: "user disabled"}
+	assert.Equal(t, "rpc error: code = Unknown domain = users reason = USER_DISABLED desc = user disabled", errDisabled.Error())
+	assert.Equal(t, codes.Unknown, status.Code(errDisabled))
+	assert.Equal(t, "user disabled", status.Convert(errDisabled).Message())
+	assert.True(t, errors.Is(errDisabled, &Error{Reason: "USER_DISABLED"}))
+}
+
+func TestBuiltErrorStatusDetails(t *testing.T) {
+	errNotFound := &Error{Code: codes.NotFound, Domain: "users", Reason: "USER_NOT_FOUND", Metadata: map[string]string{"id": "42"}, RetryDelay: time.Second, Message: "user not found"}
+
+	decoded, ok := FromError(status.Convert(errNotFound).Err())
+	assert.True(t, ok)
+	assert.Equal(t, codes.NotFound, decoded.Code)
+	assert.Equal(t, "users", decoded.Domain)
+	assert.Equal(t, "USER_NOT_FOUND", decoded.Reason)
+	assert.Equal(t, map[string]string{"id": "42"}, decoded.Metadata)
+	assert.Equal(t, time.Second, decoded.RetryDelay)
+	assert.True(t, errors.Is(decoded, errNotFound))
+}
+
+func TestFromErrorWithoutStatus(t *testing.T) {
+	_, ok := FromError(nil)
+	assert.False(t, ok)
+	_, ok = FromError(errors.New("plain"))
+	assert.False(t, ok)
+}
+
+func TestErrorIs(t *testing.T) {
+	errNotFound := &Error{Domain: "users", Reason: "USER_NOT_FOUND"}
+	sts, _ := status.New(codes.NotFound, "user not found").WithDetails(&errdetails.ErrorInfo{Reason: "USER_NOT_FOUND", Domain: "users"})
+	decoded, _ := FromError(sts.Err())
+
+	assert.True(t, errors.Is(decoded, errNotFound))
+	assert.True(t, errors.Is(decoded, &Error{Code: codes.NotFound}))
+	assert.False(t, errors.Is(decoded, &Error{Domain: "users", Reason: "USER_DISABLED"}))
+	assert.False(t, errors.Is(decoded, &Error{}))
+}
@@ -2,48 +2,55 @@ package grpcutils
 
 import (
 	"github.com/apssouza22/grpc-production-go/clientinterceptor"
+	"github.com/apssouza22/grpc-production-go/logging"
 	interceptors "github.com/apssouza22/grpc-production-go/serverinterceptor"
-	grpc_recovery "github.com/grpc-ecosystem/go-grpc-middleware/recovery"
 	grpc_opentracing "github.com/grpc-ecosystem/go-grpc-middleware/tracing/opentracing"
 	"github.com/opentracing/opentracing-go"
-	"github.com/sirupsen/logrus"
 	"google.golang.org/grpc"
-	"google.golang.org/grpc/codes"
-	"google.golang.org/grpc/status"
 )
 
-func requestErrorHandler(p interface{}) (err error) {
-	logrus.Error(p)
-	return status.Errorf(codes.Internal, "Something went wrong :( ")
-}
-
 // GetDefaultUnaryServerInterceptors returns the default interceptors server unary connections
 func GetDefaultUnaryServerInterceptors() []grpc.UnaryServerInterceptor {
+	return GetDefaultUnaryServerInterceptorsWithLogger(logging.Default())
+}
+
+// GetDefaultUnaryServerInterceptorsWithLogger returns the default interceptors server unary connections, logging with the logger
+func GetDefaultUnaryServerInterceptorsWithLogger(logger logging.Logger) []grpc.UnaryServerInterceptor {
 	return []grpc.UnaryServerInterceptor{
-		interceptors.UnaryAuditServiceRequest(),
-		interceptors.UnaryLogRequestCanceled(),
+		interceptors.UnaryAuditServiceRequest(interceptors.WithAuditLogger(logger)),
+		interceptors.UnaryLogRequestCanceled(interceptors.WithCanceledLogger(logger)),
 		//Recovery handlers should typically be last in the chain so that other middleware
 		// (e.g. logging) can operate on the recovered state instead of being directly affected by any panic
-		grpc_recovery.UnaryServerInterceptor(grpc_recovery.WithRecoveryHandler(requestErrorHandler)),
+		interceptors.UnaryRecovery(interceptors.WithRecoveryLogger(logger)),
 	}
 }
 
 // GetDefaultStreamServerInterceptors returns the default interceptors for server streams connections
 func GetDefaultStreamServerInterceptors() []grpc.StreamServerInterceptor {
+	return GetDefaultStreamServerInterceptorsWithLogger(logging.Default())
+}
+
+// GetDefaultStreamServerInterceptorsWithLogger returns the default interceptors for server streams connections, logging with the logger
+func GetDefaultStreamServerInterceptorsWithLogger(logger logging.Logger) []grpc.StreamServerInterceptor {
 	return []grpc.StreamServerInterceptor{
-		interceptors.StreamAuditServiceRequest(),
-		interceptors.StreamLogRequestCanceled(),
-		grpc_recovery.StreamServerInterceptor(grpc_recovery.WithRecoveryHandler(requestErrorHandler)),
+		interceptors.StreamAuditServiceRequest(interceptors.WithAuditLogger(logger)),
+		interceptors.StreamLogRequestCanceled(interceptors.WithCanceledLogger(logger)),
+		interceptors.StreamRecovery(interceptors.WithRecoveryLogger(logger)),
 	}
 }
 
 //GetDefaultUnaryClientInterceptors returns the default interceptors for client unary connections
 func GetDefaultUnaryClientInterceptors() []grpc.UnaryClientInterceptor {
+	return GetDefaultUnaryClientInterceptorsWithLogger(logging.Default())
+}
+
+// GetDefaultUnaryClientInterceptorsWithLogger returns the default interceptors for client unary connections, logging with the logger
+func GetDefaultUnaryClientInterceptorsWithLogger(logger logging.Logger) []grpc.UnaryClientInterceptor {
 	tracing := grpc_opentracing.UnaryClientInterceptor(
 		grpc_opentracing.WithTracer(opentracing.GlobalTracer()),
 	)
 	interceptors := []grpc.UnaryClientInterceptor{
-		clientinterceptor.UnaryTimeoutInterceptor(),
+		clientinterceptor.UnaryTimeoutInterceptor(clientinterceptor.WithTimeoutLogger(logger)),
 		tracing,
 	}
 	return interceptors
@@ -51,11 +58,16 @@ func GetDefaultUnaryClientInterceptors() []grpc.UnaryClientInterceptor {
 
 //GetDefaultStreamClientInterceptors returns the default interceptors for client stream connections
 func GetDefaultStreamClientInterceptors() []grpc.StreamClientInterceptor {
+	return GetDefaultStreamClientInterceptorsWithLogger(logging.Default())
+}
+
+// GetDefaultStreamClientInterceptorsWithLogger returns the default interceptors for client stream connections, logging with the logger
+func GetDefaultStreamClientInterceptorsWithLogger(logger logging.Logger) []grpc.StreamClientInterceptor {
 	tracing := grpc_opentracing.StreamClientInterceptor(
 		grpc_opentracing.WithTracer(opentracing.GlobalTracer()),
 	)
 	interceptors := []grpc.StreamClientInterceptor{
-		clientinterceptor.StreamTimeoutInterceptor(),
+		clientinterceptor.StreamTimeoutInterceptor(clientinterceptor.WithTimeoutLogger(logger)),
 		tracing,
 	}
 	return interceptors
@@ -1,7 +1,13 @@
 package grpcutils
 
 import (
+	"context"
+	"github.com/apssouza22/grpc-production-go/logging"
+	grpc_middleware "github.com/grpc-ecosystem/go-grpc-middleware"
 	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 	"testing"
 )
 
@@ -25,7 +31,30 @@ func TestGetDefaultUnaryServerInterceptors(t *testing.T) {
 	assert.NotEmpty(t, serverInterceptors)
 }
 
-func Test_requestErrorHandler(t *testing.T) {
-	handler := requestErrorHandler("")
-	assert.Error(t, handler)
+func TestDefaultUnaryServerInterceptorsRecoverPanics(t *testing.T) {
+	serverInterceptors := GetDefaultUnaryServerInterceptors()
+	recovery := serverInterceptors[len(serverInterceptors)-1]
+	_, err := recovery(context.Background(), "req", &grpc.UnaryServerInfo{FullMethod: "test"}, func(ctx context.Context, req interface{}) (interface{}, error) {
+		panic("boom")
+	})
+	assert.Equal(t, codes.Internal, status.Code(err))
+	assert.Equal(t, "Something went wrong :( ", status.Convert(err).Message())
+}
+
+func Test_streamRecovery(t *testing.T) {
+	serverInterceptors := GetDefaultStreamServerInterceptors()
+	recovery := serverInterceptors[len(serverInterceptors)-1]
+	err := recovery(nil, &grpc_middleware.WrappedServerStream{WrappedContext: context.Background()}, &grpc.StreamServerInfo{FullMethod: "test"}, func(srv interface{}, stream grpc.ServerStream) error {
+		panic("boom")
+	})
+	assert.Error(t, err)
+	assert.Equal(t, "Something went wrong :( ", status.Convert(err).Message())
+}
+
+func TestDefaultInterceptorsWithLogger(t *testing.T) {
+	logger := logging.Nop()
+	assert.Len(t, GetDefaultUnaryServerInterceptorsWithLogger(logger), len(GetDefaultUnaryServerInterceptors()))
+	assert.Len(t, GetDefaultStreamServerInterceptorsWithLogger(logger), len(GetDefaultStreamServerInterceptors()))
+	assert.Len(t, GetDefaultUnaryClientInterceptorsWithLogger(logger), len(GetDefaultUnaryClientInterceptors()))
+	assert.Len(t, GetDefaultStreamClientInterceptorsWithLogger(logger), len(GetDefaultStreamClientInterceptors()))
 }
@@ -0,0 +1,21 @@
+// Package glob matches method names and metadata keys against path.Match globs,
+// shared by the client and server interceptors
+package glob
+
+import "path"
+
+// Match checks whether the name, e.g. a full method or a metadata key, matches the glob. A malformed glob matches nothing
+func Match(glob string, name string) bool {
+	matched, _ := path.Match(glob, name)
+	return matched
+}
+
+// MatchAny checks whether the name matches any of the globs
+func MatchAny(globs []string, name string) bool {
+	for _, glob := range globs {
+		if Match(glob, name) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,25 @@
+package glob
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestMatch(t *testing.T) {
+	assert.True(t, Match("/catalog.Products/Get*", "/catalog.Products/GetProduct"))
+	assert.False(t, Match("/catalog.Products/Get*", "/catalog.Products/ListProducts"))
+	assert.False(t, Match("[", "["))
+}
+
+func TestMatchAny(t *testing.T) {
+	globs := []string{"/grpc.health.v1.Health/*", "x-*"}
+	assert.True(t, MatchAny(globs, "/grpc.health.v1.Health/Check"))
+	assert.True(t, MatchAny(globs, "x-request-id"))
+	assert.False(t, MatchAny(globs, "/greeter/SayHello"))
+	assert.False(t, MatchAny(nil, "x-request-id"))
+}
+
+func TestMatchAnyIgnoresMalformedGlobs(t *testing.T) {
+	assert.False(t, MatchAny([]string{"["}, "["))
+	assert.True(t, MatchAny([]string{"[", "*"}, "x"))
+}
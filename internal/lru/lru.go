@@ -0,0 +1,143 @@
+// Package lru implements a size bounded least recently used cache with per entry expiration,
+// shared by the idempotency and response caching components
+package lru
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// Cache is a thread safe LRU cache bounded by number of entries and total size
+type Cache struct {
+	mu         sync.Mutex
+	maxEntries int
+	maxBytes   int64
+	bytes      int64
+	ll         *list.List
+	items      map[string]*list.Element
+	// Now returns the current time, replaced in tests
+	Now func() time.Time
+}
+
+type entry struct {
+	key       string
+	value     interface{}
+	size      int64
+	expiresAt time.Time
+}
+
+// New creates a cache holding up to maxEntries entries and maxBytes total size. Zero means no limit
+func New(maxEntries int, maxBytes int64) *Cache {
+	return &Cache{
+		maxEntries: maxEntries,
+		maxBytes:   maxBytes,
+		ll:         list.New(),
+		items:      make(map[string]*list.Element),
+		Now:        time.Now,
+	}
+}
+
+// Get returns the value of the key when present and not expired
+func (c *Cache) Get(key string) (interface{}, bool) {
+	value, _, ok := c.GetWithExpiry(key)
+	return value, ok
+}
+
+// GetWithExpiry returns the value of the key and its expiration when present and not expired
+func (c *Cache) GetWithExpiry(key string) (interface{}, time.Time, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	elem, ok := c.items[key]
+	if !ok {
+		return nil, time.Time{}, false
+	}
+	e := elem.Value.(*entry)
+	if !e.expiresAt.IsZero() && !c.Now().Before(e.expiresAt) {
+		c.removeElement(elem)
+		return nil, time.Time{}, false
+	}
+	c.ll.MoveToFront(elem)
+	return e.value, e.expiresAt, true
+}
+
+// Peek returns the value of the key even when expired, without updating its recency
+func (c *Cache) Peek(key string) (value interface{}, expiresAt time.Time, ok bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	elem, ok := c.items[key]
+	if !ok {
+		return nil, time.Time{}, false
+	}
+	e := elem.Value.(*entry)
+	return e.value, e.expiresAt, true
+}
+
+// Add stores the value with its size, evicting the least recently used entries to honor the limits.
+// A zero expiresAt never expires. It returns false when the value alone is larger than the size limit
+func (c *Cache) Add(key string, value interface{}, size int64, expiresAt time.Time) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.maxBytes > 0 && size > c.maxBytes {
+		return false
+	}
+	if elem, ok := c.items[key]; ok {
+		c.removeElement(elem)
+	}
+	c.items[key] = c.ll.PushFront(&entry{key: key, value: value, size: size, expiresAt: expiresAt})
+	c.bytes += size
+	for c.overflows() {
+		c.removeElement(c.ll.Back())
+	}
+	return true
+}
+
+// Remove deletes the key
+func (c *Cache) Remove(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if elem, ok := c.items[key]; ok {
+		c.removeElement(elem)
+	}
+}
+
+// RemoveFunc deletes the keys accepted by the predicate and returns how many were deleted
+func (c *Cache) RemoveFunc(remove func(key string) bool) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	removed := 0
+	for key, elem := range c.items {
+		if remove(key) {
+			c.removeElement(elem)
+			removed++
+		}
+	}
+	return removed
+}
+
+// Len returns the number of entries, including the expired ones not evicted yet
+func (c *Cache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.ll.Len()
+}
+
+// Bytes returns the total size of the entries
+func (c *Cache) Bytes() int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.bytes
+}
+
+func (c *Cache) overflows() bool {
+	if c.ll.Len() == 0 {
+		return false
+	}
+	return (c.maxEntries > 0 && c.ll.Len() > c.maxEntries) || (c.maxBytes > 0 && c.bytes > c.maxBytes)
+}
+
+func (c *Cache) removeElement(elem *list.Element) {
+	e := c.ll.Remove(elem).(*entry)
+	delete(c.items, e.key)
+	c.bytes -= e.size
+}
@@ -0,0 +1,65 @@
+package lru
+
+import (
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	c := New(2, 0)
+	c.Add("a", 1, 0, time.Time{})
+	c.Add("b", 2, 0, time.Time{})
+	c.Get("a")
+	c.Add("c", 3, 0, time.Time{})
+
+	_, ok := c.Get("b")
+	assert.False(t, ok)
+	value, ok := c.Get("a")
+	assert.True(t, ok)
+	assert.Equal(t, 1, value)
+	assert.Equal(t, 2, c.Len())
+}
+
+func TestCacheSizeLimit(t *testing.T) {
+	c := New(0, 10)
+	assert.True(t, c.Add("a", "a", 6, time.Time{}))
+	assert.True(t, c.Add("b", "b", 6, time.Time{}))
+	assert.False(t, c.Add("big", "big", 11, time.Time{}))
+
+	_, ok := c.Get("a")
+	assert.False(t, ok)
+	assert.Equal(t, int64(6), c.Bytes())
+}
+
+func TestCacheExpiration(t *testing.T) {
+	now := time.Now()
+	c := New(0, 0)
+	c.Now = func() time.Time { return now }
+	c.Add("a", 1, 1, now.Add(time.Second))
+
+	_, ok := c.Get("a")
+	assert.True(t, ok)
+	now = now.Add(time.Second)
+	_, _, ok = c.Peek("a")
+	assert.True(t, ok)
+	_, ok = c.Get("a")
+	assert.False(t, ok)
+	assert.Equal(t, 0, c.Len())
+	assert.Equal(t, int64(0), c.Bytes())
+}
+
+func TestCacheRemoveFunc(t *testing.T) {
+	c := New(0, 0)
+	c.Add("/svc/A|1", 1, 0, time.Time{})
+	c.Add("/svc/A|2", 2, 0, time.Time{})
+	c.Add("/svc/B|1", 3, 0, time.Time{})
+	removed := c.RemoveFunc(func(key string) bool {
+		return strings.HasPrefix(key, "/svc/A|")
+	})
+	assert.Equal(t, 2, removed)
+	assert.Equal(t, 1, c.Len())
+	c.Remove("/svc/B|1")
+	assert.Equal(t, 0, c.Len())
+}
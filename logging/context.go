@@ -0,0 +1,20 @@
+package logging
+
+import (
+	"context"
+)
+
+type loggerKey struct{}
+
+// NewContext returns a context carrying the logger
+func NewContext(ctx context.Context, logger Logger) context.Context {
+	return context.WithValue(ctx, loggerKey{}, logger)
+}
+
+// FromContext returns the logger carried by the context, or the default logger when there is none
+func FromContext(ctx context.Context) Logger {
+	if logger, ok := ctx.Value(loggerKey{}).(Logger); ok {
+		return logger
+	}
+	return Default()
+}
@@ -0,0 +1,15 @@
+package logging
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestFromContext(t *testing.T) {
+	assert.Equal(t, Default(), FromContext(context.Background()))
+
+	recorder := &recordingLogger{}
+	ctx := NewContext(context.Background(), recorder)
+	assert.Equal(t, recorder, FromContext(ctx))
+}
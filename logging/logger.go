@@ -0,0 +1,86 @@
+// Package logging defines the logger used across the server, client and interceptor packages.
+// Adapters are provided for logrus, the standard library log and slog packages and zap-style structured loggers,
+// allowing the library logs to be routed into any pipeline or silenced in tests
+package logging
+
+import (
+	"fmt"
+	"sync"
+)
+
+// Logger is a leveled structured logger. The keyvals are alternating keys and values, e.g.
+// logger.Info("request finished", "method", method, "took", took)
+type Logger interface {
+	Debug(msg string, keyvals ...interface{})
+	Info(msg string, keyvals ...interface{})
+	Warn(msg string, keyvals ...interface{})
+	Error(msg string, keyvals ...interface{})
+	// With returns a logger adding the keyvals to every entry
+	With(keyvals ...interface{}) Logger
+}
+
+var (
+	defaultMu     sync.RWMutex
+	defaultLogger Logger = NewLogrusLogger(nil)
+)
+
+// Default returns the logger used by the components not configured with a logger.
+// It writes into the standard logrus logger unless replaced by SetDefault
+func Default() Logger {
+	defaultMu.RLock()
+	defer defaultMu.RUnlock()
+	return defaultLogger
+}
+
+// SetDefault replaces the logger used by the components not configured with a logger
+func SetDefault(logger Logger) {
+	if logger == nil {
+		logger = Nop()
+	}
+	defaultMu.Lock()
+	defer defaultMu.Unlock()
+	defaultLogger = logger
+}
+
+// OrDefault returns the logger, or the default logger when it is nil
+func OrDefault(logger Logger) Logger {
+	if logger == nil {
+		return Default()
+	}
+	return logger
+}
+
+// Nop returns a logger discarding every entry
+func Nop() Logger {
+	return nopLogger{}
+}
+
+type nopLogger struct{}
+
+func (nopLogger) Debug(msg string, keyvals ...interface{}) {}
+func (nopLogger) Info(msg string, keyvals ...interface{})  {}
+func (nopLogger) Warn(msg string, keyvals ...interface{})  {}
+func (nopLogger) Error(msg string, keyvals ...interface{}) {}
+func (l nopLogger) With(keyvals ...interface{}) Logger     { return l }
+
+// missingValue is used when the keyvals have a key without value
+const missingValue = "(MISSING)"
+
+// pairs iterates over the keyvals as key/value pairs
+func pairs(keyvals []interface{}, fn func(key string, value interface{})) {
+	for i := 0; i < len(keyvals); i += 2 {
+		key := fmt.Sprint(keyvals[i])
+		if i+1 >= len(keyvals) {
+			fn(key, missingValue)
+			return
+		}
+		fn(key, keyvals[i+1])
+	}
+}
+
+// merge returns a new slice with the keyvals appended to the base keyvals
+func merge(base []interface{}, keyvals []interface{}) []interface{} {
+	merged := make([]interface{}, 0, len(base)+len(keyvals))
+	merged = append(merged, base...)
+	return append(merged, keyvals...)
+}
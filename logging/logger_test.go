@@ -0,0 +1,60 @@
+package logging
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestSetDefault(t *testing.T) {
+	previous := Default()
+	defer SetDefault(previous)
+
+	recorder := &recordingLogger{}
+	SetDefault(recorder)
+	assert.Equal(t, recorder, Default())
+	assert.Equal(t, recorder, OrDefault(nil))
+
+	other := Nop()
+	assert.Equal(t, other, OrDefault(other))
+
+	SetDefault(nil)
+	assert.Equal(t, Nop(), Default())
+}
+
+func Test_pairs(t *testing.T) {
+	var keys []string
+	var values []interface{}
+	pairs([]interface{}{"a", 1, 2, "b", "c"}, func(key string, value interface{}) {
+		keys = append(keys, key)
+		values = append(values, value)
+	})
+	assert.Equal(t, []string{"a", "2", "c"}, keys)
+	assert.Equal(t, []interface{}{1, "b", missingValue}, values)
+}
+
+func Test_merge(t *testing.T) {
+	base := make([]interface{}, 2, 10)
+	base[0], base[1] = "a", 1
+	first := merge(base, []interface{}{"b", 2})
+	second := merge(base, []interface{}{"c", 3})
+	assert.Equal(t, []interface{}{"a", 1, "b", 2}, first)
+	assert.Equal(t, []interface{}{"a", 1, "c", 3}, second)
+}
+
+type recordingLogger struct {
+	entries []string
+}
+
+func (l *recordingLogger) Debug(msg string, keyvals ...interface{}) {
+	l.entries = append(l.entries, msg)
+}
+func (l *recordingLogger) Info(msg string, keyvals ...interface{}) {
+	l.entries = append(l.entries, msg)
+}
+func (l *recordingLogger) Warn(msg string, keyvals ...interface{}) {
+	l.entries = append(l.entries, msg)
+}
+func (l *recordingLogger) Error(msg string, keyvals ...interface{}) {
+	l.entries = append(l.entries, msg)
+}
+func (l *recordingLogger) With(keyvals ...interface{}) Logger { return l }
@@ -0,0 +1,48 @@
+package logging
+
+import (
+	"github.com/sirupsen/logrus"
+)
+
+type logrusLogger struct {
+	logger logrus.FieldLogger
+}
+
+// NewLogrusLogger adapts a logrus logger. Nil uses the standard logrus logger
+func NewLogrusLogger(logger logrus.FieldLogger) Logger {
+	if logger == nil {
+		logger = logrus.StandardLogger()
+	}
+	return &logrusLogger{logger: logger}
+}
+
+func (l *logrusLogger) Debug(msg string, keyvals ...interface{}) {
+	l.entry(keyvals).Debug(msg)
+}
+
+func (l *logrusLogger) Info(msg string, keyvals ...interface{}) {
+	l.entry(keyvals).Info(msg)
+}
+
+func (l *logrusLogger) Warn(msg string, keyvals ...interface{}) {
+	l.entry(keyvals).Warn(msg)
+}
+
+func (l *logrusLogger) Error(msg string, keyvals ...interface{}) {
+	l.entry(keyvals).Error(msg)
+}
+
+func (l *logrusLogger) With(keyvals ...interface{}) Logger {
+	return &logrusLogger{logger: l.entry(keyvals)}
+}
+
+func (l *logrusLogger) entry(keyvals []interface{}) logrus.FieldLogger {
+	if len(keyvals) == 0 {
+		return l.logger
+	}
+	fields := make(logrus.Fields, len(keyvals)/2+1)
+	pairs(keyvals, func(key string, value interface{}) {
+		fields[key] = value
+	})
+	return l.logger.WithFields(fields)
+}
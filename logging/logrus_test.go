@@ -0,0 +1,23 @@
+package logging
+
+import (
+	"bytes"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestLogrusLogger(t *testing.T) {
+	var buf bytes.Buffer
+	base := logrus.New()
+	base.Out = &buf
+	base.Formatter = &logrus.TextFormatter{DisableTimestamp: true}
+
+	logger := NewLogrusLogger(base).With("service", "greeter")
+	logger.Warn("call failed", "method", "SayHello")
+	assert.Equal(t, "level=warning msg=\"call failed\" method=SayHello service=greeter\n", buf.String())
+
+	buf.Reset()
+	logger.Debug("hidden")
+	assert.Empty(t, buf.String())
+}
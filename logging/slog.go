@@ -0,0 +1,41 @@
+//go:build go1.21
+// +build go1.21
+
+package logging
+
+import (
+	"context"
+	"log/slog"
+)
+
+type slogLogger struct {
+	logger *slog.Logger
+}
+
+// NewSlogLogger adapts a logger from the standard library log/slog package. Nil uses slog.Default()
+func NewSlogLogger(logger *slog.Logger) Logger {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	return &slogLogger{logger: logger}
+}
+
+func (l *slogLogger) Debug(msg string, keyvals ...interface{}) {
+	l.logger.Log(context.Background(), slog.LevelDebug, msg, keyvals...)
+}
+
+func (l *slogLogger) Info(msg string, keyvals ...interface{}) {
+	l.logger.Log(context.Background(), slog.LevelInfo, msg, keyvals...)
+}
+
+func (l *slogLogger) Warn(msg string, keyvals ...interface{}) {
+	l.logger.Log(context.Background(), slog.LevelWarn, msg, keyvals...)
+}
+
+func (l *slogLogger) Error(msg string, keyvals ...interface{}) {
+	l.logger.Log(context.Background(), slog.LevelError, msg, keyvals...)
+}
+
+func (l *slogLogger) With(keyvals ...interface{}) Logger {
+	return &slogLogger{logger: l.logger.With(keyvals...)}
+}
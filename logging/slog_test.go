@@ -0,0 +1,26 @@
+//go:build go1.21
+// +build go1.21
+
+package logging
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"log/slog"
+	"testing"
+)
+
+func TestSlogLogger(t *testing.T) {
+	var buf bytes.Buffer
+	handler := slog.NewTextHandler(&buf, &slog.HandlerOptions{
+		ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+			if a.Key == slog.TimeKey {
+				return slog.Attr{}
+			}
+			return a
+		},
+	})
+	logger := NewSlogLogger(slog.New(handler)).With("service", "greeter")
+	logger.Warn("call failed", "method", "SayHello")
+	assert.Equal(t, "level=WARN msg=\"call failed\" service=greeter method=SayHello\n", buf.String())
+}
@@ -0,0 +1,52 @@
+package logging
+
+import (
+	"fmt"
+	"log"
+	"strings"
+)
+
+type stdLogger struct {
+	logger  *log.Logger
+	keyvals []interface{}
+}
+
+// NewStdLogger adapts a logger from the standard library log package.
+// Entries are written as "LEVEL msg key=value ...". Nil uses the standard logger
+func NewStdLogger(logger *log.Logger) Logger {
+	if logger == nil {
+		logger = log.New(log.Writer(), log.Prefix(), log.Flags())
+	}
+	return &stdLogger{logger: logger}
+}
+
+func (l *stdLogger) Debug(msg string, keyvals ...interface{}) {
+	l.print("DEBUG", msg, keyvals)
+}
+
+func (l *stdLogger) Info(msg string, keyvals ...interface{}) {
+	l.print("INFO", msg, keyvals)
+}
+
+func (l *stdLogger) Warn(msg string, keyvals ...interface{}) {
+	l.print("WARN", msg, keyvals)
+}
+
+func (l *stdLogger) Error(msg string, keyvals ...interface{}) {
+	l.print("ERROR", msg, keyvals)
+}
+
+func (l *stdLogger) With(keyvals ...interface{}) Logger {
+	return &stdLogger{logger: l.logger, keyvals: merge(l.keyvals, keyvals)}
+}
+
+func (l *stdLogger) print(level string, msg string, keyvals []interface{}) {
+	var b strings.Builder
+	b.WriteString(level)
+	b.WriteString(" ")
+	b.WriteString(msg)
+	pairs(merge(l.keyvals, keyvals), func(key string, value interface{}) {
+		fmt.Fprintf(&b, " %s=%v", key, value)
+	})
+	l.logger.Output(3, b.String())
+}
@@ -0,0 +1,15 @@
+package logging
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"log"
+	"testing"
+)
+
+func TestStdLogger(t *testing.T) {
+	var buf bytes.Buffer
+	logger := NewStdLogger(log.New(&buf, "", 0)).With("service", "greeter")
+	logger.Error("call errored", "method", "SayHello", "took")
+	assert.Equal(t, "ERROR call errored service=greeter method=SayHello took=(MISSING)\n", buf.String())
+}
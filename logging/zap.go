@@ -0,0 +1,40 @@
+package logging
+
+// ZapSugaredLogger is the subset of the zap.SugaredLogger methods used by the adapter.
+// Any structured logger exposing these methods can be adapted, without depending on zap
+type ZapSugaredLogger interface {
+	Debugw(msg string, keysAndValues ...interface{})
+	Infow(msg string, keysAndValues ...interface{})
+	Warnw(msg string, keysAndValues ...interface{})
+	Errorw(msg string, keysAndValues ...interface{})
+}
+
+type zapLogger struct {
+	logger  ZapSugaredLogger
+	keyvals []interface{}
+}
+
+// NewZapLogger adapts a zap-style sugared logger, e.g. zap.L().Sugar()
+func NewZapLogger(logger ZapSugaredLogger) Logger {
+	return &zapLogger{logger: logger}
+}
+
+func (l *zapLogger) Debug(msg string, keyvals ...interface{}) {
+	l.logger.Debugw(msg, merge(l.keyvals, keyvals)...)
+}
+
+func (l *zapLogger) Info(msg string, keyvals ...interface{}) {
+	l.logger.Infow(msg, merge(l.keyvals, keyvals)...)
+}
+
+func (l *zapLogger) Warn(msg string, keyvals ...interface{}) {
+	l.logger.Warnw(msg, merge(l.keyvals, keyvals)...)
+}
+
+func (l *zapLogger) Error(msg string, keyvals ...interface{}) {
+	l.logger.Errorw(msg, merge(l.keyvals, keyvals)...)
+}
+
+func (l *zapLogger) With(keyvals ...interface{}) Logger {
+	return &zapLogger{logger: l.logger, keyvals: merge(l.keyvals, keyvals)}
+}
@@ -0,0 +1,30 @@
+package logging
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestZapLogger(t *testing.T) {
+	sugared := &sugaredLoggerMock{}
+	logger := NewZapLogger(sugared).With("service", "greeter")
+	logger.Info("call succeeded", "method", "SayHello")
+	assert.Equal(t, "info", sugared.level)
+	assert.Equal(t, "call succeeded", sugared.msg)
+	assert.Equal(t, []interface{}{"service", "greeter", "method", "SayHello"}, sugared.keysAndValues)
+}
+
+type sugaredLoggerMock struct {
+	level         string
+	msg           string
+	keysAndValues []interface{}
+}
+
+func (l *sugaredLoggerMock) record(level string, msg string, keysAndValues []interface{}) {
+	l.level, l.msg, l.keysAndValues = level, msg, keysAndValues
+}
+
+func (l *sugaredLoggerMock) Debugw(msg string, kv ...interface{}) { l.record("debug", msg, kv) }
+func (l *sugaredLoggerMock) Infow(msg string, kv ...interface{})  { l.record("info", msg, kv) }
+func (l *sugaredLoggerMock) Warnw(msg string, kv ...interface{})  { l.record("warn", msg, kv) }
+func (l *sugaredLoggerMock) Errorw(msg string, kv ...interface{}) { l.record("error", msg, kv) }
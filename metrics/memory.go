@@ -0,0 +1,90 @@
+package metrics
+
+import (
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Memory is a Provider keeping the metrics in memory, handy in tests or to expose them through a debug endpoint
+type Memory struct {
+	mu           sync.Mutex
+	values       map[string]float64
+	observations map[string][]float64
+}
+
+// NewMemory creates an empty in-memory provider
+func NewMemory() *Memory {
+	return &Memory{
+		values:       make(map[string]float64),
+		observations: make(map[string][]float64),
+	}
+}
+
+// Counter returns the counter with the name
+func (m *Memory) Counter(name string) Counter {
+	return memoryMetric{memory: m, name: name}
+}
+
+// Gauge returns the gauge with the name
+func (m *Memory) Gauge(name string) Gauge {
+	return memoryMetric{memory: m, name: name}
+}
+
+// Histogram returns the histogram with the name
+func (m *Memory) Histogram(name string) Histogram {
+	return memoryMetric{memory: m, name: name}
+}
+
+// Value returns the value of the counter or gauge with the labels, in any order
+func (m *Memory) Value(name string, labels ...string) float64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.values[seriesKey(name, labels)]
+}
+
+// Observations returns the values observed by the histogram with the labels, in any order
+func (m *Memory) Observations(name string, labels ...string) []float64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	observed := m.observations[seriesKey(name, labels)]
+	return append([]float64(nil), observed...)
+}
+
+type memoryMetric struct {
+	memory *Memory
+	name   string
+}
+
+func (c memoryMetric) Add(delta float64, labels ...string) {
+	c.memory.mu.Lock()
+	defer c.memory.mu.Unlock()
+	c.memory.values[seriesKey(c.name, labels)] += delta
+}
+
+func (c memoryMetric) Set(value float64, labels ...string) {
+	c.memory.mu.Lock()
+	defer c.memory.mu.Unlock()
+	c.memory.values[seriesKey(c.name, labels)] = value
+}
+
+func (c memoryMetric) Observe(value float64, labels ...string) {
+	c.memory.mu.Lock()
+	defer c.memory.mu.Unlock()
+	key := seriesKey(c.name, labels)
+	c.memory.observations[key] = append(c.memory.observations[key], value)
+}
+
+// seriesKey identifies the series of the metric, sorting the label pairs
+func seriesKey(name string, labels []string) string {
+	pairs := make([]string, 0, (len(labels)+1)/2)
+	for i := 0; i < len(labels); i += 2 {
+		value := ""
+		if i+1 < len(labels) {
+			value = labels[i+1]
+		}
+		pairs = append(pairs, labels[i]+"="+value)
+	}
+	sort.Strings(pairs)
+	return name + "{" + strings.Join(pairs, ",") + "}"
+}
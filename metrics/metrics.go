@@ -0,0 +1,78 @@
+// Package metrics defines the minimal metrics abstraction used by the interceptors and the client components.
+// Adapt a Provider to Prometheus, StatsD or any other backend; the default provider discards everything
+package metrics
+
+import (
+	"sync"
+)
+
+// Counter is a monotonically increasing value. The labels are alternating label names and values, e.g.
+// counter.Add(1, "method", fullMethod)
+type Counter interface {
+	Add(delta float64, labels ...string)
+}
+
+// Gauge is a value going up and down
+type Gauge interface {
+	Set(value float64, labels ...string)
+}
+
+// Histogram records the distribution of the observed values
+type Histogram interface {
+	Observe(value float64, labels ...string)
+}
+
+// Provider creates the named metrics. It may return the same metric for the same name
+type Provider interface {
+	Counter(name string) Counter
+	Gauge(name string) Gauge
+	Histogram(name string) Histogram
+}
+
+var (
+	defaultMu       sync.RWMutex
+	defaultProvider Provider = Nop()
+)
+
+// Default returns the provider used by the components not configured with one.
+// It discards every metric unless replaced by SetDefault
+func Default() Provider {
+	defaultMu.RLock()
+	defer defaultMu.RUnlock()
+	return defaultProvider
+}
+
+// SetDefault replaces the provider used by the components not configured with one
+func SetDefault(provider Provider) {
+	if provider == nil {
+		provider = Nop()
+	}
+	defaultMu.Lock()
+	defer defaultMu.Unlock()
+	defaultProvider = provider
+}
+
+// OrDefault returns the provider, or the default provider when it is nil
+func OrDefault(provider Provider) Provider {
+	if provider == nil {
+		return Default()
+	}
+	return provider
+}
+
+// Nop returns a provider discarding every metric
+func Nop() Provider {
+	return nopProvider{}
+}
+
+type nopProvider struct{}
+
+func (nopProvider) Counter(name string) Counter     { return nopMetric{} }
+func (nopProvider) Gauge(name string) Gauge         { return nopMetric{} }
+func (nopProvider) Histogram(name string) Histogram { return nopMetric{} }
+
+type nopMetric struct{}
+
+func (nopMetric) Add(delta float64, labels ...string)     {}
+func (nopMetric) Set(value float64, labels ...string)     {}
+func (nopMetric) Observe(value float64, labels ...string) {}
@@ -0,0 +1,34 @@
+package metrics
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestMemory(t *testing.T) {
+	m := NewMemory()
+	m.Counter("calls").Add(1, "method", "/svc/A", "code", "OK")
+	m.Counter("calls").Add(2, "code", "OK", "method", "/svc/A")
+	m.Counter("calls").Add(1, "method", "/svc/B", "code", "OK")
+	m.Gauge("in_flight").Set(3)
+	m.Gauge("in_flight").Set(2)
+	m.Histogram("latency").Observe(0.5, "method", "/svc/A")
+	m.Histogram("latency").Observe(1.5, "method", "/svc/A")
+
+	assert.Equal(t, float64(3), m.Value("calls", "method", "/svc/A", "code", "OK"))
+	assert.Equal(t, float64(1), m.Value("calls", "code", "OK", "method", "/svc/B"))
+	assert.Equal(t, float64(0), m.Value("calls"))
+	assert.Equal(t, float64(2), m.Value("in_flight"))
+	assert.Equal(t, []float64{0.5, 1.5}, m.Observations("latency", "method", "/svc/A"))
+}
+
+func TestDefault(t *testing.T) {
+	assert.Equal(t, Nop(), Default())
+	m := NewMemory()
+	SetDefault(m)
+	defer SetDefault(nil)
+	assert.Equal(t, m, Default())
+	assert.Equal(t, m, OrDefault(nil))
+	other := NewMemory()
+	assert.Equal(t, other, OrDefault(other))
+}
@@ -0,0 +1,60 @@
+// Package requestid carries the request id of a call across the server and client interceptors
+package requestid
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"google.golang.org/grpc/metadata"
+	"time"
+)
+
+// Header is the metadata key carrying the request id
+const Header = "x-request-id"
+
+type requestIDKey struct{}
+
+// NewContext returns a context carrying the request id
+func NewContext(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// FromContext returns the request id carried by the context.
+// It falls back to the request id sent by the client in the incoming metadata
+func FromContext(ctx context.Context) (string, bool) {
+	if id, ok := ctx.Value(requestIDKey{}).(string); ok && id != "" {
+		return id, true
+	}
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return "", false
+	}
+	if values := md.Get(Header); len(values) > 0 && values[0] != "" {
+		return values[0], true
+	}
+	return "", false
+}
+
+// New generates a time ordered UUIDv7 request id
+func New() string {
+	var uuid [16]byte
+	binary.BigEndian.PutUint64(uuid[0:8], uint64(time.Now().UnixNano()/int64(time.Millisecond))<<16)
+	if _, err := rand.Read(uuid[6:]); err != nil {
+		panic(err)
+	}
+	uuid[6] = (uuid[6] & 0x0f) | 0x70 // version 7
+	uuid[8] = (uuid[8] & 0x3f) | 0x80 // RFC 4122 variant
+
+	var buf [36]byte
+	hex.Encode(buf[0:8], uuid[0:4])
+	buf[8] = '-'
+	hex.Encode(buf[9:13], uuid[4:6])
+	buf[13] = '-'
+	hex.Encode(buf[14:18], uuid[6:8])
+	buf[18] = '-'
+	hex.Encode(buf[19:23], uuid[8:10])
+	buf[23] = '-'
+	hex.Encode(buf[24:], uuid[10:])
+	return string(buf[:])
+}
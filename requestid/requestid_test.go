@@ -0,0 +1,32 @@
+package requestid
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/metadata"
+	"regexp"
+	"testing"
+)
+
+var uuidV7 = regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-7[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+
+func TestNew(t *testing.T) {
+	first := New()
+	second := New()
+	assert.Regexp(t, uuidV7, first)
+	assert.NotEqual(t, first, second)
+	assert.True(t, first[:8] <= second[:8])
+}
+
+func TestFromContext(t *testing.T) {
+	_, ok := FromContext(context.Background())
+	assert.False(t, ok)
+
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(Header, "incoming"))
+	id, ok := FromContext(ctx)
+	assert.True(t, ok)
+	assert.Equal(t, "incoming", id)
+
+	id, _ = FromContext(NewContext(ctx, "stored"))
+	assert.Equal(t, "stored", id)
+}
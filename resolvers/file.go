@@ -0,0 +1,234 @@
+package resolvers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/apssouza22/grpc-production-go/balancing"
+	"github.com/apssouza22/grpc-production-go/logging"
+	"google.golang.org/grpc/attributes"
+	"google.golang.org/grpc/resolver"
+	"gopkg.in/yaml.v2"
+	"io/ioutil"
+	"net"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// FileScheme is the scheme of the file resolver targets, e.g. file:///etc/myapp/endpoints.yaml.
+// The path is always absolute
+const FileScheme = "file"
+
+// DefaultFilePollInterval is how often the file resolver checks the file for changes when no interval is configured
+const DefaultFilePollInterval = time.Second
+
+// Endpoint is a backend listed in the endpoints file
+type Endpoint struct {
+	Address string `json:"address" yaml:"address"`
+	// Weight is used by the balancing.WeightedRoundRobin policy. Zero means 1
+	Weight uint32 `json:"weight,omitempty" yaml:"weight,omitempty"`
+	// Metadata is exposed to the balancers, see Metadata
+	Metadata map[string]string `json:"metadata,omitempty" yaml:"metadata,omitempty"`
+}
+
+// endpointsFile is the content of the endpoints file, in JSON or in YAML when the extension is .yaml or .yml
+type endpointsFile struct {
+	Endpoints []Endpoint `json:"endpoints" yaml:"endpoints"`
+}
+
+type metadataKey struct{}
+
+// Metadata returns the metadata of the address resolved from the endpoints file, nil when it has none
+func Metadata(addr resolver.Address) map[string]string {
+	if addr.Attributes == nil {
+		return nil
+	}
+	md, _ := addr.Attributes.Value(metadataKey{}).(map[string]string)
+	return md
+}
+
+// FileOption configures the file resolver
+type FileOption func(*fileBuilder)
+
+// WithFilePollInterval sets how often the file is checked for changes. The default is DefaultFilePollInterval
+func WithFilePollInterval(interval time.Duration) FileOption {
+	return func(b *fileBuilder) {
+		b.interval = interval
+	}
+}
+
+// WithFileLogger sets the logger receiving the reloads and the invalid files. The default logger is used otherwise
+func WithFileLogger(logger logging.Logger) FileOption {
+	return func(b *fileBuilder) {
+		b.logger = logger
+	}
+}
+
+// NewFileBuilder returns the builder of the file resolver. It resolves the endpoints listed in the file of the target
+// and pushes the changes to the connection as soon as they are detected. An invalid or empty file is reported and
+// ignored, the connection keeps the last valid endpoints
+func NewFileBuilder(opts ...FileOption) resolver.Builder {
+	b := &fileBuilder{interval: DefaultFilePollInterval}
+	for _, opt := range opts {
+		opt(b)
+	}
+	b.logger = logging.OrDefault(b.logger)
+	return b
+}
+
+type fileBuilder struct {
+	interval time.Duration
+	logger   logging.Logger
+}
+
+func (b *fileBuilder) Build(target resolver.Target, cc resolver.ClientConn, opts resolver.BuildOptions) (resolver.Resolver, error) {
+	path := "/" + target.Endpoint
+	r := &fileResolver{
+		path:     path,
+		cc:       cc,
+		logger:   b.logger.With("path", path),
+		previous: make(map[string]resolver.Address),
+		reload:   make(chan struct{}, 1),
+		done:     make(chan struct{}),
+	}
+	if err := r.load(); err != nil {
+		return nil, err
+	}
+	r.wg.Add(1)
+	go r.watch(b.interval)
+	return r, nil
+}
+
+func (b *fileBuilder) Scheme() string {
+	return FileScheme
+}
+
+type fileResolver struct {
+	path   string
+	cc     resolver.ClientConn
+	logger logging.Logger
+	// content is the last content read, valid or not
+	content []byte
+	// previous are the addresses last pushed by key. They are reused while unchanged, so the connection keeps their sub-connections
+	previous map[string]resolver.Address
+	reload   chan struct{}
+	done     chan struct{}
+	wg       sync.WaitGroup
+}
+
+// ResolveNow reloads the file without waiting for the next check
+func (r *fileResolver) ResolveNow(resolver.ResolveNowOptions) {
+	select {
+	case r.reload <- struct{}{}:
+	default:
+	}
+}
+
+func (r *fileResolver) Close() {
+	close(r.done)
+	r.wg.Wait()
+}
+
+func (r *fileResolver) watch(interval time.Duration) {
+	defer r.wg.Done()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-r.done:
+			return
+		case <-ticker.C:
+		case <-r.reload:
+		}
+		if err := r.load(); err != nil {
+			r.logger.Warn("invalid endpoints file, keeping the last endpoints", "err", err)
+			r.cc.ReportError(err)
+		}
+	}
+}
+
+// load reads the file and pushes the endpoints when the content changed
+func (r *fileResolver) load() error {
+	content, err := ioutil.ReadFile(r.path)
+	if err != nil {
+		return fmt.Errorf("unable to read the endpoints file: %w", err)
+	}
+	if r.content != nil && bytes.Equal(content, r.content) {
+		return nil
+	}
+	r.content = content
+	endpoints, err := parseEndpoints(r.path, content)
+	if err != nil {
+		return err
+	}
+
+	addrs := make([]resolver.Address, 0, len(endpoints))
+	current := make(map[string]resolver.Address, len(endpoints))
+	for _, endpoint := range endpoints {
+		key := endpointKey(endpoint)
+		addr, ok := r.previous[key]
+		if !ok {
+			addr = resolver.Address{Addr: endpoint.Address}
+			if endpoint.Weight > 0 {
+				addr = balancing.WithWeight(addr, endpoint.Weight)
+			}
+			if len(endpoint.Metadata) > 0 {
+				addr.Attributes = attributes.New(metadataKey{}, endpoint.Metadata)
+			}
+		}
+		current[key] = addr
+		addrs = append(addrs, addr)
+	}
+	r.previous = current
+	r.logger.Info("endpoints file loaded", "endpoints", len(addrs))
+	r.cc.UpdateState(resolver.State{Addresses: addrs})
+	return nil
+}
+
+func parseEndpoints(path string, content []byte) ([]Endpoint, error) {
+	var file endpointsFile
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		if err := yaml.UnmarshalStrict(content, &file); err != nil {
+			return nil, fmt.Errorf("invalid endpoints file %s: %w", path, err)
+		}
+	default:
+		decoder := json.NewDecoder(bytes.NewReader(content))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(&file); err != nil {
+			return nil, fmt.Errorf("invalid endpoints file %s: %w", path, err)
+		}
+	}
+	if len(file.Endpoints) == 0 {
+		return nil, fmt.Errorf("endpoints file %s without endpoint", path)
+	}
+	seen := make(map[string]bool, len(file.Endpoints))
+	for _, endpoint := range file.Endpoints {
+		if _, _, err := net.SplitHostPort(endpoint.Address); err != nil {
+			return nil, fmt.Errorf("invalid endpoint address %q: %w", endpoint.Address, err)
+		}
+		if seen[endpoint.Address] {
+			return nil, fmt.Errorf("duplicate endpoint address %q", endpoint.Address)
+		}
+		seen[endpoint.Address] = true
+	}
+	return file.Endpoints, nil
+}
+
+// endpointKey identifies the endpoint with its weight and metadata
+func endpointKey(endpoint Endpoint) string {
+	keys := make([]string, 0, len(endpoint.Metadata))
+	for key := range endpoint.Metadata {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s\x00%d", endpoint.Address, endpoint.Weight)
+	for _, key := range keys {
+		fmt.Fprintf(&b, "\x00%s=%s", key, endpoint.Metadata[key])
+	}
+	return b.String()
+}
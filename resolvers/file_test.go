@@ -0,0 +1,92 @@
+package resolvers
+
+import (
+	"github.com/apssouza22/grpc-production-go/balancing"
+	"github.com/apssouza22/grpc-production-go/logging"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/resolver"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestFileResolver(t *testing.T, path string, cc *fakeClientConn) resolver.Resolver {
+	builder := NewFileBuilder(WithFilePollInterval(10*time.Millisecond), WithFileLogger(logging.Nop()))
+	r, err := builder.Build(resolver.Target{Scheme: FileScheme, Endpoint: strings.TrimPrefix(path, "/")}, cc, resolver.BuildOptions{})
+	assert.NoError(t, err)
+	return r
+}
+
+// writeEndpoints replaces the file atomically, so the resolver never reads it half written
+func writeEndpoints(t *testing.T, path string, content string) {
+	tmp := path + ".tmp"
+	assert.NoError(t, ioutil.WriteFile(tmp, []byte(content), 0600))
+	assert.NoError(t, os.Rename(tmp, path))
+}
+
+func TestFileResolver(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "endpoints")
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "endpoints.yaml")
+	writeEndpoints(t, path, `
+endpoints:
+  - address: host1:50051
+    weight: 3
+    metadata:
+      zone: a
+  - address: host2:50051
+`)
+
+	cc := newFakeClientConn()
+	r := newTestFileResolver(t, path, cc)
+	defer r.Close()
+	state := <-cc.states
+	assert.Equal(t, []string{"host1:50051", "host2:50051"}, addrs(state))
+	assert.Equal(t, uint32(3), balancing.Weight(state.Addresses[0]))
+	assert.Equal(t, map[string]string{"zone": "a"}, Metadata(state.Addresses[0]))
+	assert.Nil(t, Metadata(state.Addresses[1]))
+
+	writeEndpoints(t, path, `
+endpoints:
+  - address: host1:50051
+    weight: 3
+    metadata:
+      zone: a
+  - address: host3:50051
+`)
+	r.ResolveNow(resolver.ResolveNowOptions{})
+	updated := <-cc.states
+	assert.Equal(t, []string{"host1:50051", "host3:50051"}, addrs(updated))
+	// The unchanged endpoint keeps the same address, so the connection keeps its sub-connection
+	assert.True(t, state.Addresses[0] == updated.Addresses[0])
+}
+
+func TestFileResolverKeepsLastEndpointsOnInvalidFile(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "endpoints")
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "endpoints.json")
+	writeEndpoints(t, path, `{"endpoints": [{"address": "host1:50051"}]}`)
+
+	cc := newFakeClientConn()
+	r := newTestFileResolver(t, path, cc)
+	defer r.Close()
+	assert.Equal(t, []string{"host1:50051"}, addrs(<-cc.states))
+
+	writeEndpoints(t, path, `{"endpoints": []}`)
+	assert.Contains(t, (<-cc.errs).Error(), "without endpoint")
+	writeEndpoints(t, path, `{"endpoints": [{"address": "host2:50051", "port": 1}]}`)
+	assert.Contains(t, (<-cc.errs).Error(), `unknown field "port"`)
+
+	writeEndpoints(t, path, `{"endpoints": [{"address": "host2:50051"}]}`)
+	assert.Equal(t, []string{"host2:50051"}, addrs(<-cc.states))
+	assert.Len(t, cc.states, 0)
+}
+
+func TestFileResolverInvalidTarget(t *testing.T) {
+	builder := NewFileBuilder(WithFileLogger(logging.Nop()))
+	_, err := builder.Build(resolver.Target{Scheme: FileScheme, Endpoint: "does/not/exist.json"}, newFakeClientConn(), resolver.BuildOptions{})
+	assert.Error(t, err)
+}
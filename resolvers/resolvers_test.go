@@ -0,0 +1,47 @@
+package resolvers
+
+import (
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/resolver"
+	"google.golang.org/grpc/serviceconfig"
+	"testing"
+)
+
+// fakeClientConn records the states and errors pushed by the resolvers
+type fakeClientConn struct {
+	states chan resolver.State
+	errs   chan error
+}
+
+func newFakeClientConn() *fakeClientConn {
+	return &fakeClientConn{states: make(chan resolver.State, 10), errs: make(chan error, 10)}
+}
+
+func (c *fakeClientConn) UpdateState(state resolver.State)        { c.states <- state }
+func (c *fakeClientConn) ReportError(err error)                   { c.errs <- err }
+func (c *fakeClientConn) NewAddress(addresses []resolver.Address) {}
+func (c *fakeClientConn) NewServiceConfig(serviceConfig string)   {}
+func (c *fakeClientConn) ParseServiceConfig(serviceConfigJSON string) *serviceconfig.ParseResult {
+	return nil
+}
+
+func addrs(state resolver.State) []string {
+	var result []string
+	for _, addr := range state.Addresses {
+		result = append(result, addr.Addr)
+	}
+	return result
+}
+
+func TestStaticResolver(t *testing.T) {
+	cc := newFakeClientConn()
+	r, err := NewStaticBuilder().Build(resolver.Target{Scheme: StaticScheme, Endpoint: "host1:50051, host2:50052"}, cc, resolver.BuildOptions{})
+	assert.NoError(t, err)
+	defer r.Close()
+	assert.Equal(t, []string{"host1:50051", "host2:50052"}, addrs(<-cc.states))
+
+	_, err = NewStaticBuilder().Build(resolver.Target{Scheme: StaticScheme, Endpoint: "host1"}, cc, resolver.BuildOptions{})
+	assert.Error(t, err)
+	_, err = NewStaticBuilder().Build(resolver.Target{Scheme: StaticScheme, Endpoint: ""}, cc, resolver.BuildOptions{})
+	assert.Error(t, err)
+}
@@ -0,0 +1,50 @@
+// Package resolvers provides name resolvers to reach several backends without DNS.
+// Register them on a connection with GrpcConnBuilder.WithResolvers
+package resolvers
+
+import (
+	"fmt"
+	"google.golang.org/grpc/resolver"
+	"net"
+	"strings"
+)
+
+// StaticScheme is the scheme of the static resolver targets, e.g. static:///host1:50051,host2:50051
+const StaticScheme = "static"
+
+// NewStaticBuilder returns the builder of the static resolver, resolving the comma separated list of addresses of the target
+func NewStaticBuilder() resolver.Builder {
+	return staticBuilder{}
+}
+
+type staticBuilder struct{}
+
+func (staticBuilder) Build(target resolver.Target, cc resolver.ClientConn, opts resolver.BuildOptions) (resolver.Resolver, error) {
+	var addrs []resolver.Address
+	for _, addr := range strings.Split(target.Endpoint, ",") {
+		addr = strings.TrimSpace(addr)
+		if addr == "" {
+			continue
+		}
+		if _, _, err := net.SplitHostPort(addr); err != nil {
+			return nil, fmt.Errorf("invalid static address %q: %w", addr, err)
+		}
+		addrs = append(addrs, resolver.Address{Addr: addr})
+	}
+	if len(addrs) == 0 {
+		return nil, fmt.Errorf("static target %q without address", target.Endpoint)
+	}
+	cc.UpdateState(resolver.State{Addresses: addrs})
+	return staticResolver{}, nil
+}
+
+func (staticBuilder) Scheme() string {
+	return StaticScheme
+}
+
+// staticResolver has nothing to do once the addresses pushed
+type staticResolver struct{}
+
+func (staticResolver) ResolveNow(resolver.ResolveNowOptions) {}
+
+func (staticResolver) Close() {}
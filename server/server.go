@@ -4,8 +4,8 @@ import (
 	"crypto/tls"
 	"errors"
 	"fmt"
+	"github.com/apssouza22/grpc-production-go/logging"
 	grpc_middleware "github.com/grpc-ecosystem/go-grpc-middleware"
-	log "github.com/sirupsen/logrus"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials"
 	"google.golang.org/grpc/health"
@@ -33,11 +33,13 @@ type GrpcServerBuilder struct {
 	shutdownHook              func()
 	enabledHealthCheck        bool
 	disableDefaultHealthCheck bool
+	logger                    logging.Logger
 }
 
 type grpcServer struct {
 	server   *grpc.Server
 	listener net.Listener
+	logger   logging.Logger
 }
 
 func (s grpcServer) GetListener() net.Listener {
@@ -86,6 +88,11 @@ func (sb *GrpcServerBuilder) SetUnaryInterceptors(interceptors []grpc.UnaryServe
 	sb.AddOption(chain)
 }
 
+// SetLogger sets the logger used by the server. The default logger is used otherwise
+func (sb *GrpcServerBuilder) SetLogger(logger logging.Logger) {
+	sb.logger = logger
+}
+
 // SetTlsCert sets credentials for server connections
 func (sb *GrpcServerBuilder) SetTlsCert(cert *tls.Certificate) {
 	sb.AddOption(grpc.Creds(credentials.NewServerTLSFromCert(cert)))
@@ -101,7 +108,7 @@ func (sb *GrpcServerBuilder) Build() GrpcServer {
 	if sb.enabledReflection {
 		reflection.Register(srv)
 	}
-	return &grpcServer{srv, nil}
+	return &grpcServer{srv, nil, logging.OrDefault(sb.logger)}
 }
 
 // RegisterService register the services to the server
@@ -121,7 +128,7 @@ func (s *grpcServer) Start(addr string) error {
 
 	go s.serv()
 
-	log.Infof("gRPC Server started on %s ", addr)
+	s.logger.Info("gRPC Server started", "address", addr)
 	return nil
 }
 
@@ -138,15 +145,15 @@ func (s *grpcServer) AwaitTermination(shutdownHook func()) {
 }
 
 func (s *grpcServer) cleanup() {
-	log.Info("Stopping the server")
+	s.logger.Info("Stopping the server")
 	s.server.GracefulStop()
-	log.Info("Closing the listener")
+	s.logger.Info("Closing the listener")
 	s.listener.Close()
-	log.Info("End of Program")
+	s.logger.Info("End of Program")
 }
 
 func (s *grpcServer) serv() {
 	if err := s.server.Serve(s.listener); err != nil {
-		log.Errorf("failed to serve: %v", err)
+		s.logger.Error("failed to serve", "err", err)
 	}
 }
@@ -0,0 +1,109 @@
+package interceptors
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+)
+
+// JSONFileSink writes the audit events as JSON lines into a file.
+// The file is rotated when it reaches the max size, keeping up to maxBackups old files (path.1, path.2, ...)
+type JSONFileSink struct {
+	mu         sync.Mutex
+	path       string
+	maxBytes   int64
+	maxBackups int
+	file       *os.File
+	size       int64
+}
+
+// NewJSONFileSink opens (or creates) the audit file. maxBytes <= 0 disables the rotation
+func NewJSONFileSink(path string, maxBytes int64, maxBackups int) (*JSONFileSink, error) {
+	s := &JSONFileSink{
+		path:       path,
+		maxBytes:   maxBytes,
+		maxBackups: maxBackups,
+	}
+	if err := s.open(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Write appends the event to the file, rotating it first when the event does not fit
+func (s *JSONFileSink) Write(event AuditEvent) error {
+	line, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to encode audit event: %w", err)
+	}
+	line = append(line, '\n')
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.file == nil {
+		return fmt.Errorf("audit file %s is closed", s.path)
+	}
+	if s.maxBytes > 0 && s.size > 0 && s.size+int64(len(line)) > s.maxBytes {
+		if err := s.rotate(); err != nil {
+			return err
+		}
+	}
+	n, err := s.file.Write(line)
+	s.size += int64(n)
+	return err
+}
+
+// Close closes the underlying file
+func (s *JSONFileSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.file == nil {
+		return nil
+	}
+	err := s.file.Close()
+	s.file = nil
+	return err
+}
+
+func (s *JSONFileSink) open() error {
+	file, err := os.OpenFile(s.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open audit file %s: %w", s.path, err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("failed to stat audit file %s: %w", s.path, err)
+	}
+	s.file = file
+	s.size = info.Size()
+	return nil
+}
+
+func (s *JSONFileSink) rotate() error {
+	if err := s.file.Close(); err != nil {
+		return fmt.Errorf("failed to close audit file %s: %w", s.path, err)
+	}
+	s.file = nil
+	if s.maxBackups <= 0 {
+		if err := os.Remove(s.path); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to remove audit file %s: %w", s.path, err)
+		}
+		return s.open()
+	}
+	os.Remove(s.backupName(s.maxBackups))
+	for i := s.maxBackups - 1; i > 0; i-- {
+		if err := os.Rename(s.backupName(i), s.backupName(i+1)); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to rotate audit file %s: %w", s.path, err)
+		}
+	}
+	if err := os.Rename(s.path, s.backupName(1)); err != nil {
+		return fmt.Errorf("failed to rotate audit file %s: %w", s.path, err)
+	}
+	return s.open()
+}
+
+func (s *JSONFileSink) backupName(index int) string {
+	return fmt.Sprintf("%s.%d", s.path, index)
+}
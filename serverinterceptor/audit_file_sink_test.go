@@ -0,0 +1,58 @@
+package interceptors
+
+import (
+	"bufio"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestJSONFileSinkRotation(t *testing.T) {
+	dir, err := ioutil.TempDir("", "audit")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "audit.log")
+
+	sink, err := NewJSONFileSink(path, 200, 2)
+	assert.NoError(t, err)
+	for i := 0; i < 10; i++ {
+		assert.NoError(t, sink.Write(AuditEvent{FullMethod: "/test.Service/Method", Status: "OK"}))
+	}
+	assert.NoError(t, sink.Close())
+
+	assert.FileExists(t, path)
+	assert.FileExists(t, path+".1")
+	assert.FileExists(t, path+".2")
+	_, err = os.Stat(path + ".3")
+	assert.True(t, os.IsNotExist(err))
+
+	info, err := os.Stat(path)
+	assert.NoError(t, err)
+	assert.True(t, info.Size() <= 200)
+	assert.True(t, countLines(t, path) > 0)
+}
+
+func TestJSONFileSinkWriteAfterClose(t *testing.T) {
+	dir, err := ioutil.TempDir("", "audit")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	sink, err := NewJSONFileSink(filepath.Join(dir, "audit.log"), 0, 0)
+	assert.NoError(t, err)
+	sink.Close()
+	assert.Error(t, sink.Write(AuditEvent{}))
+}
+
+func countLines(t *testing.T, path string) int {
+	file, err := os.Open(path)
+	assert.NoError(t, err)
+	defer file.Close()
+	lines := 0
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		lines++
+	}
+	return lines
+}
@@ -0,0 +1,117 @@
+package interceptors
+
+import (
+	"context"
+	"github.com/apssouza22/grpc-production-go/internal/glob"
+	"github.com/apssouza22/grpc-production-go/logging"
+	"math/rand"
+	"regexp"
+)
+
+// DefaultAuditExcludedMethods are the methods excluded from the audit when no exclusion is configured
+var DefaultAuditExcludedMethods = []string{"/grpc.health.v1.Health/*"}
+
+// DefaultExcludedSampleRate is the fraction of the excluded calls still audited when no rate is configured
+const DefaultExcludedSampleRate = 0.01
+
+// AuditOption configures the audit interceptors
+type AuditOption func(*auditConfig)
+
+type auditConfig struct {
+	logger             logging.Logger
+	sink               AuditSink
+	excludedMethods    []string
+	excludedRegexp     *regexp.Regexp
+	excludedPredicate  func(ctx context.Context, fullMethod string) bool
+	excludedSampleRate float64
+	payload            *payloadRenderer
+	sampler            *auditSampler
+}
+
+// WithAuditLogger sets the logger used by the default sink and to report the sink failures
+func WithAuditLogger(logger logging.Logger) AuditOption {
+	return func(c *auditConfig) {
+		c.logger = logger
+	}
+}
+
+// WithAuditSink sets the sink receiving the audit events. The default sink writes into the audit logger
+func WithAuditSink(sink AuditSink) AuditOption {
+	return func(c *auditConfig) {
+		c.sink = sink
+	}
+}
+
+// WithExcludedMethods excludes the methods matching the globs (e.g. "/grpc.health.v1.Health/*") from the audit.
+// It replaces DefaultAuditExcludedMethods, include them again if the health check should still be excluded
+func WithExcludedMethods(globs ...string) AuditOption {
+	return func(c *auditConfig) {
+		c.excludedMethods = globs
+	}
+}
+
+// WithExcludedMethodRegexp excludes the methods whose full name matches the regular expression from the audit
+func WithExcludedMethodRegexp(re *regexp.Regexp) AuditOption {
+	return func(c *auditConfig) {
+		c.excludedRegexp = re
+	}
+}
+
+// WithExclusionPredicate excludes the calls for which the predicate returns true from the audit
+func WithExclusionPredicate(predicate func(ctx context.Context, fullMethod string) bool) AuditOption {
+	return func(c *auditConfig) {
+		c.excludedPredicate = predicate
+	}
+}
+
+// WithExcludedSampleRate still audits the given fraction (0 to 1) of the excluded calls, 0 never audits them.
+// The default is DefaultExcludedSampleRate
+func WithExcludedSampleRate(rate float64) AuditOption {
+	return func(c *auditConfig) {
+		c.excludedSampleRate = rate
+	}
+}
+
+func newAuditConfig(opts []AuditOption) *auditConfig {
+	cfg := &auditConfig{excludedMethods: DefaultAuditExcludedMethods, excludedSampleRate: DefaultExcludedSampleRate}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	cfg.logger = logging.OrDefault(cfg.logger)
+	if cfg.sink == nil {
+		cfg.sink = NewLoggerSink(cfg.logger)
+	}
+	if cfg.sampler != nil {
+		cfg.sampler.emit = cfg.write
+		if async, ok := cfg.sink.(*AsyncSink); ok {
+			async.onClose(cfg.sampler.stop)
+		}
+	}
+	return cfg
+}
+
+// isExcluded checks whether the call matches any of the configured exclusions
+func (c *auditConfig) isExcluded(ctx context.Context, fullMethod string) bool {
+	if glob.MatchAny(c.excludedMethods, fullMethod) {
+		return true
+	}
+	if c.excludedRegexp != nil && c.excludedRegexp.MatchString(fullMethod) {
+		return true
+	}
+	return c.excludedPredicate != nil && c.excludedPredicate(ctx, fullMethod)
+}
+
+// sampleRate returns the fraction of the calls to the method that must be audited
+func (c *auditConfig) sampleRate(ctx context.Context, fullMethod string) float64 {
+	if c.isExcluded(ctx, fullMethod) {
+		return c.excludedSampleRate
+	}
+	return 1
+}
+
+func sampled(rate float64) bool {
+	if rate >= 1 {
+		return true
+	}
+	return rate > 0 && rand.Float64() < rate
+}
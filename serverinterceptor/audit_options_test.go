@@ -0,0 +1,42 @@
+package interceptors
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"regexp"
+	"testing"
+)
+
+func TestAuditExclusions(t *testing.T) {
+	ctx := context.Background()
+	cfg := newAuditConfig(nil)
+	assert.True(t, cfg.isExcluded(ctx, "/grpc.health.v1.Health/Check"))
+	assert.True(t, cfg.isExcluded(ctx, "/grpc.health.v1.Health/Watch"))
+	assert.False(t, cfg.isExcluded(ctx, "/helloworld.Greeter/SayHello"))
+
+	cfg = newAuditConfig([]AuditOption{
+		WithExcludedMethods("/internal.*/*"),
+		WithExcludedMethodRegexp(regexp.MustCompile(`/Ping$`)),
+		WithExclusionPredicate(func(ctx context.Context, fullMethod string) bool {
+			return fullMethod == "/helloworld.Greeter/SayGoodbye"
+		}),
+	})
+	assert.False(t, cfg.isExcluded(ctx, "/grpc.health.v1.Health/Check"))
+	assert.True(t, cfg.isExcluded(ctx, "/internal.Admin/Reload"))
+	assert.True(t, cfg.isExcluded(ctx, "/helloworld.Greeter/Ping"))
+	assert.True(t, cfg.isExcluded(ctx, "/helloworld.Greeter/SayGoodbye"))
+	assert.False(t, cfg.isExcluded(ctx, "/helloworld.Greeter/SayHello"))
+}
+
+func TestAuditExcludedSampleRate(t *testing.T) {
+	ctx := context.Background()
+	cfg := newAuditConfig([]AuditOption{WithExcludedSampleRate(0.5)})
+	assert.Equal(t, 0.5, cfg.sampleRate(ctx, "/grpc.health.v1.Health/Check"))
+	assert.Equal(t, DefaultExcludedSampleRate, newAuditConfig(nil).sampleRate(ctx, "/grpc.health.v1.Health/Check"))
+	assert.Equal(t, float64(1), cfg.sampleRate(ctx, "/helloworld.Greeter/SayHello"))
+}
+
+func Test_sampled(t *testing.T) {
+	assert.True(t, sampled(1))
+	assert.False(t, sampled(0))
+}
@@ -0,0 +1,271 @@
+package interceptors
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/apssouza22/grpc-production-go/internal/glob"
+	"github.com/golang/protobuf/descriptor"
+	"github.com/golang/protobuf/jsonpb"
+	"github.com/golang/protobuf/proto"
+	protobuf "github.com/golang/protobuf/protoc-gen-go/descriptor"
+	"reflect"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// RedactedValue replaces the value of the redacted fields
+const RedactedValue = "[REDACTED]"
+
+// DefaultRedactedFields are the field name globs redacted when no pattern is configured
+var DefaultRedactedFields = []string{"*password*", "*secret*", "*token*", "pass", "authorization", "*credit_card*", "ssn"}
+
+// PayloadLoggingConfig configures the request and response bodies added to the audit events.
+// Only the message bodies are rendered, metadata (e.g. the user/pass headers) is never part of the payload
+type PayloadLoggingConfig struct {
+	// SampleRate is the fraction (0 to 1) of the calls whose payloads are logged
+	SampleRate float64
+	// MethodSampleRates overrides the sample rate per full method name
+	MethodSampleRates map[string]float64
+	// MaxBytes caps the size of each rendered payload. Zero means 4KB
+	MaxBytes int
+	// RedactFields are case insensitive globs matched against the field names. Nil uses DefaultRedactedFields
+	RedactFields []string
+	// SensitiveField flags fields to redact based on their descriptor, see SensitiveExtension
+	SensitiveField func(field *protobuf.FieldDescriptorProto) bool
+}
+
+// WithPayloadLogging adds the rendered request and response payloads to the sampled audit events.
+// For streams the first received and the first sent messages are logged
+func WithPayloadLogging(config PayloadLoggingConfig) AuditOption {
+	return func(c *auditConfig) {
+		c.payload = newPayloadRenderer(config)
+	}
+}
+
+// SensitiveExtension returns a SensitiveField predicate flagging the fields annotated with a boolean
+// field option, e.g. `string password = 1 [(sensitive) = true];`
+func SensitiveExtension(ext *proto.ExtensionDesc) func(field *protobuf.FieldDescriptorProto) bool {
+	return func(field *protobuf.FieldDescriptorProto) bool {
+		if field.Options == nil || !proto.HasExtension(field.Options, ext) {
+			return false
+		}
+		value, err := proto.GetExtension(field.Options, ext)
+		if err != nil {
+			return false
+		}
+		sensitive, ok := value.(*bool)
+		return ok && sensitive != nil && *sensitive
+	}
+}
+
+type payloadRenderer struct {
+	config    PayloadLoggingConfig
+	marshaler jsonpb.Marshaler
+	// sensitive caches the names of the sensitive fields per message type
+	sensitive sync.Map
+}
+
+func newPayloadRenderer(config PayloadLoggingConfig) *payloadRenderer {
+	if config.MaxBytes <= 0 {
+		config.MaxBytes = 4096
+	}
+	if config.RedactFields == nil {
+		config.RedactFields = DefaultRedactedFields
+	}
+	patterns := make([]string, len(config.RedactFields))
+	for i, pattern := range config.RedactFields {
+		patterns[i] = strings.ToLower(pattern)
+	}
+	config.RedactFields = patterns
+	return &payloadRenderer{
+		config:    config,
+		marshaler: jsonpb.Marshaler{OrigName: true},
+	}
+}
+
+// sampleRate returns the fraction of the calls to the method whose payloads are logged
+func (r *payloadRenderer) sampleRate(fullMethod string) float64 {
+	if rate, ok := r.config.MethodSampleRates[fullMethod]; ok {
+		return rate
+	}
+	return r.config.SampleRate
+}
+
+// render returns the redacted JSON representation of the message, capped to MaxBytes
+func (r *payloadRenderer) render(m interface{}) (payload string, truncated bool) {
+	if m == nil {
+		return "", false
+	}
+	var raw []byte
+	var sensitive map[string]bool
+	if msg, ok := m.(proto.Message); ok {
+		var buf bytes.Buffer
+		if err := r.marshaler.Marshal(&buf, msg); err != nil {
+			return "", false
+		}
+		raw = buf.Bytes()
+		sensitive = r.sensitiveFields(msg)
+	} else {
+		var err error
+		if raw, err = json.Marshal(m); err != nil {
+			return "", false
+		}
+	}
+
+	var tree interface{}
+	if err := json.Unmarshal(raw, &tree); err != nil {
+		return "", false
+	}
+	redacted, err := json.Marshal(r.redact(tree, sensitive))
+	if err != nil {
+		return "", false
+	}
+	if len(redacted) > r.config.MaxBytes {
+		return string(truncateUTF8(redacted, r.config.MaxBytes)), true
+	}
+	return string(redacted), false
+}
+
+func (r *payloadRenderer) redact(value interface{}, sensitive map[string]bool) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, child := range v {
+			if sensitive[key] || r.matchesRedactPattern(key) {
+				v[key] = RedactedValue
+				continue
+			}
+			v[key] = r.redact(child, sensitive)
+		}
+	case []interface{}:
+		for i, child := range v {
+			v[i] = r.redact(child, sensitive)
+		}
+	}
+	return value
+}
+
+func (r *payloadRenderer) matchesRedactPattern(field string) bool {
+	return glob.MatchAny(r.config.RedactFields, strings.ToLower(field))
+}
+
+// truncateUTF8 cuts the payload to at most maxBytes without splitting a multi-byte character,
+// so the audit event stays valid UTF-8
+func truncateUTF8(payload []byte, maxBytes int) []byte {
+	end := maxBytes
+	for end > 0 && !utf8.RuneStart(payload[end]) {
+		end--
+	}
+	return payload[:end]
+}
+
+// sensitiveFields returns the names of the fields flagged by SensitiveField in the message and its nested messages
+func (r *payloadRenderer) sensitiveFields(msg proto.Message) map[string]bool {
+	if r.config.SensitiveField == nil {
+		return nil
+	}
+	msgType := reflect.TypeOf(msg)
+	if cached, ok := r.sensitive.Load(msgType); ok {
+		return cached.(map[string]bool)
+	}
+	fields := make(map[string]bool)
+	r.collectSensitiveFields(msg, fields, make(map[string]bool))
+	r.sensitive.Store(msgType, fields)
+	return fields
+}
+
+func (r *payloadRenderer) collectSensitiveFields(msg proto.Message, fields map[string]bool, visited map[string]bool) {
+	described, ok := msg.(descriptor.Message)
+	if !ok {
+		return
+	}
+	name := proto.MessageName(msg)
+	if visited[name] {
+		return
+	}
+	visited[name] = true
+	_, desc := descriptor.ForMessage(described)
+	for _, field := range desc.GetField() {
+		if r.config.SensitiveField(field) {
+			fields[field.GetName()] = true
+			fields[field.GetJsonName()] = true
+			continue
+		}
+		if field.GetType() != protobuf.FieldDescriptorProto_TYPE_MESSAGE {
+			continue
+		}
+		nestedType := proto.MessageType(strings.TrimPrefix(field.GetTypeName(), "."))
+		if nestedType == nil || nestedType.Kind() != reflect.Ptr {
+			continue
+		}
+		if nested, ok := reflect.New(nestedType.Elem()).Interface().(proto.Message); ok {
+			r.collectSensitiveFields(nested, fields, visited)
+		}
+	}
+}
+
+// payloadCapture keeps the first request and response messages of a sampled call. They are only rendered by fill,
+// once the event is kept by the audit sampling. A nil capture is valid and captures nothing
+type payloadCapture struct {
+	renderer *payloadRenderer
+	// copy clones the captured messages, for the streams whose handlers may reuse them
+	copy     bool
+	mu       sync.Mutex
+	request  interface{}
+	response interface{}
+	gotReq   bool
+	gotResp  bool
+}
+
+func (c *auditConfig) newPayloadCapture(fullMethod string, copy bool) *payloadCapture {
+	if c.payload == nil || !sampled(c.payload.sampleRate(fullMethod)) {
+		return nil
+	}
+	return &payloadCapture{renderer: c.payload, copy: copy}
+}
+
+func (p *payloadCapture) captureRequest(m interface{}) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.gotReq {
+		return
+	}
+	p.gotReq = true
+	p.request = p.keep(m)
+}
+
+func (p *payloadCapture) captureResponse(m interface{}) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.gotResp {
+		return
+	}
+	p.gotResp = true
+	p.response = p.keep(m)
+}
+
+func (p *payloadCapture) keep(m interface{}) interface{} {
+	if msg, ok := m.(proto.Message); ok && p.copy {
+		return proto.Clone(msg)
+	}
+	return m
+}
+
+// fill renders the captured messages into the event
+func (p *payloadCapture) fill(event *AuditEvent) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var requestTruncated, responseTruncated bool
+	event.RequestPayload, requestTruncated = p.renderer.render(p.request)
+	event.ResponsePayload, responseTruncated = p.renderer.render(p.response)
+	event.PayloadTruncated = requestTruncated || responseTruncated
+}
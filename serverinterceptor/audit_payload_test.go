@@ -0,0 +1,99 @@
+package interceptors
+
+import (
+	"context"
+	"github.com/golang/protobuf/proto"
+	protobuf "github.com/golang/protobuf/protoc-gen-go/descriptor"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/examples/helloworld/helloworld"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"net"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+var testSensitiveOption = &proto.ExtensionDesc{
+	ExtendedType:  (*protobuf.FieldOptions)(nil),
+	ExtensionType: (*bool)(nil),
+	Field:         51234,
+	Name:          "test.sensitive",
+	Tag:           "varint,51234,opt,name=sensitive",
+}
+
+func TestPayloadLoggingRedactsByName(t *testing.T) {
+	sink := NewMemorySink()
+	interceptor := UnaryAuditServiceRequest(
+		WithAuditSink(sink),
+		WithPayloadLogging(PayloadLoggingConfig{SampleRate: 1, RedactFields: []string{"NAME"}}),
+	)
+	ctx := peer.NewContext(context.Background(), &peer.Peer{Addr: &net.IPNet{}})
+	ctx = metadata.NewIncomingContext(ctx, metadata.Pairs("user", "user", "pass", "123"))
+	handler := func(ctx context.Context, req interface{}) (i interface{}, e error) {
+		return &helloworld.HelloReply{Message: "hello"}, nil
+	}
+	_, err := interceptor(ctx, &helloworld.HelloRequest{Name: "john"}, &grpc.UnaryServerInfo{FullMethod: "/helloworld.Greeter/SayHello"}, handler)
+	assert.NoError(t, err)
+
+	event := sink.Events()[0]
+	assert.Equal(t, `{"name":"[REDACTED]"}`, event.RequestPayload)
+	assert.Equal(t, `{"message":"hello"}`, event.ResponsePayload)
+	assert.NotContains(t, event.RequestPayload, "123")
+	assert.NotContains(t, event.ResponsePayload, "123")
+}
+
+func TestPayloadLoggingMethodSampleRate(t *testing.T) {
+	cfg := newAuditConfig([]AuditOption{WithPayloadLogging(PayloadLoggingConfig{
+		SampleRate:        1,
+		MethodSampleRates: map[string]float64{"/helloworld.Greeter/SayHello": 0},
+	})})
+	assert.Nil(t, cfg.newPayloadCapture("/helloworld.Greeter/SayHello", false))
+	assert.NotNil(t, cfg.newPayloadCapture("/helloworld.Greeter/Other", false))
+}
+
+func TestPayloadRendererTruncates(t *testing.T) {
+	renderer := newPayloadRenderer(PayloadLoggingConfig{MaxBytes: 10})
+	payload, truncated := renderer.render(&helloworld.HelloRequest{Name: strings.Repeat("a", 100)})
+	assert.True(t, truncated)
+	assert.Len(t, payload, 10)
+}
+
+func TestPayloadRendererTruncatesOnRuneBoundary(t *testing.T) {
+	renderer := newPayloadRenderer(PayloadLoggingConfig{MaxBytes: 10})
+	payload, truncated := renderer.render(&helloworld.HelloRequest{Name: strings.Repeat("é", 100)})
+	assert.True(t, truncated)
+	assert.True(t, utf8.ValidString(payload))
+	assert.Equal(t, `{"name":"`, payload)
+}
+
+func TestPayloadRendererRedactsNestedDefaults(t *testing.T) {
+	renderer := newPayloadRenderer(PayloadLoggingConfig{})
+	payload, _ := renderer.render(map[string]interface{}{
+		"user": map[string]interface{}{"login": "john", "Password": "secret"},
+		"auth": []interface{}{map[string]interface{}{"access_token": "abc"}},
+	})
+	assert.Equal(t, `{"auth":[{"access_token":"[REDACTED]"}],"user":{"Password":"[REDACTED]","login":"john"}}`, payload)
+}
+
+func TestPayloadRendererSensitiveField(t *testing.T) {
+	renderer := newPayloadRenderer(PayloadLoggingConfig{
+		RedactFields: []string{},
+		SensitiveField: func(field *protobuf.FieldDescriptorProto) bool {
+			return field.GetName() == "name"
+		},
+	})
+	payload, _ := renderer.render(&helloworld.HelloRequest{Name: "john"})
+	assert.Equal(t, `{"name":"[REDACTED]"}`, payload)
+}
+
+func TestSensitiveExtension(t *testing.T) {
+	isSensitive := SensitiveExtension(testSensitiveOption)
+	field := &protobuf.FieldDescriptorProto{Name: proto.String("password"), Options: &protobuf.FieldOptions{}}
+	assert.False(t, isSensitive(field))
+
+	assert.NoError(t, proto.SetExtension(field.Options, testSensitiveOption, proto.Bool(true)))
+	assert.True(t, isSensitive(field))
+	assert.False(t, isSensitive(&protobuf.FieldDescriptorProto{Name: proto.String("login")}))
+}
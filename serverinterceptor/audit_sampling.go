@@ -0,0 +1,214 @@
+package interceptors
+
+import (
+	"google.golang.org/grpc/codes"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Kinds of audit events
+const (
+	AuditKindCall    = "call"
+	AuditKindSummary = "summary"
+)
+
+// AuditSampling configures which successful calls are audited under high load.
+// Failed calls are always audited
+type AuditSampling struct {
+	// SlowThreshold makes the calls taking longer than it always audited. Zero disables it
+	SlowThreshold time.Duration
+	// SuccessRate is the fraction (0 to 1) of the successful calls audited, zero audits none of them (see AuditRate).
+	// Nil audits all of them, so the zero value only keeps the summaries and the slow calls tracking
+	SuccessRate *float64
+	// MethodRates overrides SuccessRate per full method name. As for SuccessRate, a rate is the fraction (0 to 1)
+	// of the successful calls of the method audited and zero audits none of them
+	MethodRates map[string]float64
+	// TokensPerSecond audits up to this number of successful calls per second and method, instead of using rates
+	TokensPerSecond float64
+	// Burst is the number of successful calls that can be audited at once when using TokensPerSecond
+	Burst int
+	// SummaryInterval emits, per method, a summary event with the number of calls suppressed during the interval.
+	// The interval starts with the first suppressed call, no summary is emitted while nothing is suppressed. Zero disables it
+	SummaryInterval time.Duration
+}
+
+// AuditRate returns the rate to set as AuditSampling.SuccessRate
+func AuditRate(rate float64) *float64 {
+	return &rate
+}
+
+// WithSampling enables the sampling of the successful calls. With an AsyncSink, closing the sink emits the pending
+// summaries and stops the summary timer
+func WithSampling(sampling AuditSampling) AuditOption {
+	return func(c *auditConfig) {
+		c.sampler = newAuditSampler(sampling)
+	}
+}
+
+type auditSampler struct {
+	config      AuditSampling
+	successRate float64
+	mu          sync.Mutex
+	buckets     map[string]*tokenBucket
+	suppressed  map[string]int64
+	windowStart time.Time
+	// summaryTimer flushes the summaries at the end of the interval, it is nil while nothing is suppressed
+	summaryTimer *time.Timer
+	// stopped is set once the sink is closed, no summary interval is started afterwards
+	stopped bool
+	// emit writes the summary events, set by the audit config
+	emit func(event AuditEvent)
+	now  func() time.Time
+}
+
+func newAuditSampler(config AuditSampling) *auditSampler {
+	if config.Burst <= 0 {
+		config.Burst = 1
+	}
+	successRate := 1.0
+	if config.SuccessRate != nil {
+		successRate = *config.SuccessRate
+	}
+	return &auditSampler{
+		config:      config,
+		successRate: successRate,
+		buckets:     make(map[string]*tokenBucket),
+		suppressed:  make(map[string]int64),
+		emit:        func(AuditEvent) {},
+		now:         time.Now,
+	}
+}
+
+// keep decides whether the finished call must be audited, counting it as suppressed otherwise
+func (s *auditSampler) keep(event *AuditEvent) bool {
+	if event.Code != codes.OK {
+		return true
+	}
+	if s.config.SlowThreshold > 0 && event.Duration >= s.config.SlowThreshold {
+		return true
+	}
+
+	kept := false
+	if s.config.TokensPerSecond > 0 {
+		kept = s.bucket(event.FullMethod).take(s.now())
+	} else {
+		rate := s.successRate
+		if methodRate, ok := s.config.MethodRates[event.FullMethod]; ok {
+			rate = methodRate
+		}
+		kept = sampled(rate)
+		if kept && rate < 1 {
+			if event.SampleRate > 0 {
+				rate *= event.SampleRate
+			}
+			event.SampleRate = rate
+		}
+	}
+	if !kept {
+		s.suppress(event.FullMethod)
+	}
+	return kept
+}
+
+func (s *auditSampler) bucket(fullMethod string) *tokenBucket {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	bucket, ok := s.buckets[fullMethod]
+	if !ok {
+		bucket = newTokenBucket(s.config.TokensPerSecond, s.config.Burst, s.now())
+		s.buckets[fullMethod] = bucket
+	}
+	return bucket
+}
+
+// suppress counts the suppressed call, starting the summary interval if needed
+func (s *auditSampler) suppress(fullMethod string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.suppressed[fullMethod]++
+	if s.config.SummaryInterval > 0 && s.summaryTimer == nil && !s.stopped {
+		s.windowStart = s.now()
+		s.summaryTimer = time.AfterFunc(s.config.SummaryInterval, s.flush)
+	}
+}
+
+// stop ends the current summary interval, emitting its summaries, and no longer starts new ones
+func (s *auditSampler) stop() {
+	s.mu.Lock()
+	s.stopped = true
+	timer := s.summaryTimer
+	s.mu.Unlock()
+	// A timer already fired flushes the summaries itself
+	if timer != nil && timer.Stop() {
+		s.flush()
+	}
+}
+
+// flush emits the summary events of the elapsed interval
+func (s *auditSampler) flush() {
+	for _, event := range s.summaries() {
+		s.emit(event)
+	}
+}
+
+// summaries returns the summary events of the current interval and ends it
+func (s *auditSampler) summaries() []AuditEvent {
+	now := s.now()
+	s.mu.Lock()
+	suppressed := s.suppressed
+	windowStart := s.windowStart
+	s.suppressed = make(map[string]int64)
+	s.summaryTimer = nil
+	s.mu.Unlock()
+
+	events := make([]AuditEvent, 0, len(suppressed))
+	for fullMethod, count := range suppressed {
+		service, method := splitMethodName(fullMethod)
+		events = append(events, AuditEvent{
+			Kind:       AuditKindSummary,
+			Time:       windowStart,
+			Level:      AuditLevelInfo,
+			FullMethod: fullMethod,
+			Service:    service,
+			Method:     method,
+			Duration:   now.Sub(windowStart),
+			Status:     codes.OK.String(),
+			Suppressed: count,
+		})
+	}
+	sort.Slice(events, func(i, j int) bool {
+		return events[i].FullMethod < events[j].FullMethod
+	})
+	return events
+}
+
+// tokenBucket allows up to rate events per second with the given burst
+type tokenBucket struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(rate float64, burst int, now time.Time) *tokenBucket {
+	return &tokenBucket{rate: rate, burst: float64(burst), tokens: float64(burst), last: now}
+}
+
+func (b *tokenBucket) take(now time.Time) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if elapsed := now.Sub(b.last).Seconds(); elapsed > 0 {
+		b.tokens += elapsed * b.rate
+		if b.tokens > b.burst {
+			b.tokens = b.burst
+		}
+		b.last = now
+	}
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
@@ -0,0 +1,131 @@
+package interceptors
+
+import (
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/codes"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestAuditSamplerAlwaysKeepsErrorsAndSlowCalls(t *testing.T) {
+	sampler := newAuditSampler(AuditSampling{SlowThreshold: time.Second, MethodRates: map[string]float64{"m": 0}})
+	assert.True(t, sampler.keep(&AuditEvent{FullMethod: "m", Code: codes.Internal}))
+	assert.True(t, sampler.keep(&AuditEvent{FullMethod: "m", Code: codes.OK, Duration: 2 * time.Second}))
+	assert.False(t, sampler.keep(&AuditEvent{FullMethod: "m", Code: codes.OK}))
+}
+
+func TestAuditSamplerMethodRates(t *testing.T) {
+	sampler := newAuditSampler(AuditSampling{
+		SuccessRate: AuditRate(1),
+		MethodRates: map[string]float64{"noisy": 0},
+	})
+	assert.True(t, sampler.keep(&AuditEvent{FullMethod: "other"}))
+	assert.False(t, sampler.keep(&AuditEvent{FullMethod: "noisy"}))
+}
+
+func TestAuditSamplerZeroRates(t *testing.T) {
+	sampler := newAuditSampler(AuditSampling{
+		SuccessRate: AuditRate(0),
+		MethodRates: map[string]float64{"kept": 1, "noisy": 0},
+	})
+	assert.False(t, sampler.keep(&AuditEvent{FullMethod: "other"}))
+	assert.False(t, sampler.keep(&AuditEvent{FullMethod: "noisy"}))
+	assert.True(t, sampler.keep(&AuditEvent{FullMethod: "kept"}))
+}
+
+func TestAuditSamplerTokenBudget(t *testing.T) {
+	now := time.Now()
+	sampler := newAuditSampler(AuditSampling{TokensPerSecond: 1, Burst: 2})
+	sampler.now = func() time.Time { return now }
+	assert.True(t, sampler.keep(&AuditEvent{FullMethod: "m"}))
+	assert.True(t, sampler.keep(&AuditEvent{FullMethod: "m"}))
+	assert.False(t, sampler.keep(&AuditEvent{FullMethod: "m"}))
+	assert.True(t, sampler.keep(&AuditEvent{FullMethod: "other"}))
+
+	now = now.Add(time.Second)
+	assert.True(t, sampler.keep(&AuditEvent{FullMethod: "m"}))
+}
+
+func TestAuditSamplerZeroValueKeepsAll(t *testing.T) {
+	sampler := newAuditSampler(AuditSampling{})
+	for i := 0; i < 100; i++ {
+		assert.True(t, sampler.keep(&AuditEvent{FullMethod: "m", Code: codes.OK}))
+	}
+}
+
+func TestAuditSamplerSummaries(t *testing.T) {
+	var mu sync.Mutex
+	var summaries []AuditEvent
+	sampler := newAuditSampler(AuditSampling{SummaryInterval: 20 * time.Millisecond, MethodRates: map[string]float64{
+		"/svc/A": 0,
+		"/svc/B": 0,
+	}})
+	sampler.emit = func(event AuditEvent) {
+		mu.Lock()
+		defer mu.Unlock()
+		summaries = append(summaries, event)
+	}
+	sampler.keep(&AuditEvent{FullMethod: "/svc/A"})
+	sampler.keep(&AuditEvent{FullMethod: "/svc/A"})
+	sampler.keep(&AuditEvent{FullMethod: "/svc/B"})
+
+	// The summaries are flushed at the end of the interval without waiting for another call
+	assert.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(summaries) == 2
+	}, time.Second, 5*time.Millisecond)
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, AuditKindSummary, summaries[0].Kind)
+	assert.Equal(t, "/svc/A", summaries[0].FullMethod)
+	assert.Equal(t, int64(2), summaries[0].Suppressed)
+	assert.Equal(t, int64(1), summaries[1].Suppressed)
+	assert.Empty(t, sampler.summaries())
+}
+
+func TestAuditSamplerStopsWithTheSink(t *testing.T) {
+	memory := NewMemorySink()
+	sink := NewAsyncSink(memory, 10)
+	cfg := newAuditConfig([]AuditOption{
+		WithAuditSink(sink),
+		WithSampling(AuditSampling{SummaryInterval: time.Hour, MethodRates: map[string]float64{"/svc/A": 0}}),
+	})
+	cfg.sampler.keep(&AuditEvent{FullMethod: "/svc/A"})
+	assert.NoError(t, sink.Close())
+
+	// The pending summary is written before the sink closes and no timer is left running
+	if assert.Len(t, memory.Events(), 1) {
+		assert.Equal(t, AuditKindSummary, memory.Events()[0].Kind)
+	}
+	cfg.sampler.keep(&AuditEvent{FullMethod: "/svc/A"})
+	cfg.sampler.mu.Lock()
+	defer cfg.sampler.mu.Unlock()
+	assert.Nil(t, cfg.sampler.summaryTimer)
+}
+
+func TestAuditSamplingThroughInterceptor(t *testing.T) {
+	sink := NewMemorySink()
+	cfg := newAuditConfig([]AuditOption{WithAuditSink(sink), WithSampling(AuditSampling{})})
+	cfg.logRequest(AuditEvent{FullMethod: "/svc/A", Time: time.Now()}, &callRecord{}, nil, nil)
+	assert.Len(t, sink.Events(), 1)
+
+	cfg = newAuditConfig([]AuditOption{
+		WithAuditSink(sink),
+		WithSampling(AuditSampling{MethodRates: map[string]float64{"/svc/B": 0}}),
+		WithPayloadLogging(PayloadLoggingConfig{SampleRate: 1}),
+	})
+	payloads := cfg.newPayloadCapture("/svc/B", false)
+	payloads.captureRequest(&panickingMessage{})
+	// The dropped event does not render its payloads
+	cfg.logRequest(AuditEvent{FullMethod: "/svc/B", Time: time.Now()}, &callRecord{}, nil, payloads)
+	assert.Len(t, sink.Events(), 1)
+}
+
+// panickingMessage fails the test when rendered
+type panickingMessage struct{}
+
+func (m *panickingMessage) MarshalJSON() ([]byte, error) {
+	panic("payload rendered")
+}
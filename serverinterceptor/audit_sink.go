@@ -0,0 +1,319 @@
+package interceptors
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/apssouza22/grpc-production-go/logging"
+	logrus "github.com/sirupsen/logrus"
+	"google.golang.org/grpc/codes"
+	"io"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Audit levels used to classify a finished call
+const (
+	AuditLevelInfo  = "info"
+	AuditLevelWarn  = "warn"
+	AuditLevelError = "error"
+)
+
+// AuditEvent is the record produced by the audit interceptors for every finished call
+type AuditEvent struct {
+	Kind             string        `json:"kind,omitempty"`
+	Time             time.Time     `json:"time"`
+	Level            string        `json:"level"`
+	FullMethod       string        `json:"full_method"`
+	Service          string        `json:"service,omitempty"`
+	Method           string        `json:"method,omitempty"`
+	Stream           bool          `json:"stream,omitempty"`
+	UserAgent        []string      `json:"user_agent,omitempty"`
+	Peer             string        `json:"peer,omitempty"`
+	Principal        string        `json:"principal,omitempty"`
+	Tenant           string        `json:"tenant,omitempty"`
+	RequestID        string        `json:"request_id,omitempty"`
+	TraceID          string        `json:"trace_id,omitempty"`
+	SpanID           string        `json:"span_id,omitempty"`
+	Deadline         *time.Time    `json:"deadline,omitempty"`
+	RequestBytes     int64         `json:"request_bytes,omitempty"`
+	ResponseBytes    int64         `json:"response_bytes,omitempty"`
+	MessagesReceived int64         `json:"messages_received,omitempty"`
+	MessagesSent     int64         `json:"messages_sent,omitempty"`
+	Duration         time.Duration `json:"took_ns"`
+	Code             codes.Code    `json:"-"`
+	Status           string        `json:"status"`
+	Error            string        `json:"err,omitempty"`
+	Details          []interface{} `json:"err_details,omitempty"`
+	SampleRate       float64       `json:"sample_rate,omitempty"`
+	RequestPayload   string        `json:"request_payload,omitempty"`
+	ResponsePayload  string        `json:"response_payload,omitempty"`
+	PayloadTruncated bool          `json:"payload_truncated,omitempty"`
+	Suppressed       int64         `json:"suppressed,omitempty"`
+}
+
+// AuditSink receives the audit events. Implementations must be safe for concurrent use
+type AuditSink interface {
+	Write(event AuditEvent) error
+}
+
+// auditLevel classifies the status code of a call
+func auditLevel(code codes.Code) string {
+	switch code {
+
+	case codes.OK:
+		return AuditLevelInfo
+
+	// Caused by invalid client requests (http 4xx equiv.)
+	case codes.Canceled,
+		codes.InvalidArgument,
+		codes.NotFound,
+		codes.AlreadyExists,
+		codes.PermissionDenied,
+		codes.FailedPrecondition,
+		codes.Aborted,
+		codes.OutOfRange,
+		codes.Unimplemented, // usually caused by client requesting invalid operation (even though it matches 501)
+		codes.Unauthenticated:
+		return AuditLevelWarn
+
+	// Server errors (http 5xx equiv.):
+	// Unknown, DeadlineExceeded, ResourceExhausted, Internal, Unavailable, DataLoss
+	// (ResourceExhausted is somewhere in between, from user quota exhausted to OOM, rather have it on error for now)
+	default:
+		return AuditLevelError
+	}
+}
+
+// LoggerSink writes the audit events into a logger, with a level matching their status code
+type LoggerSink struct {
+	logger logging.Logger
+}
+
+// NewLoggerSink creates a sink writing into the given logger. Nil uses the default logger
+func NewLoggerSink(logger logging.Logger) *LoggerSink {
+	return &LoggerSink{logger: logging.OrDefault(logger)}
+}
+
+// NewLogrusSink creates a sink writing into the given logrus logger. Nil uses the standard logrus logger
+func NewLogrusSink(logger logrus.FieldLogger) *LoggerSink {
+	return NewLoggerSink(logging.NewLogrusLogger(logger))
+}
+
+// Write logs the event with a level matching its status code
+func (s *LoggerSink) Write(event AuditEvent) error {
+	if event.Kind == AuditKindSummary {
+		s.logger.Info("gRPC calls suppressed by sampling",
+			"service", event.Service,
+			"method", event.Method,
+			"suppressed", event.Suppressed,
+			"window_ns", event.Duration,
+		)
+		return nil
+	}
+	keyvals := []interface{}{
+		"service", event.Service,
+		"method", event.Method,
+		"user-agent", event.UserAgent,
+		"peer", event.Peer,
+		"request-bytes", event.RequestBytes,
+		"response-bytes", event.ResponseBytes,
+		"messages-received", event.MessagesReceived,
+		"messages-sent", event.MessagesSent,
+		"took_ns", event.Duration,
+		"status", event.Status,
+		"err", event.Error,
+		"err-details", event.Details,
+	}
+	optional := []string{
+		"principal", event.Principal,
+		"tenant", event.Tenant,
+		"request-id", event.RequestID,
+		"trace-id", event.TraceID,
+		"span-id", event.SpanID,
+	}
+	for i := 0; i < len(optional); i += 2 {
+		if optional[i+1] != "" {
+			keyvals = append(keyvals, optional[i], optional[i+1])
+		}
+	}
+	if event.Deadline != nil {
+		keyvals = append(keyvals, "deadline", *event.Deadline)
+	}
+	if event.SampleRate > 0 {
+		keyvals = append(keyvals, "sample-rate", event.SampleRate)
+	}
+	if event.RequestPayload != "" || event.ResponsePayload != "" {
+		keyvals = append(keyvals,
+			"request-payload", event.RequestPayload,
+			"response-payload", event.ResponsePayload,
+			"payload-truncated", event.PayloadTruncated,
+		)
+	}
+	switch event.Level {
+	case AuditLevelInfo:
+		s.logger.Info("gRPC call succeeded", keyvals...)
+	case AuditLevelWarn:
+		s.logger.Warn("gRPC call failed", keyvals...)
+	default:
+		s.logger.Error("gRPC call errored", keyvals...)
+	}
+	return nil
+}
+
+// WriterSink writes the audit events as JSON lines into an io.Writer
+type WriterSink struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+}
+
+// NewWriterSink creates a JSON lines sink on top of the writer
+func NewWriterSink(w io.Writer) *WriterSink {
+	return &WriterSink{enc: json.NewEncoder(w)}
+}
+
+// NewStdoutSink creates a JSON lines sink writing into the standard output
+func NewStdoutSink() *WriterSink {
+	return NewWriterSink(os.Stdout)
+}
+
+// Write encodes the event as a single JSON line
+func (s *WriterSink) Write(event AuditEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.enc.Encode(event)
+}
+
+// MemorySink keeps the audit events in memory. Helpful to assert the audit trail in tests
+type MemorySink struct {
+	mu     sync.Mutex
+	events []AuditEvent
+}
+
+// NewMemorySink creates an empty in-memory sink
+func NewMemorySink() *MemorySink {
+	return &MemorySink{}
+}
+
+// Write stores the event
+func (s *MemorySink) Write(event AuditEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.events = append(s.events, event)
+	return nil
+}
+
+// Events returns a copy of the stored events
+func (s *MemorySink) Events() []AuditEvent {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	events := make([]AuditEvent, len(s.events))
+	copy(events, s.events)
+	return events
+}
+
+// Reset removes all the stored events
+func (s *MemorySink) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.events = nil
+}
+
+// ErrAuditSinkClosed is returned by the writes to a closed AsyncSink
+var ErrAuditSinkClosed = errors.New("audit sink is closed")
+
+// AsyncSink buffers the audit events and writes them into the next sink from a background goroutine.
+// Events are dropped instead of blocking the request when the buffer is full
+type AsyncSink struct {
+	dropped uint64
+	failed  uint64
+	next    AuditSink
+	events  chan AuditEvent
+	done    chan struct{}
+	// mu guards closed, so Write never sends on the closed events channel
+	mu     sync.RWMutex
+	closed bool
+	// closeHooks are called by Close before flushing, so they can still write their last events
+	closeHooks []func()
+	closeOnce  sync.Once
+	closeErr   error
+}
+
+// NewAsyncSink creates an asynchronous sink with the given buffer size in front of the next sink
+func NewAsyncSink(next AuditSink, bufferSize int) *AsyncSink {
+	if bufferSize <= 0 {
+		bufferSize = 1024
+	}
+	s := &AsyncSink{
+		next:   next,
+		events: make(chan AuditEvent, bufferSize),
+		done:   make(chan struct{}),
+	}
+	go s.run()
+	return s
+}
+
+func (s *AsyncSink) run() {
+	defer close(s.done)
+	for event := range s.events {
+		if err := s.next.Write(event); err != nil {
+			atomic.AddUint64(&s.failed, 1)
+		}
+	}
+}
+
+// Write enqueues the event without blocking. It returns ErrAuditSinkClosed once the sink is closed
+func (s *AsyncSink) Write(event AuditEvent) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.closed {
+		atomic.AddUint64(&s.dropped, 1)
+		return ErrAuditSinkClosed
+	}
+	select {
+	case s.events <- event:
+	default:
+		atomic.AddUint64(&s.dropped, 1)
+	}
+	return nil
+}
+
+// Dropped returns the number of events dropped because the buffer was full or the sink closed
+func (s *AsyncSink) Dropped() uint64 {
+	return atomic.LoadUint64(&s.dropped)
+}
+
+// Failed returns the number of events the next sink failed to write
+func (s *AsyncSink) Failed() uint64 {
+	return atomic.LoadUint64(&s.failed)
+}
+
+// onClose registers a function called when the sink is closed, e.g. to stop the timers writing into it
+func (s *AsyncSink) onClose(hook func()) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closeHooks = append(s.closeHooks, hook)
+}
+
+// Close flushes the buffered events, stops the background goroutine and closes the next sink when it is an io.Closer.
+// The events written afterwards are dropped. Closing again returns the error of the first Close
+func (s *AsyncSink) Close() error {
+	s.closeOnce.Do(func() {
+		s.mu.RLock()
+		hooks := s.closeHooks
+		s.mu.RUnlock()
+		for _, hook := range hooks {
+			hook()
+		}
+		s.mu.Lock()
+		s.closed = true
+		close(s.events)
+		s.mu.Unlock()
+		<-s.done
+		if closer, ok := s.next.(io.Closer); ok {
+			s.closeErr = closer.Close()
+		}
+	})
+	return s.closeErr
+}
@@ -0,0 +1,116 @@
+package interceptors
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/codes"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestWriterSink(t *testing.T) {
+	var buf bytes.Buffer
+	sink := NewWriterSink(&buf)
+	err := sink.Write(AuditEvent{FullMethod: "/test.Service/Method", Status: codes.OK.String(), Level: AuditLevelInfo})
+	assert.NoError(t, err)
+
+	var decoded map[string]interface{}
+	assert.NoError(t, json.Unmarshal(buf.Bytes(), &decoded))
+	assert.Equal(t, "/test.Service/Method", decoded["full_method"])
+	assert.Equal(t, "OK", decoded["status"])
+	assert.Equal(t, "info", decoded["level"])
+}
+
+func TestMemorySink(t *testing.T) {
+	sink := NewMemorySink()
+	sink.Write(AuditEvent{FullMethod: "a"})
+	sink.Write(AuditEvent{FullMethod: "b"})
+	events := sink.Events()
+	assert.Len(t, events, 2)
+	assert.Equal(t, "b", events[1].FullMethod)
+
+	sink.Reset()
+	assert.Empty(t, sink.Events())
+}
+
+func TestAsyncSinkFlushesOnClose(t *testing.T) {
+	memory := NewMemorySink()
+	sink := NewAsyncSink(memory, 10)
+	for i := 0; i < 5; i++ {
+		sink.Write(AuditEvent{FullMethod: "test"})
+	}
+	assert.NoError(t, sink.Close())
+	assert.Len(t, memory.Events(), 5)
+	assert.Equal(t, uint64(0), sink.Dropped())
+}
+
+func TestAsyncSinkDropsWhenFull(t *testing.T) {
+	release := make(chan struct{})
+	sink := NewAsyncSink(blockingSink{release}, 1)
+	for i := 0; i < 10; i++ {
+		sink.Write(AuditEvent{FullMethod: "test"})
+	}
+	close(release)
+	sink.Close()
+	assert.True(t, sink.Dropped() > 0)
+	assert.Equal(t, uint64(10), sink.Dropped()+sink.Failed())
+}
+
+// countingCloserSink counts how many times it is closed
+type countingCloserSink struct {
+	*MemorySink
+	closed int
+}
+
+func (s *countingCloserSink) Close() error {
+	s.closed++
+	return nil
+}
+
+func TestAsyncSinkCloseIsIdempotent(t *testing.T) {
+	next := &countingCloserSink{MemorySink: NewMemorySink()}
+	sink := NewAsyncSink(next, 10)
+	assert.NoError(t, sink.Close())
+	assert.NoError(t, sink.Close())
+	assert.Equal(t, 1, next.closed)
+}
+
+func Test_auditLevel(t *testing.T) {
+	assert.Equal(t, AuditLevelInfo, auditLevel(codes.OK))
+	assert.Equal(t, AuditLevelWarn, auditLevel(codes.NotFound))
+	assert.Equal(t, AuditLevelError, auditLevel(codes.Internal))
+}
+
+type blockingSink struct {
+	release chan struct{}
+}
+
+func (s blockingSink) Write(event AuditEvent) error {
+	select {
+	case <-s.release:
+	case <-time.After(time.Second):
+	}
+	return errors.New("failed")
+}
+
+func TestAsyncSinkWriteAfterClose(t *testing.T) {
+	memory := NewMemorySink()
+	sink := NewAsyncSink(memory, 10)
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				sink.Write(AuditEvent{FullMethod: "test"})
+			}
+		}()
+	}
+	assert.NoError(t, sink.Close())
+	wg.Wait()
+	assert.Equal(t, ErrAuditSinkClosed, sink.Write(AuditEvent{FullMethod: "test"}))
+	assert.Equal(t, uint64(401), uint64(len(memory.Events()))+sink.Dropped())
+}
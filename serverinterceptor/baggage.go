@@ -0,0 +1,52 @@
+package interceptors
+
+import (
+	"context"
+	"github.com/apssouza22/grpc-production-go/baggage"
+	grpc_middleware "github.com/grpc-ecosystem/go-grpc-middleware"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"strings"
+)
+
+// UnaryBaggage reads the baggage header of the incoming call into the context bag (see baggage.FromContext).
+// The baggage is set by the caller: add it only to the servers trusting their callers, and never use its tenant for access control
+func UnaryBaggage() grpc.UnaryServerInterceptor {
+	return func(
+		ctx context.Context,
+		req interface{},
+		info *grpc.UnaryServerInfo,
+		handler grpc.UnaryHandler) (_ interface{}, err error) {
+		return handler(incomingBaggage(ctx), req)
+	}
+}
+
+// StreamBaggage reads the baggage header of the incoming stream into the stream context bag
+func StreamBaggage() grpc.StreamServerInterceptor {
+	return func(
+		srv interface{},
+		stream grpc.ServerStream,
+		info *grpc.StreamServerInfo,
+		handler grpc.StreamHandler) (err error) {
+		wrapped := grpc_middleware.WrapServerStream(stream)
+		wrapped.WrappedContext = incomingBaggage(stream.Context())
+		return handler(srv, wrapped)
+	}
+}
+
+// incomingBaggage merges the incoming baggage header with the bag already in the context, the latter winning
+func incomingBaggage(ctx context.Context) context.Context {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return ctx
+	}
+	values := md.Get(baggage.Header)
+	if len(values) == 0 {
+		return ctx
+	}
+	bag := baggage.Parse(strings.Join(values, ","))
+	for key, value := range baggage.FromContext(ctx).Members() {
+		bag = bag.With(key, value)
+	}
+	return baggage.NewContext(ctx, bag)
+}
@@ -0,0 +1,45 @@
+package interceptors
+
+import (
+	"context"
+	"github.com/apssouza22/grpc-production-go/baggage"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"testing"
+)
+
+func TestUnaryBaggage(t *testing.T) {
+	interceptor := UnaryBaggage()
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(
+		baggage.Header, "tenant-id=acme,locale=en",
+		baggage.Header, "ff.beta=on",
+	))
+	ctx = baggage.WithLocale(ctx, "pt")
+	var bag baggage.Bag
+	handler := func(ctx context.Context, req interface{}) (i interface{}, e error) {
+		bag = baggage.FromContext(ctx)
+		return nil, nil
+	}
+	interceptor(ctx, "req", &grpc.UnaryServerInfo{FullMethod: "test"}, handler)
+	assert.Equal(t, map[string]string{"tenant-id": "acme", "locale": "pt", "ff.beta": "on"}, bag.Members())
+}
+
+func TestStreamBaggage(t *testing.T) {
+	interceptor := StreamBaggage()
+	var tenant string
+	handler := func(srv interface{}, stream grpc.ServerStream) error {
+		tenant = baggage.Tenant(stream.Context())
+		return nil
+	}
+	interceptor(nil, baggageStreamMock{}, &grpc.StreamServerInfo{FullMethod: "test"}, handler)
+	assert.Equal(t, "acme", tenant)
+}
+
+type baggageStreamMock struct {
+	ServerStreamMock
+}
+
+func (s baggageStreamMock) Context() context.Context {
+	return metadata.NewIncomingContext(context.Background(), metadata.Pairs(baggage.Header, "tenant-id=acme"))
+}
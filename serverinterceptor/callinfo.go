@@ -0,0 +1,173 @@
+package interceptors
+
+import (
+	"context"
+	"github.com/apssouza22/grpc-production-go/requestid"
+	"github.com/opentracing/opentracing-go"
+	"google.golang.org/grpc/metadata"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+type principalKey struct{}
+
+type callRecordKey struct{}
+
+// callRecord collects the call attributes set by interceptors further down the chain,
+// so the interceptors wrapping them (e.g. audit) can report them once the call is finished
+type callRecord struct {
+	mu        sync.Mutex
+	principal string
+	requestID string
+	tenant    string
+	// tenantLabel is the tenant label of the metrics, see tenantLabel
+	tenantLabel string
+}
+
+func newContextWithCallRecord(ctx context.Context) (context.Context, *callRecord) {
+	if record, ok := ctx.Value(callRecordKey{}).(*callRecord); ok {
+		return ctx, record
+	}
+	record := &callRecord{}
+	return context.WithValue(ctx, callRecordKey{}, record), record
+}
+
+func callRecordFromContext(ctx context.Context) *callRecord {
+	record, _ := ctx.Value(callRecordKey{}).(*callRecord)
+	return record
+}
+
+func (r *callRecord) setPrincipal(principal string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.principal = principal
+}
+
+func (r *callRecord) getPrincipal() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.principal
+}
+
+func (r *callRecord) setRequestID(id string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.requestID = id
+}
+
+func (r *callRecord) getRequestID() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.requestID
+}
+
+func (r *callRecord) setTenant(tenant string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.tenant = tenant
+}
+
+func (r *callRecord) getTenant() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.tenant
+}
+
+func (r *callRecord) setTenantLabel(label string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.tenantLabel = label
+}
+
+func (r *callRecord) getTenantLabel() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.tenantLabel
+}
+
+// ContextWithPrincipal returns a context carrying the authenticated principal of the call
+func ContextWithPrincipal(ctx context.Context, principal string) context.Context {
+	if record := callRecordFromContext(ctx); record != nil {
+		record.setPrincipal(principal)
+	}
+	return context.WithValue(ctx, principalKey{}, principal)
+}
+
+// PrincipalFromContext returns the authenticated principal of the call, if any
+func PrincipalFromContext(ctx context.Context) (string, bool) {
+	principal, ok := ctx.Value(principalKey{}).(string)
+	return principal, ok && principal != ""
+}
+
+// requestIDFromContext returns the request id stored in the context or sent by the client
+func requestIDFromContext(ctx context.Context) string {
+	id, _ := requestid.FromContext(ctx)
+	return id
+}
+
+// TraceIDsFromContext returns the trace and span ids of the call.
+// The active opentracing span is used when present, falling back to the incoming trace headers
+// (W3C traceparent, Jaeger uber-trace-id, B3 and ot-tracer headers)
+func TraceIDsFromContext(ctx context.Context) (traceID string, spanID string) {
+	if span := opentracing.SpanFromContext(ctx); span != nil {
+		carrier := opentracing.TextMapCarrier{}
+		if err := span.Tracer().Inject(span.Context(), opentracing.TextMap, carrier); err == nil {
+			traceID, spanID = parseTraceHeaders(carrier)
+		}
+	}
+	if traceID != "" {
+		return traceID, spanID
+	}
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return "", ""
+	}
+	headers := make(map[string]string, len(md))
+	for key, values := range md {
+		if len(values) > 0 {
+			headers[key] = values[0]
+		}
+	}
+	return parseTraceHeaders(headers)
+}
+
+func parseTraceHeaders(headers map[string]string) (traceID string, spanID string) {
+	lower := make(map[string]string, len(headers))
+	for key, value := range headers {
+		lower[strings.ToLower(key)] = value
+	}
+	if value, ok := lower["traceparent"]; ok {
+		parts := strings.Split(value, "-")
+		if len(parts) == 4 {
+			return parts[1], parts[2]
+		}
+	}
+	if value, ok := lower["uber-trace-id"]; ok {
+		if unescaped, err := url.QueryUnescape(value); err == nil {
+			value = unescaped
+		}
+		parts := strings.Split(value, ":")
+		if len(parts) == 4 {
+			return parts[0], parts[1]
+		}
+	}
+	for key, value := range lower {
+		switch {
+		case strings.HasSuffix(key, "traceid"):
+			traceID = value
+		case strings.HasSuffix(key, "spanid") && !strings.HasSuffix(key, "parentspanid"):
+			spanID = value
+		}
+	}
+	return traceID, spanID
+}
+
+// splitMethodName splits the full method name (/package.Service/Method) into service and method
+func splitMethodName(fullMethod string) (service string, method string) {
+	fullMethod = strings.TrimPrefix(fullMethod, "/")
+	if i := strings.LastIndex(fullMethod, "/"); i >= 0 {
+		return fullMethod[:i], fullMethod[i+1:]
+	}
+	return "unknown", fullMethod
+}
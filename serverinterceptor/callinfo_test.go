@@ -0,0 +1,59 @@
+package interceptors
+
+import (
+	"context"
+	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/mocktracer"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/metadata"
+	"testing"
+)
+
+func TestContextWithPrincipal(t *testing.T) {
+	ctx, record := newContextWithCallRecord(context.Background())
+	_, ok := PrincipalFromContext(ctx)
+	assert.False(t, ok)
+
+	ctx = ContextWithPrincipal(ctx, "alice")
+	principal, ok := PrincipalFromContext(ctx)
+	assert.True(t, ok)
+	assert.Equal(t, "alice", principal)
+	assert.Equal(t, "alice", record.getPrincipal())
+}
+
+func TestTraceIDsFromIncomingMetadata(t *testing.T) {
+	md := metadata.Pairs("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	ctx := metadata.NewIncomingContext(context.Background(), md)
+	traceID, spanID := TraceIDsFromContext(ctx)
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", traceID)
+	assert.Equal(t, "00f067aa0ba902b7", spanID)
+}
+
+func TestTraceIDsFromSpan(t *testing.T) {
+	tracer := mocktracer.New()
+	span := tracer.StartSpan("test")
+	ctx := opentracing.ContextWithSpan(context.Background(), span)
+	traceID, spanID := TraceIDsFromContext(ctx)
+	assert.NotEmpty(t, traceID)
+	assert.NotEmpty(t, spanID)
+}
+
+func Test_parseTraceHeaders(t *testing.T) {
+	traceID, spanID := parseTraceHeaders(map[string]string{"uber-trace-id": "abc%3A123%3A0%3A1"})
+	assert.Equal(t, "abc", traceID)
+	assert.Equal(t, "123", spanID)
+
+	traceID, spanID = parseTraceHeaders(map[string]string{"X-B3-TraceId": "t1", "X-B3-SpanId": "s1", "X-B3-ParentSpanId": "p1"})
+	assert.Equal(t, "t1", traceID)
+	assert.Equal(t, "s1", spanID)
+}
+
+func Test_splitMethodName(t *testing.T) {
+	service, method := splitMethodName("/helloworld.Greeter/SayHello")
+	assert.Equal(t, "helloworld.Greeter", service)
+	assert.Equal(t, "SayHello", method)
+
+	service, method = splitMethodName("test")
+	assert.Equal(t, "unknown", service)
+	assert.Equal(t, "test", method)
+}
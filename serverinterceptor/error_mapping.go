@@ -0,0 +1,254 @@
+package interceptors
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/apssouza22/grpc-production-go/baggage"
+	"github.com/apssouza22/grpc-production-go/logging"
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"reflect"
+	"sync"
+	"time"
+)
+
+// DefaultScrubbedMessage replaces the message of the errors not mapped by the registry
+const DefaultScrubbedMessage = "internal error"
+
+// ErrorMapping describes the status returned for a domain error
+type ErrorMapping struct {
+	// Code is the status code
+	Code codes.Code
+	// Message replaces the error message. Empty exposes the error message, mapped errors are considered safe
+	Message string
+	// Reason, Domain and Metadata are sent in an ErrorInfo detail when Reason is set.
+	// Domain defaults to the one configured with WithErrorDomain
+	Reason   string
+	Domain   string
+	Metadata map[string]string
+	// RetryDelay is sent in a RetryInfo detail when positive
+	RetryDelay time.Duration
+	// Localize returns the message for the locale of the call (see baggage.Locale), sent in a LocalizedMessage
+	// detail when not empty
+	Localize func(locale string, err error) string
+}
+
+type errorRule struct {
+	matches func(err error) bool
+	mapping ErrorMapping
+}
+
+// ErrorRegistry maps the domain errors to statuses. Rules are evaluated in registration order
+type ErrorRegistry struct {
+	mu    sync.RWMutex
+	rules []errorRule
+}
+
+// NewErrorRegistry creates an empty registry
+func NewErrorRegistry() *ErrorRegistry {
+	return &ErrorRegistry{}
+}
+
+// Register maps the errors matching the sentinel with errors.Is
+func (r *ErrorRegistry) Register(target error, mapping ErrorMapping) *ErrorRegistry {
+	return r.RegisterFunc(func(err error) bool {
+		return errors.Is(err, target)
+	}, mapping)
+}
+
+// RegisterType maps the errors having the type of the example in their chain, matched with errors.As.
+// E.g. RegisterType(&NotFoundError{}, mapping) matches every error wrapping a *NotFoundError
+func (r *ErrorRegistry) RegisterType(example error, mapping ErrorMapping) *ErrorRegistry {
+	if example == nil {
+		panic("interceptors: RegisterType example must not be nil")
+	}
+	errType := reflect.TypeOf(example)
+	return r.RegisterFunc(func(err error) bool {
+		return errors.As(err, reflect.New(errType).Interface())
+	}, mapping)
+}
+
+// RegisterFunc maps the errors accepted by the predicate
+func (r *ErrorRegistry) RegisterFunc(matches func(err error) bool, mapping ErrorMapping) *ErrorRegistry {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.rules = append(r.rules, errorRule{matches: matches, mapping: mapping})
+	return r
+}
+
+// Lookup returns the mapping of the first rule matching the error
+func (r *ErrorRegistry) Lookup(err error) (ErrorMapping, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, rule := range r.rules {
+		if rule.matches(err) {
+			return rule.mapping, true
+		}
+	}
+	return ErrorMapping{}, false
+}
+
+// ErrorMappingOption configures the error mapping interceptors
+type ErrorMappingOption func(*errorMappingConfig)
+
+type errorMappingConfig struct {
+	registry        *ErrorRegistry
+	domain          string
+	debug           bool
+	scrubbedMessage string
+	logger          logging.Logger
+}
+
+// WithErrorRegistry sets the registry mapping the domain errors
+func WithErrorRegistry(registry *ErrorRegistry) ErrorMappingOption {
+	return func(c *errorMappingConfig) {
+		c.registry = registry
+	}
+}
+
+// WithErrorDomain sets the ErrorInfo domain of the mappings not setting one, usually the service name
+func WithErrorDomain(domain string) ErrorMappingOption {
+	return func(c *errorMappingConfig) {
+		c.domain = domain
+	}
+}
+
+// WithDebugDetails attaches a DebugInfo detail with the original error message to every mapped error.
+// It exposes internal details, enable it only outside production
+func WithDebugDetails(enabled bool) ErrorMappingOption {
+	return func(c *errorMappingConfig) {
+		c.debug = enabled
+	}
+}
+
+// WithScrubbedMessage sets the message replacing the one of the unmapped errors. DefaultScrubbedMessage is used otherwise
+func WithScrubbedMessage(message string) ErrorMappingOption {
+	return func(c *errorMappingConfig) {
+		c.scrubbedMessage = message
+	}
+}
+
+// WithErrorMappingLogger sets the logger receiving the unmapped errors before they are scrubbed.
+// The default logger is used otherwise
+func WithErrorMappingLogger(logger logging.Logger) ErrorMappingOption {
+	return func(c *errorMappingConfig) {
+		c.logger = logger
+	}
+}
+
+func newErrorMappingConfig(opts []ErrorMappingOption) *errorMappingConfig {
+	cfg := &errorMappingConfig{
+		registry:        NewErrorRegistry(),
+		scrubbedMessage: DefaultScrubbedMessage,
+	}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	cfg.logger = logging.OrDefault(cfg.logger)
+	return cfg
+}
+
+// UnaryErrorMapping converts the plain errors returned by the handler into statuses with rich details.
+// The registry is consulted first, so it can override status errors such as *grpcerrors.Error sentinels.
+// The other status errors are returned untouched, context errors become Canceled or DeadlineExceeded and the errors
+// unknown to the registry become Internal with a scrubbed message
+func UnaryErrorMapping(opts ...ErrorMappingOption) grpc.UnaryServerInterceptor {
+	cfg := newErrorMappingConfig(opts)
+	return func(
+		ctx context.Context,
+		req interface{},
+		info *grpc.UnaryServerInfo,
+		handler grpc.UnaryHandler) (_ interface{}, err error) {
+		resp, err := handler(ctx, req)
+		if err != nil {
+			return resp, cfg.mapError(ctx, info.FullMethod, err)
+		}
+		return resp, nil
+	}
+}
+
+// StreamErrorMapping converts the plain errors returned by the stream handler into statuses with rich details
+func StreamErrorMapping(opts ...ErrorMappingOption) grpc.StreamServerInterceptor {
+	cfg := newErrorMappingConfig(opts)
+	return func(
+		srv interface{},
+		stream grpc.ServerStream,
+		info *grpc.StreamServerInfo,
+		handler grpc.StreamHandler) (err error) {
+		if err := handler(srv, stream); err != nil {
+			return cfg.mapError(stream.Context(), info.FullMethod, err)
+		}
+		return nil
+	}
+}
+
+func (c *errorMappingConfig) mapError(ctx context.Context, fullMethod string, err error) error {
+	if mapping, ok := c.registry.Lookup(err); ok {
+		return c.mappedStatus(ctx, mapping, err)
+	}
+	if _, ok := status.FromError(err); ok {
+		return err
+	}
+	if errors.Is(err, context.Canceled) {
+		return status.Error(codes.Canceled, context.Canceled.Error())
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return status.Error(codes.DeadlineExceeded, context.DeadlineExceeded.Error())
+	}
+	c.logger.Error("unmapped error returned by the handler", "method", fullMethod, "err", err)
+	return withDetails(status.New(codes.Internal, c.scrubbedMessage), c.debugInfo(err)...)
+}
+
+func (c *errorMappingConfig) mappedStatus(ctx context.Context, mapping ErrorMapping, err error) error {
+	message := mapping.Message
+	if message == "" {
+		message = err.Error()
+	}
+	var details []proto.Message
+	if mapping.Reason != "" {
+		domain := mapping.Domain
+		if domain == "" {
+			domain = c.domain
+		}
+		details = append(details, &errdetails.ErrorInfo{
+			Reason:   mapping.Reason,
+			Domain:   domain,
+			Metadata: mapping.Metadata,
+		})
+	}
+	if mapping.RetryDelay > 0 {
+		details = append(details, &errdetails.RetryInfo{RetryDelay: ptypes.DurationProto(mapping.RetryDelay)})
+	}
+	if mapping.Localize != nil {
+		locale := baggage.Locale(ctx)
+		if localized := mapping.Localize(locale, err); localized != "" {
+			details = append(details, &errdetails.LocalizedMessage{Locale: locale, Message: localized})
+		}
+	}
+	details = append(details, c.debugInfo(err)...)
+	return withDetails(status.New(mapping.Code, message), details...)
+}
+
+func (c *errorMappingConfig) debugInfo(err error) []proto.Message {
+	if !c.debug {
+		return nil
+	}
+	return []proto.Message{&errdetails.DebugInfo{Detail: fmt.Sprintf("%+v", err)}}
+}
+
+// withDetails returns the status error with the details, without them if they cannot be encoded
+func withDetails(sts *status.Status, details ...proto.Message) error {
+	if len(details) == 0 {
+		return sts.Err()
+	}
+	detailed, err := sts.WithDetails(details...)
+	if err != nil {
+		return sts.Err()
+	}
+	return detailed.Err()
+}
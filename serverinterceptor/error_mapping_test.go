@@ -0,0 +1,134 @@
+package interceptors
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/apssouza22/grpc-production-go/baggage"
+	"github.com/apssouza22/grpc-production-go/grpcerrors"
+	"github.com/apssouza22/grpc-production-go/logging"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"log"
+	"testing"
+	"time"
+)
+
+var errUserNotFound = errors.New("user not found")
+
+type quotaError struct {
+	limit int
+}
+
+func (e *quotaError) Error() string {
+	return fmt.Sprintf("quota of %d exceeded", e.limit)
+}
+
+func newTestErrorRegistry() *ErrorRegistry {
+	return NewErrorRegistry().
+		Register(errUserNotFound, ErrorMapping{
+			Code:   codes.NotFound,
+			Reason: "USER_NOT_FOUND",
+			Localize: func(locale string, err error) string {
+				if locale == "pt" {
+					return "usuário não encontrado"
+				}
+				return ""
+			},
+		}).
+		RegisterType(&quotaError{}, ErrorMapping{
+			Code:       codes.ResourceExhausted,
+			Message:    "quota exceeded",
+			Reason:     "QUOTA_EXCEEDED",
+			Domain:     "billing",
+			RetryDelay: 2 * time.Second,
+		})
+}
+
+func callWithError(interceptor grpc.UnaryServerInterceptor, ctx context.Context, err error) error {
+	_, err = interceptor(ctx, "req", &grpc.UnaryServerInfo{FullMethod: "/svc/Method"}, func(ctx context.Context, req interface{}) (interface{}, error) {
+		return nil, err
+	})
+	return err
+}
+
+func TestUnaryErrorMappingSentinel(t *testing.T) {
+	interceptor := UnaryErrorMapping(WithErrorRegistry(newTestErrorRegistry()), WithErrorDomain("users"))
+	ctx := baggage.WithLocale(context.Background(), "pt")
+	err := callWithError(interceptor, ctx, fmt.Errorf("loading profile: %w", errUserNotFound))
+
+	decoded, ok := grpcerrors.FromError(err)
+	assert.True(t, ok)
+	assert.Equal(t, codes.NotFound, decoded.Code)
+	assert.Equal(t, "loading profile: user not found", decoded.Message)
+	assert.Equal(t, "USER_NOT_FOUND", decoded.Reason)
+	assert.Equal(t, "users", decoded.Domain)
+	assert.Equal(t, "pt", decoded.Locale)
+	assert.Equal(t, "usuário não encontrado", decoded.LocalizedMessage)
+	assert.Empty(t, decoded.DebugDetail)
+}
+
+func TestUnaryErrorMappingType(t *testing.T) {
+	interceptor := UnaryErrorMapping(WithErrorRegistry(newTestErrorRegistry()))
+	err := callWithError(interceptor, context.Background(), fmt.Errorf("charging: %w", &quotaError{limit: 10}))
+
+	decoded, _ := grpcerrors.FromError(err)
+	assert.Equal(t, codes.ResourceExhausted, decoded.Code)
+	assert.Equal(t, "quota exceeded", decoded.Message)
+	assert.Equal(t, "billing", decoded.Domain)
+	assert.Equal(t, 2*time.Second, decoded.RetryDelay)
+	assert.Empty(t, decoded.LocalizedMessage)
+}
+
+func TestUnaryErrorMappingScrubsUnmappedErrors(t *testing.T) {
+	var buf bytes.Buffer
+	interceptor := UnaryErrorMapping(WithErrorMappingLogger(logging.NewStdLogger(log.New(&buf, "", 0))))
+	err := callWithError(interceptor, context.Background(), errors.New("pq: password authentication failed"))
+
+	sts := status.Convert(err)
+	assert.Equal(t, codes.Internal, sts.Code())
+	assert.Equal(t, DefaultScrubbedMessage, sts.Message())
+	assert.Empty(t, sts.Details())
+	assert.Contains(t, buf.String(), "password authentication failed")
+
+	interceptor = UnaryErrorMapping(WithDebugDetails(true), WithScrubbedMessage("oops"), WithErrorMappingLogger(logging.Nop()))
+	err = callWithError(interceptor, context.Background(), errors.New("pq: password authentication failed"))
+	decoded, _ := grpcerrors.FromError(err)
+	assert.Equal(t, "oops", decoded.Message)
+	assert.Equal(t, "pq: password authentication failed", decoded.DebugDetail)
+}
+
+func TestUnaryErrorMappingPassThrough(t *testing.T) {
+	interceptor := UnaryErrorMapping()
+	original := status.Error(codes.AlreadyExists, "exists")
+	assert.Equal(t, original, callWithError(interceptor, context.Background(), original))
+	assert.NoError(t, callWithError(interceptor, context.Background(), nil))
+	assert.Equal(t, codes.DeadlineExceeded, status.Code(callWithError(interceptor, context.Background(), fmt.Errorf("query: %w", context.DeadlineExceeded))))
+}
+
+func TestUnaryErrorMappingOverridesGrpcError(t *testing.T) {
+	errDisabled := &grpcerrors.Error{Code: codes.FailedPrecondition, Domain: "users", Reason: "USER_DISABLED", Message: "user disabled"}
+	interceptor := UnaryErrorMapping()
+	decoded, _ := grpcerrors.FromError(callWithError(interceptor, context.Background(), errDisabled))
+	assert.Equal(t, codes.FailedPrecondition, decoded.Code)
+	assert.Equal(t, "users", decoded.Domain)
+	assert.Equal(t, "USER_DISABLED", decoded.Reason)
+
+	registry := NewErrorRegistry().Register(&grpcerrors.Error{Reason: "USER_DISABLED"}, ErrorMapping{Code: codes.PermissionDenied, Reason: "ACCOUNT_DISABLED"})
+	interceptor = UnaryErrorMapping(WithErrorRegistry(registry), WithErrorDomain("accounts"))
+	decoded, _ = grpcerrors.FromError(callWithError(interceptor, context.Background(), errDisabled))
+	assert.Equal(t, codes.PermissionDenied, decoded.Code)
+	assert.Equal(t, "accounts", decoded.Domain)
+	assert.Equal(t, "ACCOUNT_DISABLED", decoded.Reason)
+}
+
+func TestStreamErrorMapping(t *testing.T) {
+	interceptor := StreamErrorMapping(WithErrorRegistry(newTestErrorRegistry()))
+	err := interceptor(nil, ServerStreamMock{}, &grpc.StreamServerInfo{FullMethod: "/svc/Method"}, func(srv interface{}, stream grpc.ServerStream) error {
+		return errUserNotFound
+	})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+}
@@ -0,0 +1,367 @@
+package interceptors
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"github.com/apssouza22/grpc-production-go/internal/glob"
+	"github.com/apssouza22/grpc-production-go/internal/lru"
+	"github.com/apssouza22/grpc-production-go/logging"
+	"github.com/golang/protobuf/proto"
+	spb "google.golang.org/genproto/googleapis/rpc/status"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Metadata keys of the idempotency interceptor
+const (
+	// IdempotencyKeyHeader is the request header carrying the client generated idempotency key
+	IdempotencyKeyHeader = "idempotency-key"
+	// IdempotencyReplayedHeader is set to true in the response headers of the replayed calls
+	IdempotencyReplayedHeader = "idempotency-replayed"
+)
+
+// DefaultIdempotencyTTL is how long the results are kept when the method does not set a TTL
+const DefaultIdempotencyTTL = 24 * time.Hour
+
+// maxIdempotencyKeyLength bounds the size of the keys accepted from the clients
+const maxIdempotencyKeyLength = 255
+
+// IdempotencyRecord is the stored result of the first completed call with an idempotency key
+type IdempotencyRecord struct {
+	// RequestHash identifies the request, a key reused with a different request is rejected
+	RequestHash string
+	// ResponseType is the full name of the response message
+	ResponseType string
+	// Response is the encoded response message, empty when the call failed
+	Response []byte
+	// Status is the encoded google.rpc.Status of the failed call, empty when it succeeded
+	Status []byte
+}
+
+// IdempotencyStore keeps the results of the calls. Implement it to share them across instances (e.g. Redis)
+type IdempotencyStore interface {
+	Get(ctx context.Context, key string) (*IdempotencyRecord, bool, error)
+	Set(ctx context.Context, key string, record *IdempotencyRecord, ttl time.Duration) error
+}
+
+// MemoryIdempotencyStore is an in-memory IdempotencyStore evicting the least recently used records
+type MemoryIdempotencyStore struct {
+	cache *lru.Cache
+}
+
+// NewMemoryIdempotencyStore creates a store keeping up to maxEntries records
+func NewMemoryIdempotencyStore(maxEntries int) *MemoryIdempotencyStore {
+	return &MemoryIdempotencyStore{cache: lru.New(maxEntries, 0)}
+}
+
+// Get returns the record of the key
+func (s *MemoryIdempotencyStore) Get(ctx context.Context, key string) (*IdempotencyRecord, bool, error) {
+	record, ok := s.cache.Get(key)
+	if !ok {
+		return nil, false, nil
+	}
+	return record.(*IdempotencyRecord), true, nil
+}
+
+// Set stores the record of the key for the ttl
+func (s *MemoryIdempotencyStore) Set(ctx context.Context, key string, record *IdempotencyRecord, ttl time.Duration) error {
+	s.cache.Add(key, record, 0, s.cache.Now().Add(ttl))
+	return nil
+}
+
+// IdempotentMethod configures the deduplication of a method
+type IdempotentMethod struct {
+	// TTL is how long the result is replayed. Zero uses DefaultIdempotencyTTL
+	TTL time.Duration
+	// RequireKey rejects the calls without idempotency key
+	RequireKey bool
+}
+
+// IdempotencyOption configures the idempotency interceptor
+type IdempotencyOption func(*idempotencyConfig)
+
+type idempotencyConfig struct {
+	store    IdempotencyStore
+	methods  []idempotentMethodRule
+	logger   logging.Logger
+	mu       sync.Mutex
+	inFlight map[string]*idempotentCall
+}
+
+type idempotentMethodRule struct {
+	glob   string
+	method IdempotentMethod
+}
+
+// idempotentCall is a call being executed, waited by its concurrent duplicates
+type idempotentCall struct {
+	done   chan struct{}
+	record *IdempotencyRecord
+}
+
+// WithIdempotencyStore sets the store of the results. An in-memory store of 10000 records is used otherwise
+func WithIdempotencyStore(store IdempotencyStore) IdempotencyOption {
+	return func(c *idempotencyConfig) {
+		c.store = store
+	}
+}
+
+// WithIdempotentMethod enables the deduplication of the methods matching the glob, e.g. "/bank.Payments/*".
+// The calls to the other methods are never deduplicated
+func WithIdempotentMethod(glob string, method IdempotentMethod) IdempotencyOption {
+	return func(c *idempotencyConfig) {
+		c.methods = append(c.methods, idempotentMethodRule{glob: glob, method: method})
+	}
+}
+
+// WithIdempotencyLogger sets the logger receiving the store failures. The default logger is used otherwise
+func WithIdempotencyLogger(logger logging.Logger) IdempotencyOption {
+	return func(c *idempotencyConfig) {
+		c.logger = logger
+	}
+}
+
+func newIdempotencyConfig(opts []IdempotencyOption) *idempotencyConfig {
+	cfg := &idempotencyConfig{
+		inFlight: make(map[string]*idempotentCall),
+	}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	if cfg.store == nil {
+		cfg.store = NewMemoryIdempotencyStore(10000)
+	}
+	cfg.logger = logging.OrDefault(cfg.logger)
+	return cfg
+}
+
+// UnaryIdempotency replays the result of the first completed call carrying the same idempotency-key header,
+// instead of executing the handler again. Concurrent duplicates wait for the call in flight.
+// Keys are scoped by method, tenant and principal. Failures worth retrying (e.g. Unavailable) are not stored.
+// Only the methods enabled with WithIdempotentMethod are deduplicated
+func UnaryIdempotency(opts ...IdempotencyOption) grpc.UnaryServerInterceptor {
+	cfg := newIdempotencyConfig(opts)
+	return func(
+		ctx context.Context,
+		req interface{},
+		info *grpc.UnaryServerInfo,
+		handler grpc.UnaryHandler) (_ interface{}, err error) {
+		method, ok := cfg.method(info.FullMethod)
+		if !ok {
+			return handler(ctx, req)
+		}
+		key := idempotencyKey(ctx)
+		if key == "" {
+			if method.RequireKey {
+				return nil, status.Errorf(codes.InvalidArgument, "missing %s header", IdempotencyKeyHeader)
+			}
+			return handler(ctx, req)
+		}
+		if len(key) > maxIdempotencyKeyLength {
+			return nil, status.Errorf(codes.InvalidArgument, "%s header is too long", IdempotencyKeyHeader)
+		}
+		reqMsg, ok := req.(proto.Message)
+		if !ok {
+			return handler(ctx, req)
+		}
+		hash, err := requestHash(reqMsg)
+		if err != nil {
+			return handler(ctx, req)
+		}
+		return cfg.dedupe(ctx, scopedIdempotencyKey(ctx, info.FullMethod, key), hash, method, req, handler)
+	}
+}
+
+func (c *idempotencyConfig) method(fullMethod string) (IdempotentMethod, bool) {
+	for _, rule := range c.methods {
+		if glob.Match(rule.glob, fullMethod) {
+			return rule.method, true
+		}
+	}
+	return IdempotentMethod{}, false
+}
+
+func (c *idempotencyConfig) dedupe(
+	ctx context.Context,
+	key string,
+	hash string,
+	method IdempotentMethod,
+	req interface{},
+	handler grpc.UnaryHandler) (interface{}, error) {
+	for {
+		record, found, err := c.store.Get(ctx, key)
+		if err != nil {
+			c.logger.Error("failed to read the idempotency store", "err", err)
+			return nil, status.Error(codes.Unavailable, "unable to check the idempotency key")
+		}
+		if found {
+			return replay(ctx, record, hash)
+		}
+
+		c.mu.Lock()
+		call, waiting := c.inFlight[key]
+		if !waiting {
+			call = &idempotentCall{done: make(chan struct{})}
+			c.inFlight[key] = call
+		}
+		c.mu.Unlock()
+
+		if waiting {
+			select {
+			case <-call.done:
+			case <-ctx.Done():
+				return nil, status.FromContextError(ctx.Err()).Err()
+			}
+			if call.record != nil {
+				return replay(ctx, call.record, hash)
+			}
+			// The call failed with an error worth retrying, the next duplicate executes the handler again
+			continue
+		}
+		return c.execute(ctx, key, hash, method, call, req, handler)
+	}
+}
+
+func (c *idempotencyConfig) execute(
+	ctx context.Context,
+	key string,
+	hash string,
+	method IdempotentMethod,
+	call *idempotentCall,
+	req interface{},
+	handler grpc.UnaryHandler) (interface{}, error) {
+	defer func() {
+		c.mu.Lock()
+		delete(c.inFlight, key)
+		c.mu.Unlock()
+		close(call.done)
+	}()
+	// A duplicate may have completed between the store lookup and the registration of the call
+	record, found, err := c.store.Get(ctx, key)
+	if err != nil {
+		c.logger.Error("failed to read the idempotency store", "err", err)
+		return nil, status.Error(codes.Unavailable, "unable to check the idempotency key")
+	}
+	if found {
+		call.record = record
+		return replay(ctx, record, hash)
+	}
+	resp, err := handler(ctx, req)
+	record = newIdempotencyRecord(hash, resp, err)
+	if record == nil {
+		return resp, err
+	}
+	ttl := method.TTL
+	if ttl <= 0 {
+		ttl = DefaultIdempotencyTTL
+	}
+	if storeErr := c.store.Set(ctx, key, record, ttl); storeErr != nil {
+		c.logger.Error("failed to write the idempotency store", "err", storeErr)
+	}
+	call.record = record
+	return resp, err
+}
+
+// newIdempotencyRecord encodes the result of the call, nil when it must not be replayed
+func newIdempotencyRecord(hash string, resp interface{}, err error) *IdempotencyRecord {
+	if err != nil {
+		sts := status.Convert(err)
+		if isRetryableCode(sts.Code()) {
+			return nil
+		}
+		encoded, marshalErr := proto.Marshal(sts.Proto())
+		if marshalErr != nil {
+			return nil
+		}
+		return &IdempotencyRecord{RequestHash: hash, Status: encoded}
+	}
+	msg, ok := resp.(proto.Message)
+	if !ok || msg == nil || reflect.ValueOf(msg).IsNil() {
+		return nil
+	}
+	encoded, marshalErr := proto.Marshal(msg)
+	if marshalErr != nil {
+		return nil
+	}
+	return &IdempotencyRecord{RequestHash: hash, ResponseType: proto.MessageName(msg), Response: encoded}
+}
+
+// replay returns the stored result of the call
+func replay(ctx context.Context, record *IdempotencyRecord, hash string) (interface{}, error) {
+	if record.RequestHash != hash {
+		return nil, status.Errorf(codes.InvalidArgument, "%s reused with a different request", IdempotencyKeyHeader)
+	}
+	// It fails only when there is no transport stream (e.g. unit tests), nothing to flag then
+	_ = grpc.SetHeader(ctx, metadata.Pairs(IdempotencyReplayedHeader, "true"))
+	if len(record.Status) > 0 {
+		sts := &spb.Status{}
+		if err := proto.Unmarshal(record.Status, sts); err != nil {
+			return nil, status.Error(codes.Internal, "unable to decode the stored status")
+		}
+		return nil, status.ErrorProto(sts)
+	}
+	msgType := proto.MessageType(record.ResponseType)
+	if msgType == nil || msgType.Kind() != reflect.Ptr {
+		return nil, status.Errorf(codes.Internal, "unknown stored response type %q", record.ResponseType)
+	}
+	resp := reflect.New(msgType.Elem()).Interface().(proto.Message)
+	if err := proto.Unmarshal(record.Response, resp); err != nil {
+		return nil, status.Error(codes.Internal, "unable to decode the stored response")
+	}
+	return resp, nil
+}
+
+// isRetryableCode reports the transient failures a client retry may fix, never replayed
+func isRetryableCode(code codes.Code) bool {
+	switch code {
+	case codes.Canceled, codes.DeadlineExceeded, codes.Unavailable, codes.Aborted, codes.ResourceExhausted:
+		return true
+	}
+	return false
+}
+
+func idempotencyKey(ctx context.Context) string {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return ""
+	}
+	values := md.Get(IdempotencyKeyHeader)
+	if len(values) == 0 {
+		return ""
+	}
+	return strings.TrimSpace(values[0])
+}
+
+// scopedIdempotencyKey prevents keys from colliding across methods, tenants and principals
+func scopedIdempotencyKey(ctx context.Context, fullMethod string, key string) string {
+	tenant, _ := TenantFromContext(ctx)
+	principal, _ := PrincipalFromContext(ctx)
+	return strings.Join([]string{fullMethod, tenant, principal, key}, "\x00")
+}
+
+// requestHash identifies the request by its deterministic encoding
+func requestHash(msg proto.Message) (string, error) {
+	encoded, err := deterministicMarshal(msg)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(encoded)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// deterministicMarshal encodes the message with the map entries sorted, so equal messages have equal encodings
+func deterministicMarshal(msg proto.Message) ([]byte, error) {
+	var buf proto.Buffer
+	buf.SetDeterministic(true)
+	if err := buf.Marshal(msg); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,224 @@
+package interceptors
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/examples/helloworld/helloworld"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+var chargeIdempotent = WithIdempotentMethod("/bank.Payments/Charge", IdempotentMethod{})
+
+func idempotentContext(key string) context.Context {
+	return metadata.NewIncomingContext(context.Background(), metadata.Pairs(IdempotencyKeyHeader, key))
+}
+
+func TestUnaryIdempotencyReplaysResponse(t *testing.T) {
+	interceptor := UnaryIdempotency(chargeIdempotent)
+	var calls int32
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		n := atomic.AddInt32(&calls, 1)
+		return &helloworld.HelloReply{Message: fmt.Sprintf("charged %d", n)}, nil
+	}
+	info := &grpc.UnaryServerInfo{FullMethod: "/bank.Payments/Charge"}
+	req := &helloworld.HelloRequest{Name: "alice"}
+
+	first, err := interceptor(idempotentContext("k1"), req, info, handler)
+	assert.NoError(t, err)
+	second, err := interceptor(idempotentContext("k1"), req, info, handler)
+	assert.NoError(t, err)
+	assert.Equal(t, "charged 1", second.(*helloworld.HelloReply).Message)
+	assert.Equal(t, first.(*helloworld.HelloReply).Message, second.(*helloworld.HelloReply).Message)
+
+	_, err = interceptor(idempotentContext("k2"), req, info, handler)
+	assert.NoError(t, err)
+	_, err = interceptor(context.Background(), req, info, handler)
+	assert.NoError(t, err)
+	assert.Equal(t, int32(3), atomic.LoadInt32(&calls))
+}
+
+func TestUnaryIdempotencyReplaysStatus(t *testing.T) {
+	interceptor := UnaryIdempotency(chargeIdempotent)
+	var calls int32
+	info := &grpc.UnaryServerInfo{FullMethod: "/bank.Payments/Charge"}
+	req := &helloworld.HelloRequest{Name: "alice"}
+	failing := func(ctx context.Context, req interface{}) (interface{}, error) {
+		atomic.AddInt32(&calls, 1)
+		return nil, status.Error(codes.FailedPrecondition, "insufficient funds")
+	}
+	interceptor(idempotentContext("k1"), req, info, failing)
+	_, err := interceptor(idempotentContext("k1"), req, info, failing)
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+	assert.Equal(t, "insufficient funds", status.Convert(err).Message())
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+
+	transient := func(ctx context.Context, req interface{}) (interface{}, error) {
+		atomic.AddInt32(&calls, 1)
+		return nil, status.Error(codes.Unavailable, "down")
+	}
+	interceptor(idempotentContext("k2"), req, info, transient)
+	interceptor(idempotentContext("k2"), req, info, transient)
+	assert.Equal(t, int32(3), atomic.LoadInt32(&calls))
+}
+
+func TestUnaryIdempotencyRejectsReusedKey(t *testing.T) {
+	interceptor := UnaryIdempotency(chargeIdempotent)
+	info := &grpc.UnaryServerInfo{FullMethod: "/bank.Payments/Charge"}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return &helloworld.HelloReply{}, nil
+	}
+	interceptor(idempotentContext("k1"), &helloworld.HelloRequest{Name: "alice"}, info, handler)
+	_, err := interceptor(idempotentContext("k1"), &helloworld.HelloRequest{Name: "bob"}, info, handler)
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestUnaryIdempotencyConcurrentDuplicatesWait(t *testing.T) {
+	interceptor := UnaryIdempotency(chargeIdempotent)
+	var calls int32
+	release := make(chan struct{})
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		atomic.AddInt32(&calls, 1)
+		<-release
+		return &helloworld.HelloReply{Message: "done"}, nil
+	}
+	info := &grpc.UnaryServerInfo{FullMethod: "/bank.Payments/Charge"}
+	req := &helloworld.HelloRequest{Name: "alice"}
+
+	var wg sync.WaitGroup
+	replies := make([]string, 5)
+	for i := range replies {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			resp, err := interceptor(idempotentContext("k1"), req, info, handler)
+			assert.NoError(t, err)
+			replies[i] = resp.(*helloworld.HelloReply).Message
+		}(i)
+	}
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+	assert.Equal(t, []string{"done", "done", "done", "done", "done"}, replies)
+}
+
+func TestUnaryIdempotencyWaiterDeadline(t *testing.T) {
+	interceptor := UnaryIdempotency(chargeIdempotent)
+	release := make(chan struct{})
+	defer close(release)
+	info := &grpc.UnaryServerInfo{FullMethod: "/bank.Payments/Charge"}
+	req := &helloworld.HelloRequest{Name: "alice"}
+	go interceptor(idempotentContext("k1"), req, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+		<-release
+		return &helloworld.HelloReply{}, nil
+	})
+	time.Sleep(10 * time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(idempotentContext("k1"), 10*time.Millisecond)
+	defer cancel()
+	_, err := interceptor(ctx, req, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+		t.Fatal("duplicate executed")
+		return nil, nil
+	})
+	assert.Equal(t, codes.DeadlineExceeded, status.Code(err))
+}
+
+func TestUnaryIdempotencyPerMethod(t *testing.T) {
+	interceptor := UnaryIdempotency(WithIdempotentMethod("/bank.Payments/*", IdempotentMethod{RequireKey: true, TTL: time.Minute}))
+	var calls int32
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		atomic.AddInt32(&calls, 1)
+		return &helloworld.HelloReply{}, nil
+	}
+	req := &helloworld.HelloRequest{Name: "alice"}
+
+	_, err := interceptor(context.Background(), req, &grpc.UnaryServerInfo{FullMethod: "/bank.Payments/Charge"}, handler)
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	info := &grpc.UnaryServerInfo{FullMethod: "/bank.Accounts/Get"}
+	interceptor(idempotentContext("k1"), req, info, handler)
+	interceptor(idempotentContext("k1"), req, info, handler)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&calls))
+}
+
+func TestUnaryIdempotencyOptIn(t *testing.T) {
+	interceptor := UnaryIdempotency()
+	var calls int32
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		atomic.AddInt32(&calls, 1)
+		return &helloworld.HelloReply{}, nil
+	}
+	info := &grpc.UnaryServerInfo{FullMethod: "/bank.Payments/Charge"}
+	interceptor(idempotentContext("k1"), &helloworld.HelloRequest{}, info, handler)
+	interceptor(idempotentContext("k1"), &helloworld.HelloRequest{}, info, handler)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&calls))
+}
+
+func TestUnaryIdempotencyRechecksStoreAfterRegistering(t *testing.T) {
+	store := &completingIdempotencyStore{MemoryIdempotencyStore: NewMemoryIdempotencyStore(10)}
+	interceptor := UnaryIdempotency(chargeIdempotent, WithIdempotencyStore(store))
+	req := &helloworld.HelloRequest{Name: "alice"}
+	hash, _ := requestHash(req)
+	store.completed = newIdempotencyRecord(hash, &helloworld.HelloReply{Message: "charged by the duplicate"}, nil)
+
+	resp, err := interceptor(idempotentContext("k1"), req, &grpc.UnaryServerInfo{FullMethod: "/bank.Payments/Charge"}, func(ctx context.Context, req interface{}) (interface{}, error) {
+		t.Fatal("duplicate executed")
+		return nil, nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "charged by the duplicate", resp.(*helloworld.HelloReply).Message)
+}
+
+// completingIdempotencyStore misses the first lookup and returns the completed record afterwards,
+// as if a duplicate completed between the lookup and the registration of the call
+type completingIdempotencyStore struct {
+	*MemoryIdempotencyStore
+	completed *IdempotencyRecord
+	lookups   int32
+}
+
+func (s *completingIdempotencyStore) Get(ctx context.Context, key string) (*IdempotencyRecord, bool, error) {
+	if atomic.AddInt32(&s.lookups, 1) == 1 {
+		return nil, false, nil
+	}
+	return s.completed, true, nil
+}
+
+func TestUnaryIdempotencyStoreFailure(t *testing.T) {
+	interceptor := UnaryIdempotency(chargeIdempotent, WithIdempotencyStore(failingIdempotencyStore{}))
+	_, err := interceptor(idempotentContext("k1"), &helloworld.HelloRequest{}, &grpc.UnaryServerInfo{FullMethod: "/bank.Payments/Charge"}, func(ctx context.Context, req interface{}) (interface{}, error) {
+		return &helloworld.HelloReply{}, nil
+	})
+	assert.Equal(t, codes.Unavailable, status.Code(err))
+}
+
+func TestMemoryIdempotencyStoreExpiration(t *testing.T) {
+	store := NewMemoryIdempotencyStore(10)
+	now := time.Now()
+	store.cache.Now = func() time.Time { return now }
+	store.Set(context.Background(), "k1", &IdempotencyRecord{RequestHash: "h"}, time.Minute)
+	_, found, _ := store.Get(context.Background(), "k1")
+	assert.True(t, found)
+	now = now.Add(time.Minute)
+	_, found, _ = store.Get(context.Background(), "k1")
+	assert.False(t, found)
+}
+
+type failingIdempotencyStore struct{}
+
+func (failingIdempotencyStore) Get(ctx context.Context, key string) (*IdempotencyRecord, bool, error) {
+	return nil, false, errors.New("down")
+}
+
+func (failingIdempotencyStore) Set(ctx context.Context, key string, record *IdempotencyRecord, ttl time.Duration) error {
+	return errors.New("down")
+}
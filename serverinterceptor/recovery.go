@@ -0,0 +1,170 @@
+package interceptors
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"github.com/apssouza22/grpc-production-go/logging"
+	"github.com/apssouza22/grpc-production-go/metrics"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"runtime/debug"
+)
+
+// PanicsMetric is the counter incremented on every recovered panic, labeled by method and tenant (see UnknownTenantLabel)
+const PanicsMetric = "grpc_server_panics_total"
+
+// DefaultPanicMessage is the message of the error returned to the client after a panic, unless WithRecoveryMessage is set
+const DefaultPanicMessage = "Something went wrong :( "
+
+// PanicInfo describes a recovered panic
+type PanicInfo struct {
+	FullMethod string
+	RequestID  string
+	// Value is the value passed to panic
+	Value interface{}
+	// Stack is the stack trace of the panicking goroutine
+	Stack []byte
+	// ErrorID identifies the panic in the logs, empty unless WithPanicErrorID is set
+	ErrorID string
+}
+
+// RecoveryHandler builds the error returned to the client after a panic. Returning nil uses the default error
+type RecoveryHandler func(ctx context.Context, info PanicInfo) error
+
+// RecoveryOption configures the recovery interceptors
+type RecoveryOption func(*recoveryConfig)
+
+type recoveryConfig struct {
+	logger  logging.Logger
+	metrics metrics.Provider
+	panics  metrics.Counter
+	handler RecoveryHandler
+	errorID bool
+	message string
+}
+
+// WithRecoveryLogger sets the logger receiving the panics with their stack trace. The default logger is used otherwise
+func WithRecoveryLogger(logger logging.Logger) RecoveryOption {
+	return func(c *recoveryConfig) {
+		c.logger = logger
+	}
+}
+
+// WithRecoveryMetrics sets the provider of the PanicsMetric counter. The default provider is used otherwise
+func WithRecoveryMetrics(provider metrics.Provider) RecoveryOption {
+	return func(c *recoveryConfig) {
+		c.metrics = provider
+	}
+}
+
+// WithRecoveryHandler sets the handler building the error returned to the client
+func WithRecoveryHandler(handler RecoveryHandler) RecoveryOption {
+	return func(c *recoveryConfig) {
+		c.handler = handler
+	}
+}
+
+// WithPanicErrorID generates an error id for every panic, logged and sent to the client in the message and in
+// a RequestInfo detail, so it can be quoted to support
+func WithPanicErrorID() RecoveryOption {
+	return func(c *recoveryConfig) {
+		c.errorID = true
+	}
+}
+
+// WithRecoveryMessage sets the message of the default error, e.g. DefaultScrubbedMessage. DefaultPanicMessage is used otherwise
+func WithRecoveryMessage(message string) RecoveryOption {
+	return func(c *recoveryConfig) {
+		c.message = message
+	}
+}
+
+func newRecoveryConfig(opts []RecoveryOption) *recoveryConfig {
+	cfg := &recoveryConfig{message: DefaultPanicMessage}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	cfg.logger = logging.OrDefault(cfg.logger)
+	cfg.metrics = metrics.OrDefault(cfg.metrics)
+	cfg.panics = cfg.metrics.Counter(PanicsMetric)
+	return cfg
+}
+
+// UnaryRecovery recovers from the panics of the handler, returning an Internal error to the client.
+// It should typically be the last interceptor of the chain so the others operate on the recovered error
+func UnaryRecovery(opts ...RecoveryOption) grpc.UnaryServerInterceptor {
+	cfg := newRecoveryConfig(opts)
+	return func(
+		ctx context.Context,
+		req interface{},
+		info *grpc.UnaryServerInfo,
+		handler grpc.UnaryHandler) (_ interface{}, err error) {
+		defer func() {
+			if p := recover(); p != nil {
+				err = cfg.recovered(ctx, info.FullMethod, p)
+			}
+		}()
+		return handler(ctx, req)
+	}
+}
+
+// StreamRecovery recovers from the panics of the stream handler, closing the stream with an Internal error.
+// Panics of goroutines started by the handler cannot be recovered
+func StreamRecovery(opts ...RecoveryOption) grpc.StreamServerInterceptor {
+	cfg := newRecoveryConfig(opts)
+	return func(
+		srv interface{},
+		stream grpc.ServerStream,
+		info *grpc.StreamServerInfo,
+		handler grpc.StreamHandler) (err error) {
+		defer func() {
+			if p := recover(); p != nil {
+				err = cfg.recovered(stream.Context(), info.FullMethod, p)
+			}
+		}()
+		return handler(srv, stream)
+	}
+}
+
+func (c *recoveryConfig) recovered(ctx context.Context, fullMethod string, p interface{}) error {
+	info := PanicInfo{
+		FullMethod: fullMethod,
+		RequestID:  requestIDFromContext(ctx),
+		Value:      p,
+		Stack:      debug.Stack(),
+	}
+	if c.errorID {
+		info.ErrorID = newErrorID()
+	}
+	c.panics.Add(1, "method", fullMethod, "tenant", tenantLabel(ctx))
+	c.logger.Error("recovered from panic",
+		"method", fullMethod,
+		"request-id", info.RequestID,
+		"error-id", info.ErrorID,
+		"panic", p,
+		"stack", string(info.Stack),
+	)
+	if c.handler != nil {
+		if err := c.handler(ctx, info); err != nil {
+			return err
+		}
+	}
+	if info.ErrorID == "" {
+		return status.Error(codes.Internal, c.message)
+	}
+	sts := status.New(codes.Internal, fmt.Sprintf("%s (error id: %s)", c.message, info.ErrorID))
+	return withDetails(sts, &errdetails.RequestInfo{RequestId: info.ErrorID})
+}
+
+// newErrorID returns a random identifier short enough to be read over the phone
+func newErrorID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return ""
+	}
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,108 @@
+package interceptors
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"github.com/apssouza22/grpc-production-go/logging"
+	"github.com/apssouza22/grpc-production-go/metrics"
+	"github.com/apssouza22/grpc-production-go/requestid"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"log"
+	"strings"
+	"testing"
+)
+
+func panickingHandler(ctx context.Context, req interface{}) (interface{}, error) {
+	panic("boom")
+}
+
+func TestUnaryRecovery(t *testing.T) {
+	var buf bytes.Buffer
+	provider := metrics.NewMemory()
+	interceptor := UnaryRecovery(
+		WithRecoveryLogger(logging.NewStdLogger(log.New(&buf, "", 0))),
+		WithRecoveryMetrics(provider),
+	)
+	ctx := requestid.NewContext(context.Background(), "req-1")
+	_, err := interceptor(ctx, "req", &grpc.UnaryServerInfo{FullMethod: "/svc/Method"}, panickingHandler)
+
+	sts := status.Convert(err)
+	assert.Equal(t, codes.Internal, sts.Code())
+	assert.Equal(t, DefaultPanicMessage, sts.Message())
+	assert.Equal(t, float64(1), provider.Value(PanicsMetric, "method", "/svc/Method", "tenant", UnknownTenantLabel))
+	assert.Contains(t, buf.String(), "request-id=req-1")
+	assert.Contains(t, buf.String(), "panic=boom")
+	assert.Contains(t, buf.String(), "panickingHandler")
+}
+
+func TestUnaryRecoveryLabelsTenant(t *testing.T) {
+	provider := metrics.NewMemory()
+	interceptor := UnaryRecovery(WithRecoveryLogger(logging.Nop()), WithRecoveryMetrics(provider))
+	ctx := contextWithTenantLabel(context.Background(), "acme")
+	_, err := interceptor(ctx, "req", &grpc.UnaryServerInfo{FullMethod: "/svc/Method"}, panickingHandler)
+
+	assert.Equal(t, codes.Internal, status.Code(err))
+	assert.Equal(t, float64(1), provider.Value(PanicsMetric, "method", "/svc/Method", "tenant", "acme"))
+}
+
+func TestRecoveryNilMetricsUsesDefault(t *testing.T) {
+	interceptor := UnaryRecovery(WithRecoveryLogger(logging.Nop()), WithRecoveryMetrics(nil))
+	_, err := interceptor(context.Background(), "req", &grpc.UnaryServerInfo{FullMethod: "/svc/Method"}, panickingHandler)
+	assert.Equal(t, codes.Internal, status.Code(err))
+}
+
+func TestUnaryRecoveryErrorID(t *testing.T) {
+	var buf bytes.Buffer
+	interceptor := UnaryRecovery(WithPanicErrorID(), WithRecoveryLogger(logging.NewStdLogger(log.New(&buf, "", 0))))
+	_, err := interceptor(context.Background(), "req", &grpc.UnaryServerInfo{FullMethod: "/svc/Method"}, panickingHandler)
+
+	sts := status.Convert(err)
+	assert.Len(t, sts.Details(), 1)
+	errorID := sts.Details()[0].(*errdetails.RequestInfo).RequestId
+	assert.NotEmpty(t, errorID)
+	assert.True(t, strings.HasSuffix(sts.Message(), "(error id: "+errorID+")"))
+	assert.Contains(t, buf.String(), "error-id="+errorID)
+}
+
+func TestUnaryRecoveryMessage(t *testing.T) {
+	interceptor := UnaryRecovery(WithRecoveryLogger(logging.Nop()), WithRecoveryMessage(DefaultScrubbedMessage))
+	_, err := interceptor(context.Background(), "req", &grpc.UnaryServerInfo{FullMethod: "/svc/Method"}, panickingHandler)
+	assert.Equal(t, DefaultScrubbedMessage, status.Convert(err).Message())
+}
+
+func TestUnaryRecoveryCustomHandler(t *testing.T) {
+	var recovered PanicInfo
+	interceptor := UnaryRecovery(WithRecoveryLogger(logging.Nop()), WithRecoveryHandler(func(ctx context.Context, info PanicInfo) error {
+		recovered = info
+		return status.Error(codes.Unavailable, "try again")
+	}))
+	_, err := interceptor(context.Background(), "req", &grpc.UnaryServerInfo{FullMethod: "/svc/Method"}, panickingHandler)
+	assert.Equal(t, codes.Unavailable, status.Code(err))
+	assert.Equal(t, "boom", recovered.Value)
+	assert.Equal(t, "/svc/Method", recovered.FullMethod)
+	assert.NotEmpty(t, recovered.Stack)
+}
+
+func TestUnaryRecoveryWithoutPanic(t *testing.T) {
+	interceptor := UnaryRecovery()
+	original := errors.New("failed")
+	resp, err := interceptor(context.Background(), "req", &grpc.UnaryServerInfo{FullMethod: "/svc/Method"}, func(ctx context.Context, req interface{}) (interface{}, error) {
+		return "resp", original
+	})
+	assert.Equal(t, "resp", resp)
+	assert.Equal(t, original, err)
+}
+
+func TestStreamRecovery(t *testing.T) {
+	interceptor := StreamRecovery(WithRecoveryLogger(logging.Nop()))
+	err := interceptor(nil, ServerStreamMock{}, &grpc.StreamServerInfo{FullMethod: "/svc/Stream"}, func(srv interface{}, stream grpc.ServerStream) error {
+		stream.SendMsg("first")
+		panic("boom")
+	})
+	assert.Equal(t, codes.Internal, status.Code(err))
+}
@@ -2,26 +2,33 @@ package interceptors
 
 import (
 	"context"
-	logrus "github.com/sirupsen/logrus"
+	"github.com/apssouza22/grpc-production-go/internal/glob"
+	"github.com/golang/protobuf/proto"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/peer"
 	"google.golang.org/grpc/status"
-	"net"
-	"strings"
+	"sync/atomic"
 	"time"
 )
 
-var healthCheckMethodName = "/grpc.health.v1.Health/Check"
-
-// SetHealthCheckMethodName changes the default health check method name
+// SetHealthCheckMethodName adds the health check method (a glob) to DefaultAuditExcludedMethods.
+// It only applies to the interceptors created afterwards.
+//
+// Deprecated: use WithExcludedMethods on each audit interceptor instead
 func SetHealthCheckMethodName(methodName string) {
-	healthCheckMethodName = methodName
+	DefaultAuditExcludedMethods = append(DefaultAuditExcludedMethods, methodName)
+}
+
+// isHealthCheckRequest checks whether the method is excluded by default, the health check among others
+func isHealthCheckRequest(requestMethod string) bool {
+	return glob.MatchAny(DefaultAuditExcludedMethods, requestMethod)
 }
 
 // Logging request information for Unary requests
-func UnaryAuditServiceRequest() grpc.UnaryServerInterceptor {
+func UnaryAuditServiceRequest(opts ...AuditOption) grpc.UnaryServerInterceptor {
+	cfg := newAuditConfig(opts)
 	return func(
 		ctx context.Context,
 		req interface{},
@@ -38,23 +45,31 @@ func UnaryAuditServiceRequest() grpc.UnaryServerInterceptor {
 			return nil, status.Errorf(codes.InvalidArgument, "missing metadata")
 		}
 
-		start := time.Now()
+		rate := cfg.sampleRate(ctx, info.FullMethod)
+		if !sampled(rate) {
+			return handler(ctx, req)
+		}
+		event := newAuditEvent(ctx, info.FullMethod, md, peer, rate)
+		event.MessagesReceived = 1
+		event.RequestBytes = messageSize(req)
+		payloads := cfg.newPayloadCapture(info.FullMethod, false)
+		payloads.captureRequest(req)
+		ctx, record := newContextWithCallRecord(ctx)
 		resp, err := handler(ctx, req)
-		logRequest(
-			start,
-			info.FullMethod,
-			md["user-agent"],
-			peer.Addr,
-			info.FullMethod,
-			err,
-		)
+		if err == nil {
+			event.MessagesSent = 1
+			event.ResponseBytes = messageSize(resp)
+			payloads.captureResponse(resp)
+		}
+		cfg.logRequest(event, record, err, payloads)
 
 		return resp, err // passing up the chain the response and the err
 	}
 }
 
 // Logging request information for Stream requests
-func StreamAuditServiceRequest() grpc.StreamServerInterceptor {
+func StreamAuditServiceRequest(opts ...AuditOption) grpc.StreamServerInterceptor {
+	cfg := newAuditConfig(opts)
 	return func(
 		srv interface{},
 		stream grpc.ServerStream,
@@ -68,65 +83,131 @@ func StreamAuditServiceRequest() grpc.StreamServerInterceptor {
 		if !ok {
 			return status.Errorf(codes.InvalidArgument, "missing metadata")
 		}
-		start := time.Now()
-		err = handler(srv, stream)
-		logRequest(
-			start,
-			info.FullMethod,
-			md["user-agent"],
-			peer.Addr,
-			info.FullMethod,
-			err,
-		)
+		rate := cfg.sampleRate(stream.Context(), info.FullMethod)
+		if !sampled(rate) {
+			return handler(srv, stream)
+		}
+		event := newAuditEvent(stream.Context(), info.FullMethod, md, peer, rate)
+		event.Stream = true
+		ctx, record := newContextWithCallRecord(stream.Context())
+		wrapped := &auditServerStream{
+			ServerStream: stream,
+			ctx:          ctx,
+			payloads:     cfg.newPayloadCapture(info.FullMethod, true),
+		}
+		err = handler(srv, wrapped)
+		event.MessagesReceived = atomic.LoadInt64(&wrapped.received)
+		event.MessagesSent = atomic.LoadInt64(&wrapped.sent)
+		event.RequestBytes = atomic.LoadInt64(&wrapped.bytesReceived)
+		event.ResponseBytes = atomic.LoadInt64(&wrapped.bytesSent)
+		cfg.logRequest(event, record, err, wrapped.payloads)
 		return err
 	}
 }
 
-func logRequest(start time.Time, requestMethod string, userAgents []string, ip net.Addr, fullMethod string, err error) {
-	if isHealthCheckRequest(requestMethod) {
-		return
+// auditServerStream counts the messages and bytes going through the stream
+type auditServerStream struct {
+	sent          int64
+	received      int64
+	bytesSent     int64
+	bytesReceived int64
+	grpc.ServerStream
+	ctx      context.Context
+	payloads *payloadCapture
+}
+
+// Context returns the context carrying the call record
+func (s *auditServerStream) Context() context.Context {
+	return s.ctx
+}
+
+// SendMsg counts the messages sent to the client
+func (s *auditServerStream) SendMsg(m interface{}) error {
+	err := s.ServerStream.SendMsg(m)
+	if err == nil {
+		atomic.AddInt64(&s.sent, 1)
+		atomic.AddInt64(&s.bytesSent, messageSize(m))
+		s.payloads.captureResponse(m)
+	}
+	return err
+}
+
+// RecvMsg counts the messages received from the client
+func (s *auditServerStream) RecvMsg(m interface{}) error {
+	err := s.ServerStream.RecvMsg(m)
+	if err == nil {
+		atomic.AddInt64(&s.received, 1)
+		atomic.AddInt64(&s.bytesReceived, messageSize(m))
+		s.payloads.captureRequest(m)
+	}
+	return err
+}
+
+func newAuditEvent(ctx context.Context, fullMethod string, md metadata.MD, p *peer.Peer, rate float64) AuditEvent {
+	service, method := splitMethodName(fullMethod)
+	event := AuditEvent{
+		Kind:       AuditKindCall,
+		Time:       time.Now(),
+		FullMethod: fullMethod,
+		Service:    service,
+		Method:     method,
+		UserAgent:  md["user-agent"],
+		RequestID:  requestIDFromContext(ctx),
+	}
+	if rate < 1 {
+		event.SampleRate = rate
+	}
+	if p.Addr != nil {
+		event.Peer = p.Addr.String()
+	}
+	if principal, ok := PrincipalFromContext(ctx); ok {
+		event.Principal = principal
+	}
+	if tenant, ok := TenantFromContext(ctx); ok {
+		event.Tenant = tenant
+	}
+	event.TraceID, event.SpanID = TraceIDsFromContext(ctx)
+	if deadline, ok := ctx.Deadline(); ok {
+		event.Deadline = &deadline
+	}
+	return event
+}
+
+// logRequest completes and writes the event of the call. The payloads are only rendered when the sampling keeps the event
+func (c *auditConfig) logRequest(event AuditEvent, record *callRecord, err error, payloads *payloadCapture) {
+	if principal := record.getPrincipal(); principal != "" {
+		event.Principal = principal
+	}
+	if requestID := record.getRequestID(); requestID != "" {
+		event.RequestID = requestID
+	}
+	if tenant := record.getTenant(); tenant != "" {
+		event.Tenant = tenant
 	}
 	sts := status.Convert(err)
-	auditEntry := logrus.Fields{
-		"user-agent":  userAgents,
-		"peer":        ip,
-		"took_ns":     time.Since(start),
-		"status":      sts.Code().String(),
-		"err":         sts.Message(),
-		"err-details": sts.Details(),
-	}
-	log := logrus.WithFields(auditEntry)
-
-	switch sts.Code() {
-
-	case codes.OK:
-		log.Info("gRPC call succeeded")
-
-	// Caused by invalid client requests (http 4xx equiv.)
-	case codes.Canceled,
-		codes.InvalidArgument,
-		codes.NotFound,
-		codes.AlreadyExists,
-		codes.PermissionDenied,
-		codes.FailedPrecondition,
-		codes.Aborted,
-		codes.OutOfRange,
-		codes.Unimplemented, // usually caused by client requesting invalid operation (even though it matches 501)
-		codes.Unauthenticated:
-
-		log.Warn("gRPC call failed")
-
-	// Server errors (http 5xx equiv.):
-	// Unknown, DeadlineExceeded, ResourceExhausted, Internal, Unavailable, DataLoss
-	// (ResourceExhausted is somewhere in between, from user quota exhausted to OOM, rather have it on error for now)
-	default:
-		log.Error("gRPC call errored")
+	event.Duration = time.Since(event.Time)
+	event.Level = auditLevel(sts.Code())
+	event.Code = sts.Code()
+	event.Status = sts.Code().String()
+	event.Error = sts.Message()
+	event.Details = sts.Details()
+	if c.sampler != nil && !c.sampler.keep(&event) {
+		return
 	}
+	payloads.fill(&event)
+	c.write(event)
 }
 
-func isHealthCheckRequest(requestMethod string) bool {
-	if strings.Contains(requestMethod, "Health/Check") {
-		return true
+func (c *auditConfig) write(event AuditEvent) {
+	if err := c.sink.Write(event); err != nil {
+		c.logger.Error("failed to write audit event", "err", err)
+	}
+}
+
+// messageSize returns the encoded size of protobuf messages, zero for anything else
+func messageSize(m interface{}) int64 {
+	if msg, ok := m.(proto.Message); ok {
+		return int64(proto.Size(msg))
 	}
-	return false
+	return 0
 }
@@ -2,12 +2,17 @@ package interceptors
 
 import (
 	"context"
+	"github.com/golang/protobuf/proto"
 	"github.com/stretchr/testify/assert"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/examples/helloworld/helloworld"
 	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
 	"net"
 	"testing"
+	"time"
 )
 
 func TestStreamAuditServiceRequest(t *testing.T) {
@@ -44,19 +49,123 @@ func TestUnaryAuditServiceRequest(t *testing.T) {
 	assert.NoError(t, e)
 }
 
+func TestUnaryAuditServiceRequestWithSink(t *testing.T) {
+	sink := NewMemorySink()
+	interceptor := UnaryAuditServiceRequest(WithAuditSink(sink))
+	ctx := context.Background()
+	addr := net.IPNet{}
+	ctx = peer.NewContext(ctx, &peer.Peer{Addr: &addr})
+	md := metadata.Pairs("user-agent", "test-agent")
+	ctx = metadata.NewIncomingContext(ctx, md)
+	handler := func(ctx context.Context, req interface{}) (i interface{}, e error) {
+		return nil, status.Error(codes.NotFound, "not found")
+	}
+	info := &grpc.UnaryServerInfo{FullMethod: "/test.Service/Method"}
+	_, e := interceptor(ctx, "test", info, handler)
+	assert.Error(t, e)
+
+	events := sink.Events()
+	assert.Len(t, events, 1)
+	assert.Equal(t, "/test.Service/Method", events[0].FullMethod)
+	assert.Equal(t, codes.NotFound, events[0].Code)
+	assert.Equal(t, AuditLevelWarn, events[0].Level)
+	assert.Equal(t, []string{"test-agent"}, events[0].UserAgent)
+}
+
+func TestStreamAuditServiceRequestCountsMessages(t *testing.T) {
+	sink := NewMemorySink()
+	interceptor := StreamAuditServiceRequest(WithAuditSink(sink))
+	handler := func(srv interface{}, stream grpc.ServerStream) error {
+		req := &helloworld.HelloRequest{}
+		if err := stream.RecvMsg(req); err != nil {
+			return err
+		}
+		ContextWithPrincipal(stream.Context(), "alice")
+		stream.SendMsg(&helloworld.HelloReply{Message: "hello"})
+		return stream.SendMsg(&helloworld.HelloReply{Message: "hello again"})
+	}
+	err := interceptor(nil, ServerStreamMock{}, &grpc.StreamServerInfo{
+		FullMethod: "/helloworld.Greeter/SayHello",
+	}, handler)
+	assert.NoError(t, err)
+
+	events := sink.Events()
+	assert.Len(t, events, 1)
+	event := events[0]
+	assert.True(t, event.Stream)
+	assert.Equal(t, "helloworld.Greeter", event.Service)
+	assert.Equal(t, "SayHello", event.Method)
+	assert.Equal(t, "alice", event.Principal)
+	assert.Equal(t, int64(1), event.MessagesReceived)
+	assert.Equal(t, int64(2), event.MessagesSent)
+	assert.Equal(t, int64(proto.Size(&helloworld.HelloRequest{Name: "test"})), event.RequestBytes)
+	assert.True(t, event.ResponseBytes > 0)
+}
+
+func TestUnaryAuditServiceRequestEnrichment(t *testing.T) {
+	sink := NewMemorySink()
+	interceptor := UnaryAuditServiceRequest(WithAuditSink(sink))
+	ctx := peer.NewContext(context.Background(), &peer.Peer{Addr: &net.IPNet{}})
+	md := metadata.Pairs("x-request-id", "req-1", "x-b3-traceid", "trace-1", "x-b3-spanid", "span-1")
+	ctx = metadata.NewIncomingContext(ctx, md)
+	ctx, cancel := context.WithTimeout(ctx, time.Minute)
+	defer cancel()
+	handler := func(ctx context.Context, req interface{}) (i interface{}, e error) {
+		return &helloworld.HelloReply{Message: "hello"}, nil
+	}
+	req := &helloworld.HelloRequest{Name: "test"}
+	_, err := interceptor(ctx, req, &grpc.UnaryServerInfo{FullMethod: "/helloworld.Greeter/SayHello"}, handler)
+	assert.NoError(t, err)
+
+	event := sink.Events()[0]
+	assert.Equal(t, "req-1", event.RequestID)
+	assert.Equal(t, "trace-1", event.TraceID)
+	assert.Equal(t, "span-1", event.SpanID)
+	assert.NotNil(t, event.Deadline)
+	assert.Equal(t, int64(proto.Size(req)), event.RequestBytes)
+	assert.Equal(t, int64(1), event.MessagesSent)
+}
+
+func TestUnaryAuditServiceRequestExcludesHealthCheck(t *testing.T) {
+	sink := NewMemorySink()
+	interceptor := UnaryAuditServiceRequest(WithAuditSink(sink), WithExcludedSampleRate(0))
+	ctx := peer.NewContext(context.Background(), &peer.Peer{Addr: &net.IPNet{}})
+	ctx = metadata.NewIncomingContext(ctx, metadata.MD{})
+	handler := func(ctx context.Context, req interface{}) (i interface{}, e error) {
+		return nil, nil
+	}
+	_, err := interceptor(ctx, "test", &grpc.UnaryServerInfo{FullMethod: "/grpc.health.v1.Health/Check"}, handler)
+	assert.NoError(t, err)
+	assert.Empty(t, sink.Events())
+}
+
 func Test_isHealthCheckRequest(t *testing.T) {
+	defaults := DefaultAuditExcludedMethods
+	defer func() { DefaultAuditExcludedMethods = defaults }()
 	SetHealthCheckMethodName("Health/Check")
 	a := isHealthCheckRequest("Health/Check")
 	assert.True(t, a)
 
 	b := isHealthCheckRequest("Other/Method")
 	assert.False(t, b)
+	assert.True(t, newAuditConfig(nil).isExcluded(context.Background(), "Health/Check"))
 }
 
 type ServerStreamMock struct {
 	grpc.ServerStream
 }
 
+func (s ServerStreamMock) SendMsg(m interface{}) error {
+	return nil
+}
+
+func (s ServerStreamMock) RecvMsg(m interface{}) error {
+	if req, ok := m.(*helloworld.HelloRequest); ok {
+		req.Name = "test"
+	}
+	return nil
+}
+
 func (s ServerStreamMock) Context() context.Context {
 	ctx := context.Background()
 	addr := net.IPNet{}
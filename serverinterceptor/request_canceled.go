@@ -2,14 +2,38 @@ package interceptors
 
 import (
 	"context"
-	log "github.com/sirupsen/logrus"
+	"github.com/apssouza22/grpc-production-go/logging"
 	"google.golang.org/grpc"
 	"time"
 )
 
+// CanceledOption configures the request canceled interceptors
+type CanceledOption func(*canceledConfig)
+
+type canceledConfig struct {
+	logger logging.Logger
+}
+
+// WithCanceledLogger sets the logger receiving the canceled requests. The default logger is used otherwise
+func WithCanceledLogger(logger logging.Logger) CanceledOption {
+	return func(c *canceledConfig) {
+		c.logger = logger
+	}
+}
+
+func newCanceledConfig(opts []CanceledOption) *canceledConfig {
+	cfg := &canceledConfig{}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	cfg.logger = logging.OrDefault(cfg.logger)
+	return cfg
+}
+
 // Log the request that has been cancelled by the client during the Unary request
 // The request can be cancelled for many reasons, including timeout exceeded
-func UnaryLogRequestCanceled() grpc.UnaryServerInterceptor {
+func UnaryLogRequestCanceled(opts ...CanceledOption) grpc.UnaryServerInterceptor {
+	cfg := newCanceledConfig(opts)
 	return func(
 		ctx context.Context,
 		req interface{},
@@ -18,7 +42,7 @@ func UnaryLogRequestCanceled() grpc.UnaryServerInterceptor {
 		start := time.Now()
 		resp, err := handler(ctx, req)
 		if ctx.Err() == context.Canceled {
-			logCanceledRequest(start, err, info.FullMethod)
+			cfg.logCanceledRequest(start, err, info.FullMethod)
 		}
 		return resp, err
 	}
@@ -26,23 +50,23 @@ func UnaryLogRequestCanceled() grpc.UnaryServerInterceptor {
 
 // Log the request that has been cancelled by the client during the Stream request
 // The request can be cancelled for many reasons, including timeout exceeded
-func StreamLogRequestCanceled() grpc.StreamServerInterceptor {
+func StreamLogRequestCanceled(opts ...CanceledOption) grpc.StreamServerInterceptor {
+	cfg := newCanceledConfig(opts)
 	return func(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) (err error) {
 		start := time.Now()
 		err = handler(srv, stream)
 
 		if stream.Context().Err() == context.Canceled {
-			logCanceledRequest(start, err, info.FullMethod)
+			cfg.logCanceledRequest(start, err, info.FullMethod)
 		}
 		return err
 	}
 }
 
-func logCanceledRequest(start time.Time, err error, method string) {
-	auditEntry := log.Fields{
-		"took_ns": time.Since(start),
-		"status":  "Request Canceled",
-		"err":     err,
-	}
-	log.WithFields(auditEntry).Warn(method)
+func (c *canceledConfig) logCanceledRequest(start time.Time, err error, method string) {
+	c.logger.Warn(method,
+		"took_ns", time.Since(start),
+		"status", "Request Canceled",
+		"err", err,
+	)
 }
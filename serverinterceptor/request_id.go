@@ -0,0 +1,78 @@
+package interceptors
+
+import (
+	"context"
+	"github.com/apssouza22/grpc-production-go/requestid"
+	grpc_middleware "github.com/grpc-ecosystem/go-grpc-middleware"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// maxRequestIDLength bounds the size of the request ids accepted from the clients
+const maxRequestIDLength = 128
+
+// RequestIDOption configures the request id interceptors
+type RequestIDOption func(*requestIDConfig)
+
+type requestIDConfig struct {
+	generator func() string
+}
+
+// WithRequestIDGenerator sets the function generating the missing request ids. UUIDv7 ids are generated otherwise
+func WithRequestIDGenerator(generator func() string) RequestIDOption {
+	return func(c *requestIDConfig) {
+		c.generator = generator
+	}
+}
+
+func newRequestIDConfig(opts []RequestIDOption) *requestIDConfig {
+	cfg := &requestIDConfig{generator: requestid.New}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	return cfg
+}
+
+// UnaryRequestID reads the x-request-id header, generating one when it is missing, stores it in the context
+// and echoes it back in the response headers
+func UnaryRequestID(opts ...RequestIDOption) grpc.UnaryServerInterceptor {
+	cfg := newRequestIDConfig(opts)
+	return func(
+		ctx context.Context,
+		req interface{},
+		info *grpc.UnaryServerInfo,
+		handler grpc.UnaryHandler) (_ interface{}, err error) {
+		ctx, id := cfg.newContext(ctx)
+		// It fails only when there is no transport stream (e.g. unit tests), nothing to echo then
+		_ = grpc.SetHeader(ctx, metadata.Pairs(requestid.Header, id))
+		return handler(ctx, req)
+	}
+}
+
+// StreamRequestID reads the x-request-id header, generating one when it is missing, stores it in the stream
+// context and echoes it back in the response headers
+func StreamRequestID(opts ...RequestIDOption) grpc.StreamServerInterceptor {
+	cfg := newRequestIDConfig(opts)
+	return func(
+		srv interface{},
+		stream grpc.ServerStream,
+		info *grpc.StreamServerInfo,
+		handler grpc.StreamHandler) (err error) {
+		ctx, id := cfg.newContext(stream.Context())
+		_ = stream.SetHeader(metadata.Pairs(requestid.Header, id))
+		wrapped := grpc_middleware.WrapServerStream(stream)
+		wrapped.WrappedContext = ctx
+		return handler(srv, wrapped)
+	}
+}
+
+func (c *requestIDConfig) newContext(ctx context.Context) (context.Context, string) {
+	id, ok := requestid.FromContext(ctx)
+	if !ok || len(id) > maxRequestIDLength {
+		id = c.generator()
+	}
+	if record := callRecordFromContext(ctx); record != nil {
+		record.setRequestID(id)
+	}
+	return requestid.NewContext(ctx, id), id
+}
@@ -0,0 +1,80 @@
+package interceptors
+
+import (
+	"context"
+	"github.com/apssouza22/grpc-production-go/requestid"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"net"
+	"strings"
+	"testing"
+)
+
+func TestUnaryRequestIDKeepsIncomingID(t *testing.T) {
+	interceptor := UnaryRequestID()
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(requestid.Header, "req-1"))
+	var id string
+	handler := func(ctx context.Context, req interface{}) (i interface{}, e error) {
+		id, _ = requestid.FromContext(ctx)
+		return nil, nil
+	}
+	interceptor(ctx, "req", &grpc.UnaryServerInfo{FullMethod: "test"}, handler)
+	assert.Equal(t, "req-1", id)
+}
+
+func TestUnaryRequestIDGeneratesMissingID(t *testing.T) {
+	interceptor := UnaryRequestID(WithRequestIDGenerator(func() string { return "generated" }))
+	var id string
+	handler := func(ctx context.Context, req interface{}) (i interface{}, e error) {
+		id, _ = requestid.FromContext(ctx)
+		return nil, nil
+	}
+	interceptor(context.Background(), "req", &grpc.UnaryServerInfo{FullMethod: "test"}, handler)
+	assert.Equal(t, "generated", id)
+
+	tooLong := strings.Repeat("a", maxRequestIDLength+1)
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(requestid.Header, tooLong))
+	interceptor(ctx, "req", &grpc.UnaryServerInfo{FullMethod: "test"}, handler)
+	assert.Equal(t, "generated", id)
+}
+
+func TestStreamRequestIDEchoesHeader(t *testing.T) {
+	interceptor := StreamRequestID(WithRequestIDGenerator(func() string { return "generated" }))
+	stream := &headerRecorderStream{}
+	var id string
+	handler := func(srv interface{}, stream grpc.ServerStream) error {
+		id, _ = requestid.FromContext(stream.Context())
+		return nil
+	}
+	assert.NoError(t, interceptor(nil, stream, &grpc.StreamServerInfo{FullMethod: "test"}, handler))
+	assert.Equal(t, "generated", id)
+	assert.Equal(t, []string{"generated"}, stream.header.Get(requestid.Header))
+}
+
+func TestRequestIDReportedToAudit(t *testing.T) {
+	sink := NewMemorySink()
+	audit := UnaryAuditServiceRequest(WithAuditSink(sink))
+	requestID := UnaryRequestID(WithRequestIDGenerator(func() string { return "generated" }))
+	ctx := peer.NewContext(context.Background(), &peer.Peer{Addr: &net.IPNet{}})
+	ctx = metadata.NewIncomingContext(ctx, metadata.MD{})
+	handler := func(ctx context.Context, req interface{}) (i interface{}, e error) {
+		return nil, nil
+	}
+	info := &grpc.UnaryServerInfo{FullMethod: "test"}
+	audit(ctx, "req", info, func(ctx context.Context, req interface{}) (interface{}, error) {
+		return requestID(ctx, req, info, handler)
+	})
+	assert.Equal(t, "generated", sink.Events()[0].RequestID)
+}
+
+type headerRecorderStream struct {
+	ServerStreamMock
+	header metadata.MD
+}
+
+func (s *headerRecorderStream) SetHeader(md metadata.MD) error {
+	s.header = metadata.Join(s.header, md)
+	return nil
+}
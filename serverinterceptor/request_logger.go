@@ -0,0 +1,85 @@
+package interceptors
+
+import (
+	"context"
+	"github.com/apssouza22/grpc-production-go/logging"
+	grpc_middleware "github.com/grpc-ecosystem/go-grpc-middleware"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/peer"
+)
+
+// RequestLoggerOption configures the request logger interceptors
+type RequestLoggerOption func(*requestLoggerConfig)
+
+type requestLoggerConfig struct {
+	logger logging.Logger
+}
+
+// WithBaseLogger sets the logger the request loggers are derived from. The default logger is used otherwise
+func WithBaseLogger(logger logging.Logger) RequestLoggerOption {
+	return func(c *requestLoggerConfig) {
+		c.logger = logger
+	}
+}
+
+func newRequestLoggerConfig(opts []RequestLoggerOption) *requestLoggerConfig {
+	cfg := &requestLoggerConfig{}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	return cfg
+}
+
+// UnaryRequestLogger injects into the handler context a logger tagged with the method, request id, peer,
+// principal, tenant and trace id of the call. Handlers retrieve it with logging.FromContext(ctx).
+// Place it after the authentication interceptor to have the principal available
+func UnaryRequestLogger(opts ...RequestLoggerOption) grpc.UnaryServerInterceptor {
+	cfg := newRequestLoggerConfig(opts)
+	return func(
+		ctx context.Context,
+		req interface{},
+		info *grpc.UnaryServerInfo,
+		handler grpc.UnaryHandler) (_ interface{}, err error) {
+		return handler(cfg.newContext(ctx, info.FullMethod), req)
+	}
+}
+
+// StreamRequestLogger injects into the stream context a logger tagged with the method, request id, peer,
+// principal and trace id of the call. Handlers retrieve it with logging.FromContext(stream.Context())
+func StreamRequestLogger(opts ...RequestLoggerOption) grpc.StreamServerInterceptor {
+	cfg := newRequestLoggerConfig(opts)
+	return func(
+		srv interface{},
+		stream grpc.ServerStream,
+		info *grpc.StreamServerInfo,
+		handler grpc.StreamHandler) (err error) {
+		wrapped := grpc_middleware.WrapServerStream(stream)
+		wrapped.WrappedContext = cfg.newContext(stream.Context(), info.FullMethod)
+		return handler(srv, wrapped)
+	}
+}
+
+func (c *requestLoggerConfig) newContext(ctx context.Context, fullMethod string) context.Context {
+	service, method := splitMethodName(fullMethod)
+	keyvals := []interface{}{"service", service, "method", method}
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		keyvals = append(keyvals, "peer", p.Addr.String())
+	}
+	if requestID := requestIDFromContext(ctx); requestID != "" {
+		keyvals = append(keyvals, "request-id", requestID)
+	}
+	if principal, ok := PrincipalFromContext(ctx); ok {
+		keyvals = append(keyvals, "principal", principal)
+	}
+	if tenant, ok := TenantFromContext(ctx); ok {
+		keyvals = append(keyvals, "tenant", tenant)
+	}
+	if traceID, spanID := TraceIDsFromContext(ctx); traceID != "" {
+		keyvals = append(keyvals, "trace-id", traceID, "span-id", spanID)
+	}
+	base := c.logger
+	if base == nil {
+		base = logging.FromContext(ctx)
+	}
+	return logging.NewContext(ctx, base.With(keyvals...))
+}
@@ -0,0 +1,62 @@
+package interceptors
+
+import (
+	"context"
+	"github.com/apssouza22/grpc-production-go/logging"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"net"
+	"testing"
+)
+
+func TestUnaryRequestLogger(t *testing.T) {
+	base := &taggedLogger{}
+	interceptor := UnaryRequestLogger(WithBaseLogger(base))
+	ctx := peer.NewContext(context.Background(), &peer.Peer{Addr: &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 5000}})
+	ctx = metadata.NewIncomingContext(ctx, metadata.Pairs("x-request-id", "req-1", "x-b3-traceid", "trace-1"))
+	ctx = ContextWithPrincipal(ctx, "alice")
+	var tags map[string]interface{}
+	handler := func(ctx context.Context, req interface{}) (i interface{}, e error) {
+		tags = logging.FromContext(ctx).(*taggedLogger).tags
+		return nil, nil
+	}
+	_, err := interceptor(ctx, "req", &grpc.UnaryServerInfo{FullMethod: "/helloworld.Greeter/SayHello"}, handler)
+	assert.NoError(t, err)
+	assert.Equal(t, "helloworld.Greeter", tags["service"])
+	assert.Equal(t, "SayHello", tags["method"])
+	assert.Equal(t, "127.0.0.1:5000", tags["peer"])
+	assert.Equal(t, "req-1", tags["request-id"])
+	assert.Equal(t, "alice", tags["principal"])
+	assert.Equal(t, "trace-1", tags["trace-id"])
+}
+
+func TestStreamRequestLogger(t *testing.T) {
+	base := &taggedLogger{}
+	interceptor := StreamRequestLogger(WithBaseLogger(base))
+	var tags map[string]interface{}
+	handler := func(srv interface{}, stream grpc.ServerStream) error {
+		tags = logging.FromContext(stream.Context()).(*taggedLogger).tags
+		return nil
+	}
+	err := interceptor(nil, ServerStreamMock{}, &grpc.StreamServerInfo{FullMethod: "/helloworld.Greeter/SayHello"}, handler)
+	assert.NoError(t, err)
+	assert.Equal(t, "SayHello", tags["method"])
+}
+
+type taggedLogger struct {
+	logging.Logger
+	tags map[string]interface{}
+}
+
+func (l *taggedLogger) With(keyvals ...interface{}) logging.Logger {
+	tags := make(map[string]interface{})
+	for k, v := range l.tags {
+		tags[k] = v
+	}
+	for i := 0; i+1 < len(keyvals); i += 2 {
+		tags[keyvals[i].(string)] = keyvals[i+1]
+	}
+	return &taggedLogger{tags: tags}
+}
@@ -0,0 +1,206 @@
+package interceptors
+
+import (
+	"context"
+	"github.com/apssouza22/grpc-production-go/internal/glob"
+	"github.com/apssouza22/grpc-production-go/internal/lru"
+	"github.com/apssouza22/grpc-production-go/metrics"
+	"github.com/golang/protobuf/proto"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CacheControlHeader is the request header allowing the clients to bypass the caches. The cached methods also send it
+// in the response header with the max-age of the response, so the client caches (see clientinterceptor.ResponseCache) keep it as long
+const CacheControlHeader = "cache-control"
+
+// Metrics of the response cache, labeled by method and tenant (see UnknownTenantLabel)
+const (
+	ResponseCacheHitsMetric   = "grpc_server_response_cache_hits_total"
+	ResponseCacheMissesMetric = "grpc_server_response_cache_misses_total"
+)
+
+// CachedMethod configures the caching of the responses of a method
+type CachedMethod struct {
+	// TTL is how long the responses are cached
+	TTL time.Duration
+	// SharedAcrossPrincipals shares the responses between the authenticated principals.
+	// The responses are cached per principal otherwise
+	SharedAcrossPrincipals bool
+	// VaryByTenant caches the responses per tenant
+	VaryByTenant bool
+}
+
+// ResponseCacheOption configures the response cache
+type ResponseCacheOption func(*ResponseCache)
+
+// WithCachedMethod caches the responses of the methods matching the glob, e.g. "/catalog.Products/Get*".
+// Methods not configured are never cached
+func WithCachedMethod(glob string, method CachedMethod) ResponseCacheOption {
+	return func(c *ResponseCache) {
+		c.methods = append(c.methods, cachedMethodRule{glob: glob, method: method})
+	}
+}
+
+// WithResponseCacheSize bounds the cache by number of responses and total encoded size. Zero means no limit.
+// The default is 10000 responses and 64MB
+func WithResponseCacheSize(maxEntries int, maxBytes int64) ResponseCacheOption {
+	return func(c *ResponseCache) {
+		c.cache = lru.New(maxEntries, maxBytes)
+	}
+}
+
+// WithResponseCacheMetrics sets the provider of the hit and miss counters. The default provider is used otherwise
+func WithResponseCacheMetrics(provider metrics.Provider) ResponseCacheOption {
+	return func(c *ResponseCache) {
+		c.metrics = provider
+	}
+}
+
+type cachedMethodRule struct {
+	glob   string
+	method CachedMethod
+}
+
+// ResponseCache caches the successful responses of the unary read methods,
+// keyed by method and hash of the deterministically encoded request
+type ResponseCache struct {
+	methods []cachedMethodRule
+	cache   *lru.Cache
+	metrics metrics.Provider
+	hits    metrics.Counter
+	misses  metrics.Counter
+}
+
+// NewResponseCache creates a response cache. Register its interceptor with UnaryServerInterceptor
+func NewResponseCache(opts ...ResponseCacheOption) *ResponseCache {
+	c := &ResponseCache{cache: lru.New(10000, 64<<20)}
+	for _, opt := range opts {
+		opt(c)
+	}
+	c.metrics = metrics.OrDefault(c.metrics)
+	c.hits = c.metrics.Counter(ResponseCacheHitsMetric)
+	c.misses = c.metrics.Counter(ResponseCacheMissesMetric)
+	return c
+}
+
+// UnaryServerInterceptor returns the interceptor serving the cached responses.
+// A `cache-control: no-cache` request header skips the lookup, `no-store` also skips storing the response.
+// The cached and stored responses are sent with a `cache-control: max-age=<seconds left>` header
+func (c *ResponseCache) UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(
+		ctx context.Context,
+		req interface{},
+		info *grpc.UnaryServerInfo,
+		handler grpc.UnaryHandler) (_ interface{}, err error) {
+		method, ok := c.method(info.FullMethod)
+		if !ok || method.TTL <= 0 {
+			return handler(ctx, req)
+		}
+		reqMsg, ok := req.(proto.Message)
+		if !ok {
+			return handler(ctx, req)
+		}
+		hash, err := requestHash(reqMsg)
+		if err != nil {
+			return handler(ctx, req)
+		}
+		key := responseCacheKey(ctx, info.FullMethod, hash, method)
+		noCache, noStore := cacheControl(ctx)
+		if !noCache {
+			if cached, expiresAt, ok := c.cache.GetWithExpiry(key); ok {
+				c.hits.Add(1, "method", info.FullMethod, "tenant", tenantLabel(ctx))
+				setMaxAge(ctx, expiresAt.Sub(c.cache.Now()))
+				return proto.Clone(cached.(proto.Message)), nil
+			}
+		}
+		c.misses.Add(1, "method", info.FullMethod, "tenant", tenantLabel(ctx))
+
+		resp, err := handler(ctx, req)
+		if err != nil || noStore {
+			return resp, err
+		}
+		if respMsg, ok := resp.(proto.Message); ok && respMsg != nil && !reflect.ValueOf(respMsg).IsNil() {
+			if c.cache.Add(key, proto.Clone(respMsg), int64(len(key)+proto.Size(respMsg)), c.cache.Now().Add(method.TTL)) {
+				setMaxAge(ctx, method.TTL)
+			}
+		}
+		return resp, nil
+	}
+}
+
+// Invalidate removes the cached responses of the request, for every principal and tenant
+func (c *ResponseCache) Invalidate(fullMethod string, req proto.Message) error {
+	hash, err := requestHash(req)
+	if err != nil {
+		return err
+	}
+	prefix := fullMethod + "\x00" + hash + "\x00"
+	c.cache.RemoveFunc(func(key string) bool {
+		return strings.HasPrefix(key, prefix)
+	})
+	return nil
+}
+
+// InvalidateMethod removes the cached responses of the methods matching the glob and returns how many were removed
+func (c *ResponseCache) InvalidateMethod(methodGlob string) int {
+	return c.cache.RemoveFunc(func(key string) bool {
+		return glob.Match(methodGlob, key[:strings.IndexByte(key, 0)])
+	})
+}
+
+// Purge removes every cached response
+func (c *ResponseCache) Purge() {
+	c.cache.RemoveFunc(func(key string) bool {
+		return true
+	})
+}
+
+func (c *ResponseCache) method(fullMethod string) (CachedMethod, bool) {
+	for _, rule := range c.methods {
+		if glob.Match(rule.glob, fullMethod) {
+			return rule.method, true
+		}
+	}
+	return CachedMethod{}, false
+}
+
+func responseCacheKey(ctx context.Context, fullMethod string, hash string, method CachedMethod) string {
+	var tenant, principal string
+	if method.VaryByTenant {
+		tenant, _ = TenantFromContext(ctx)
+	}
+	if !method.SharedAcrossPrincipals {
+		principal, _ = PrincipalFromContext(ctx)
+	}
+	return strings.Join([]string{fullMethod, hash, tenant, principal}, "\x00")
+}
+
+// setMaxAge sets the cache-control response header. It is not sent when the handler already sent the headers
+func setMaxAge(ctx context.Context, maxAge time.Duration) {
+	grpc.SetHeader(ctx, metadata.Pairs(CacheControlHeader, "max-age="+strconv.Itoa(int(maxAge/time.Second))))
+}
+
+// cacheControl parses the no-cache and no-store directives of the cache-control request header
+func cacheControl(ctx context.Context) (noCache bool, noStore bool) {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return false, false
+	}
+	for _, value := range md.Get(CacheControlHeader) {
+		for _, directive := range strings.Split(value, ",") {
+			switch strings.ToLower(strings.TrimSpace(directive)) {
+			case "no-cache":
+				noCache = true
+			case "no-store":
+				noCache = true
+				noStore = true
+			}
+		}
+	}
+	return noCache, noStore
+}
@@ -0,0 +1,194 @@
+package interceptors
+
+import (
+	"context"
+	"github.com/apssouza22/grpc-production-go/metrics"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/examples/helloworld/helloworld"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"testing"
+	"time"
+)
+
+type countingHandler struct {
+	calls int
+	err   error
+}
+
+func (h *countingHandler) handle(ctx context.Context, req interface{}) (interface{}, error) {
+	h.calls++
+	if h.err != nil {
+		return nil, h.err
+	}
+	return &helloworld.HelloReply{Message: "hello " + req.(*helloworld.HelloRequest).Name}, nil
+}
+
+func TestResponseCache(t *testing.T) {
+	provider := metrics.NewMemory()
+	cache := NewResponseCache(WithCachedMethod("/greeter/*", CachedMethod{TTL: time.Minute}), WithResponseCacheMetrics(provider))
+	interceptor := cache.UnaryServerInterceptor()
+	h := &countingHandler{}
+	info := &grpc.UnaryServerInfo{FullMethod: "/greeter/SayHello"}
+
+	first, err := interceptor(context.Background(), &helloworld.HelloRequest{Name: "alice"}, info, h.handle)
+	assert.NoError(t, err)
+	second, err := interceptor(context.Background(), &helloworld.HelloRequest{Name: "alice"}, info, h.handle)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, h.calls)
+	assert.Equal(t, "hello alice", second.(*helloworld.HelloReply).Message)
+	assert.False(t, first == second)
+
+	interceptor(context.Background(), &helloworld.HelloRequest{Name: "bob"}, info, h.handle)
+	assert.Equal(t, 2, h.calls)
+	assert.Equal(t, float64(1), provider.Value(ResponseCacheHitsMetric, "method", "/greeter/SayHello", "tenant", UnknownTenantLabel))
+	assert.Equal(t, float64(2), provider.Value(ResponseCacheMissesMetric, "method", "/greeter/SayHello", "tenant", UnknownTenantLabel))
+
+	interceptor(context.Background(), &helloworld.HelloRequest{Name: "alice"}, &grpc.UnaryServerInfo{FullMethod: "/other/SayHello"}, h.handle)
+	interceptor(context.Background(), &helloworld.HelloRequest{Name: "alice"}, &grpc.UnaryServerInfo{FullMethod: "/other/SayHello"}, h.handle)
+	assert.Equal(t, 4, h.calls)
+}
+
+func TestResponseCacheExpiration(t *testing.T) {
+	cache := NewResponseCache(WithCachedMethod("/greeter/*", CachedMethod{TTL: time.Minute}))
+	now := time.Now()
+	cache.cache.Now = func() time.Time { return now }
+	interceptor := cache.UnaryServerInterceptor()
+	h := &countingHandler{}
+	info := &grpc.UnaryServerInfo{FullMethod: "/greeter/SayHello"}
+
+	interceptor(context.Background(), &helloworld.HelloRequest{Name: "alice"}, info, h.handle)
+	now = now.Add(time.Minute)
+	interceptor(context.Background(), &helloworld.HelloRequest{Name: "alice"}, info, h.handle)
+	assert.Equal(t, 2, h.calls)
+}
+
+func TestResponseCacheSkipsErrors(t *testing.T) {
+	cache := NewResponseCache(WithCachedMethod("/greeter/*", CachedMethod{TTL: time.Minute}))
+	interceptor := cache.UnaryServerInterceptor()
+	h := &countingHandler{err: status.Error(codes.NotFound, "missing")}
+	info := &grpc.UnaryServerInfo{FullMethod: "/greeter/SayHello"}
+
+	interceptor(context.Background(), &helloworld.HelloRequest{Name: "alice"}, info, h.handle)
+	_, err := interceptor(context.Background(), &helloworld.HelloRequest{Name: "alice"}, info, h.handle)
+	assert.Equal(t, codes.NotFound, status.Code(err))
+	assert.Equal(t, 2, h.calls)
+}
+
+func TestResponseCacheControlHeader(t *testing.T) {
+	cache := NewResponseCache(WithCachedMethod("/greeter/*", CachedMethod{TTL: time.Minute}))
+	interceptor := cache.UnaryServerInterceptor()
+	h := &countingHandler{}
+	info := &grpc.UnaryServerInfo{FullMethod: "/greeter/SayHello"}
+	req := &helloworld.HelloRequest{Name: "alice"}
+	noStore := metadata.NewIncomingContext(context.Background(), metadata.Pairs(CacheControlHeader, "No-Store"))
+	noCache := metadata.NewIncomingContext(context.Background(), metadata.Pairs(CacheControlHeader, "max-age=0, no-cache"))
+
+	interceptor(noStore, req, info, h.handle)
+	interceptor(context.Background(), req, info, h.handle)
+	interceptor(context.Background(), req, info, h.handle)
+	assert.Equal(t, 2, h.calls)
+	interceptor(noCache, req, info, h.handle)
+	assert.Equal(t, 3, h.calls)
+}
+
+func TestResponseCacheVary(t *testing.T) {
+	cache := NewResponseCache(WithCachedMethod("/greeter/*", CachedMethod{TTL: time.Minute, VaryByTenant: true}))
+	interceptor := cache.UnaryServerInterceptor()
+	h := &countingHandler{}
+	info := &grpc.UnaryServerInfo{FullMethod: "/greeter/SayHello"}
+	req := &helloworld.HelloRequest{Name: "alice"}
+	alice := ContextWithPrincipal(context.Background(), "alice")
+	bob := ContextWithPrincipal(context.Background(), "bob")
+	otherTenant := ContextWithTenant(alice, "acme")
+
+	interceptor(alice, req, info, h.handle)
+	interceptor(alice, req, info, h.handle)
+	interceptor(bob, req, info, h.handle)
+	interceptor(otherTenant, req, info, h.handle)
+	assert.Equal(t, 3, h.calls)
+}
+
+func TestResponseCacheSharedAcrossPrincipals(t *testing.T) {
+	cache := NewResponseCache(WithCachedMethod("/greeter/*", CachedMethod{TTL: time.Minute, SharedAcrossPrincipals: true}))
+	interceptor := cache.UnaryServerInterceptor()
+	h := &countingHandler{}
+	info := &grpc.UnaryServerInfo{FullMethod: "/greeter/SayHello"}
+	req := &helloworld.HelloRequest{Name: "alice"}
+
+	interceptor(ContextWithPrincipal(context.Background(), "alice"), req, info, h.handle)
+	interceptor(ContextWithPrincipal(context.Background(), "bob"), req, info, h.handle)
+	assert.Equal(t, 1, h.calls)
+}
+
+// headerStream records the headers set by the interceptors
+type headerStream struct {
+	header metadata.MD
+}
+
+func (s *headerStream) Method() string {
+	return "/greeter/SayHello"
+}
+
+func (s *headerStream) SetHeader(md metadata.MD) error {
+	s.header = metadata.Join(s.header, md)
+	return nil
+}
+
+func (s *headerStream) SendHeader(md metadata.MD) error {
+	return s.SetHeader(md)
+}
+
+func (s *headerStream) SetTrailer(md metadata.MD) error {
+	return nil
+}
+
+func TestResponseCacheSendsMaxAge(t *testing.T) {
+	cache := NewResponseCache(WithCachedMethod("/greeter/*", CachedMethod{TTL: time.Minute}))
+	now := time.Now()
+	cache.cache.Now = func() time.Time { return now }
+	interceptor := cache.UnaryServerInterceptor()
+	h := &countingHandler{}
+	info := &grpc.UnaryServerInfo{FullMethod: "/greeter/SayHello"}
+	req := &helloworld.HelloRequest{Name: "alice"}
+
+	stored := &headerStream{}
+	interceptor(grpc.NewContextWithServerTransportStream(context.Background(), stored), req, info, h.handle)
+	assert.Equal(t, []string{"max-age=60"}, stored.header.Get(CacheControlHeader))
+
+	now = now.Add(15 * time.Second)
+	hit := &headerStream{}
+	interceptor(grpc.NewContextWithServerTransportStream(context.Background(), hit), req, info, h.handle)
+	assert.Equal(t, 1, h.calls)
+	assert.Equal(t, []string{"max-age=45"}, hit.header.Get(CacheControlHeader))
+
+	noStore := &headerStream{}
+	ctx := metadata.NewIncomingContext(grpc.NewContextWithServerTransportStream(context.Background(), noStore), metadata.Pairs(CacheControlHeader, "no-store"))
+	interceptor(ctx, req, info, h.handle)
+	assert.Empty(t, noStore.header.Get(CacheControlHeader))
+}
+
+func TestResponseCacheInvalidation(t *testing.T) {
+	cache := NewResponseCache(WithCachedMethod("/greeter/*", CachedMethod{TTL: time.Minute}))
+	interceptor := cache.UnaryServerInterceptor()
+	h := &countingHandler{}
+	info := &grpc.UnaryServerInfo{FullMethod: "/greeter/SayHello"}
+	alice := &helloworld.HelloRequest{Name: "alice"}
+	bob := &helloworld.HelloRequest{Name: "bob"}
+
+	interceptor(ContextWithPrincipal(context.Background(), "p1"), alice, info, h.handle)
+	interceptor(ContextWithPrincipal(context.Background(), "p2"), alice, info, h.handle)
+	interceptor(context.Background(), bob, info, h.handle)
+	assert.Equal(t, 3, cache.cache.Len())
+
+	assert.NoError(t, cache.Invalidate("/greeter/SayHello", alice))
+	assert.Equal(t, 1, cache.cache.Len())
+
+	interceptor(context.Background(), alice, &grpc.UnaryServerInfo{FullMethod: "/greeter/SayHi"}, h.handle)
+	assert.Equal(t, 1, cache.InvalidateMethod("/greeter/SayHello"))
+	assert.Equal(t, 1, cache.cache.Len())
+	cache.Purge()
+	assert.Equal(t, 0, cache.cache.Len())
+}
@@ -36,5 +36,6 @@ func securityContextHandle(ctx context.Context) (context.Context, error) {
 		name string
 	}
 	newCtx := context.WithValue(ctx, "authInfo", authInfo{"foo"})
+	newCtx = ContextWithPrincipal(newCtx, user[0])
 	return newCtx, nil
 }
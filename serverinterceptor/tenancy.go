@@ -0,0 +1,365 @@
+package interceptors
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"github.com/apssouza22/grpc-production-go/baggage"
+	"github.com/apssouza22/grpc-production-go/internal/glob"
+	"github.com/apssouza22/grpc-production-go/metrics"
+	grpc_middleware "github.com/grpc-ecosystem/go-grpc-middleware"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"strings"
+)
+
+// DefaultTenantHeader is the metadata key read by the default tenant extractor
+const DefaultTenantHeader = "x-tenant-id"
+
+// TenantRequestsMetric counts the calls checked by the tenancy interceptors, labeled by tenant, method and outcome
+const TenantRequestsMetric = "grpc_server_tenant_requests_total"
+
+// Outcomes of the tenancy check, the outcome label of TenantRequestsMetric
+const (
+	TenantAccepted = "accepted"
+	TenantRejected = "rejected"
+	TenantLimited  = "limited"
+)
+
+// UnknownTenantLabel is the tenant label of the calls rejected for a missing or unknown tenant, and of every call
+// when no registry validates the tenants, so the values sent by the callers never become labels
+const UnknownTenantLabel = "unknown"
+
+// DefaultTenancyExcludedMethods are the methods not requiring a tenant when no exclusion is configured
+var DefaultTenancyExcludedMethods = []string{"/grpc.health.v1.Health/*"}
+
+// TenantExtractor extracts the tenant of the call
+type TenantExtractor func(ctx context.Context) (string, bool)
+
+// TenantRegistry validates the tenants
+type TenantRegistry interface {
+	// Exists checks whether the tenant is known
+	Exists(ctx context.Context, tenant string) (bool, error)
+}
+
+// StaticTenantRegistry is a TenantRegistry backed by a fixed set of tenants
+type StaticTenantRegistry map[string]struct{}
+
+// NewStaticTenantRegistry creates a registry knowing the given tenants
+func NewStaticTenantRegistry(tenants ...string) StaticTenantRegistry {
+	registry := make(StaticTenantRegistry, len(tenants))
+	for _, tenant := range tenants {
+		registry[tenant] = struct{}{}
+	}
+	return registry
+}
+
+// Exists checks whether the tenant is part of the set
+func (r StaticTenantRegistry) Exists(ctx context.Context, tenant string) (bool, error) {
+	_, ok := r[tenant]
+	return ok, nil
+}
+
+// TenantLimiter is the hook to enforce per-tenant limits (rate limits, concurrency quotas, ...)
+type TenantLimiter interface {
+	// Acquire is called before the handler with the tenant validated by the registry, UnknownTenantLabel for every
+	// call when there is no registry. The release function is called once the call is finished.
+	// Returning an error rejects the call with it, usually a ResourceExhausted status
+	Acquire(ctx context.Context, tenant string, fullMethod string) (release func(), err error)
+}
+
+// TenancyOption configures the tenancy interceptors
+type TenancyOption func(*tenancyConfig)
+
+type tenancyConfig struct {
+	extractors      []TenantExtractor
+	registry        TenantRegistry
+	limiters        []TenantLimiter
+	excludedMethods []string
+	metrics         metrics.Provider
+	requests        metrics.Counter
+}
+
+// WithTenantExtractors sets the extractors, tried in order until one finds the tenant.
+// The default extractor reads the x-tenant-id header
+func WithTenantExtractors(extractors ...TenantExtractor) TenancyOption {
+	return func(c *tenancyConfig) {
+		c.extractors = extractors
+	}
+}
+
+// WithTenantRegistry rejects the calls whose tenant is not known by the registry.
+// Only the tenants validated by the registry label the metrics, see UnknownTenantLabel
+func WithTenantRegistry(registry TenantRegistry) TenancyOption {
+	return func(c *tenancyConfig) {
+		c.registry = registry
+	}
+}
+
+// WithTenantLimiters adds the per-tenant limiters, acquired in order.
+// Only the tenants validated by the registry get their own limits. Without registry the callers could get new limits
+// by sending a new tenant on each call, so all of them share the limits of UnknownTenantLabel
+func WithTenantLimiters(limiters ...TenantLimiter) TenancyOption {
+	return func(c *tenancyConfig) {
+		c.limiters = append(c.limiters, limiters...)
+	}
+}
+
+// WithTenantExcludedMethods sets the globs of the methods not requiring a tenant.
+// It replaces DefaultTenancyExcludedMethods, include them again if the health check should still be excluded
+func WithTenantExcludedMethods(globs ...string) TenancyOption {
+	return func(c *tenancyConfig) {
+		c.excludedMethods = globs
+	}
+}
+
+// WithTenancyMetrics sets the provider of the TenantRequestsMetric counter. The default provider is used otherwise
+func WithTenancyMetrics(provider metrics.Provider) TenancyOption {
+	return func(c *tenancyConfig) {
+		c.metrics = provider
+	}
+}
+
+func newTenancyConfig(opts []TenancyOption) *tenancyConfig {
+	cfg := &tenancyConfig{
+		extractors:      []TenantExtractor{TenantFromMetadata(DefaultTenantHeader)},
+		excludedMethods: DefaultTenancyExcludedMethods,
+	}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	cfg.metrics = metrics.OrDefault(cfg.metrics)
+	cfg.requests = cfg.metrics.Counter(TenantRequestsMetric)
+	return cfg
+}
+
+// UnaryTenancy extracts and validates the tenant of the call, rejecting unknown tenants.
+// The tenant is stored in the context (see TenantFromContext), added to the audit events and propagated downstream as baggage.
+// The accepted, rejected and limited calls are counted per tenant by TenantRequestsMetric, see UnknownTenantLabel
+func UnaryTenancy(opts ...TenancyOption) grpc.UnaryServerInterceptor {
+	cfg := newTenancyConfig(opts)
+	return func(
+		ctx context.Context,
+		req interface{},
+		info *grpc.UnaryServerInfo,
+		handler grpc.UnaryHandler) (_ interface{}, err error) {
+		if glob.MatchAny(cfg.excludedMethods, info.FullMethod) {
+			return handler(ctx, req)
+		}
+		ctx, release, err := cfg.admit(ctx, info.FullMethod)
+		if err != nil {
+			return nil, err
+		}
+		defer release()
+		return handler(ctx, req)
+	}
+}
+
+// StreamTenancy extracts and validates the tenant of the stream, rejecting unknown tenants
+func StreamTenancy(opts ...TenancyOption) grpc.StreamServerInterceptor {
+	cfg := newTenancyConfig(opts)
+	return func(
+		srv interface{},
+		stream grpc.ServerStream,
+		info *grpc.StreamServerInfo,
+		handler grpc.StreamHandler) (err error) {
+		if glob.MatchAny(cfg.excludedMethods, info.FullMethod) {
+			return handler(srv, stream)
+		}
+		ctx, release, err := cfg.admit(stream.Context(), info.FullMethod)
+		if err != nil {
+			return err
+		}
+		defer release()
+		wrapped := grpc_middleware.WrapServerStream(stream)
+		wrapped.WrappedContext = ctx
+		return handler(srv, wrapped)
+	}
+}
+
+// admit extracts and validates the tenant and acquires the limiters, counting the outcome
+func (c *tenancyConfig) admit(ctx context.Context, fullMethod string) (context.Context, func(), error) {
+	ctx, tenant, release, outcome, err := c.check(ctx, fullMethod)
+	c.requests.Add(1, "tenant", tenant, "method", fullMethod, "outcome", outcome)
+	return ctx, release, err
+}
+
+// check returns the context with the tenant, the tenant label and the outcome of the check.
+// The tenant is its own label, and has its own limits, only when the registry validated it
+func (c *tenancyConfig) check(ctx context.Context, fullMethod string) (context.Context, string, func(), string, error) {
+	tenant := ""
+	for _, extract := range c.extractors {
+		if value, ok := extract(ctx); ok && value != "" {
+			tenant = value
+			break
+		}
+	}
+	if tenant == "" {
+		return nil, UnknownTenantLabel, nil, TenantRejected, status.Errorf(codes.InvalidArgument, "missing tenant")
+	}
+	if c.registry != nil {
+		exists, err := c.registry.Exists(ctx, tenant)
+		if err != nil {
+			return nil, UnknownTenantLabel, nil, TenantRejected, status.Errorf(codes.Unavailable, "unable to validate the tenant")
+		}
+		if !exists {
+			return nil, UnknownTenantLabel, nil, TenantRejected, status.Errorf(codes.PermissionDenied, "unknown tenant %q", tenant)
+		}
+	}
+	label := UnknownTenantLabel
+	if c.registry != nil {
+		label = tenant
+	}
+	ctx = ContextWithTenant(ctx, tenant)
+	ctx = contextWithTenantLabel(ctx, label)
+
+	releases := make([]func(), 0, len(c.limiters))
+	release := func() {
+		for i := len(releases) - 1; i >= 0; i-- {
+			releases[i]()
+		}
+	}
+	for _, limiter := range c.limiters {
+		done, err := limiter.Acquire(ctx, label, fullMethod)
+		if err != nil {
+			release()
+			return nil, label, nil, TenantLimited, err
+		}
+		if done != nil {
+			releases = append(releases, done)
+		}
+	}
+	return ctx, label, release, TenantAccepted, nil
+}
+
+type tenantKey struct{}
+
+type tenantLabelKey struct{}
+
+// ContextWithTenant returns a context carrying the tenant of the call, also propagated downstream as baggage
+func ContextWithTenant(ctx context.Context, tenant string) context.Context {
+	if record := callRecordFromContext(ctx); record != nil {
+		record.setTenant(tenant)
+	}
+	ctx = context.WithValue(ctx, tenantKey{}, tenant)
+	return baggage.WithTenant(ctx, tenant)
+}
+
+// TenantFromContext returns the tenant of the call set by ContextWithTenant.
+// The tenant of the incoming baggage is not returned: it is set by the caller and not validated.
+// It is validated only when the tenancy interceptors have a registry, do not label metrics with it otherwise
+func TenantFromContext(ctx context.Context) (string, bool) {
+	tenant, _ := ctx.Value(tenantKey{}).(string)
+	return tenant, tenant != ""
+}
+
+func contextWithTenantLabel(ctx context.Context, label string) context.Context {
+	if record := callRecordFromContext(ctx); record != nil {
+		record.setTenantLabel(label)
+	}
+	return context.WithValue(ctx, tenantLabelKey{}, label)
+}
+
+// tenantLabel returns the tenant label of the metrics set by the tenancy interceptors, also known by the interceptors
+// wrapping the tenancy one when the call is audited. UnknownTenantLabel when the call was not checked by the tenancy interceptors
+func tenantLabel(ctx context.Context) string {
+	if label, ok := ctx.Value(tenantLabelKey{}).(string); ok {
+		return label
+	}
+	if record := callRecordFromContext(ctx); record != nil {
+		if label := record.getTenantLabel(); label != "" {
+			return label
+		}
+	}
+	return UnknownTenantLabel
+}
+
+// TenantFromMetadata extracts the tenant from the incoming metadata key
+func TenantFromMetadata(key string) TenantExtractor {
+	return func(ctx context.Context) (string, bool) {
+		md, ok := metadata.FromIncomingContext(ctx)
+		if !ok {
+			return "", false
+		}
+		values := md.Get(key)
+		if len(values) == 0 {
+			return "", false
+		}
+		return values[0], true
+	}
+}
+
+// TenantFromPrincipal extracts the tenant from the authenticated principal (see ContextWithPrincipal)
+func TenantFromPrincipal(parse func(principal string) (string, bool)) TenantExtractor {
+	return func(ctx context.Context) (string, bool) {
+		principal, ok := PrincipalFromContext(ctx)
+		if !ok {
+			return "", false
+		}
+		return parse(principal)
+	}
+}
+
+// TenantFromJWTClaim extracts the tenant from a claim of the bearer token in the authorization header.
+// The token signature is NOT verified, place it after the interceptor authenticating the token
+func TenantFromJWTClaim(claim string) TenantExtractor {
+	return func(ctx context.Context) (string, bool) {
+		md, ok := metadata.FromIncomingContext(ctx)
+		if !ok {
+			return "", false
+		}
+		values := md.Get("authorization")
+		if len(values) == 0 {
+			return "", false
+		}
+		token := strings.TrimSpace(values[0])
+		if len(token) < 7 || !strings.EqualFold(token[:7], "bearer ") {
+			return "", false
+		}
+		parts := strings.Split(token[7:], ".")
+		if len(parts) != 3 {
+			return "", false
+		}
+		payload, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(parts[1], "="))
+		if err != nil {
+			return "", false
+		}
+		var claims map[string]interface{}
+		if err := json.Unmarshal(payload, &claims); err != nil {
+			return "", false
+		}
+		tenant, ok := claims[claim].(string)
+		return tenant, ok
+	}
+}
+
+// TenantFromTLSSAN extracts the tenant from the subject alternative names (DNS names and URIs)
+// of the client certificate. The parse function is called for each SAN until it finds the tenant
+func TenantFromTLSSAN(parse func(san string) (string, bool)) TenantExtractor {
+	return func(ctx context.Context) (string, bool) {
+		p, ok := peer.FromContext(ctx)
+		if !ok {
+			return "", false
+		}
+		tlsInfo, ok := p.AuthInfo.(credentials.TLSInfo)
+		if !ok || len(tlsInfo.State.PeerCertificates) == 0 {
+			return "", false
+		}
+		cert := tlsInfo.State.PeerCertificates[0]
+		for _, san := range cert.DNSNames {
+			if tenant, ok := parse(san); ok {
+				return tenant, true
+			}
+		}
+		for _, uri := range cert.URIs {
+			if tenant, ok := parse(uri.String()); ok {
+				return tenant, true
+			}
+		}
+		return "", false
+	}
+}
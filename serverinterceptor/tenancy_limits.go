@@ -0,0 +1,104 @@
+package interceptors
+
+import (
+	"context"
+	"github.com/apssouza22/grpc-production-go/internal/lru"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"sync"
+	"time"
+)
+
+// TenantConcurrencyLimiter caps the number of in-flight calls per tenant
+type TenantConcurrencyLimiter struct {
+	mu           sync.Mutex
+	defaultLimit int
+	limits       map[string]int
+	inFlight     map[string]int
+}
+
+// NewTenantConcurrencyLimiter creates a limiter allowing defaultLimit in-flight calls per tenant,
+// overridden per tenant by limits. A limit <= 0 means unlimited
+func NewTenantConcurrencyLimiter(defaultLimit int, limits map[string]int) *TenantConcurrencyLimiter {
+	return &TenantConcurrencyLimiter{
+		defaultLimit: defaultLimit,
+		limits:       limits,
+		inFlight:     make(map[string]int),
+	}
+}
+
+// Acquire reserves an in-flight slot for the tenant
+func (l *TenantConcurrencyLimiter) Acquire(ctx context.Context, tenant string, fullMethod string) (func(), error) {
+	limit := l.defaultLimit
+	if tenantLimit, ok := l.limits[tenant]; ok {
+		limit = tenantLimit
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if limit > 0 && l.inFlight[tenant] >= limit {
+		return nil, status.Errorf(codes.ResourceExhausted, "too many concurrent requests for tenant %q", tenant)
+	}
+	l.inFlight[tenant]++
+	return func() {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		l.inFlight[tenant]--
+		if l.inFlight[tenant] <= 0 {
+			delete(l.inFlight, tenant)
+		}
+	}, nil
+}
+
+// MaxRateLimitedTenants is the number of tenant buckets kept by TenantRateLimiter. Beyond it the least recently used
+// bucket is dropped, its tenant starting again with a full burst
+const MaxRateLimitedTenants = 10000
+
+// TenantRateLimiter caps the number of calls per second per tenant
+type TenantRateLimiter struct {
+	mu          sync.Mutex
+	defaultRate float64
+	rates       map[string]float64
+	burst       int
+	buckets     *lru.Cache
+	now         func() time.Time
+}
+
+// NewTenantRateLimiter creates a limiter allowing defaultRate calls per second per tenant with the given burst,
+// overridden per tenant by rates. A rate <= 0 means unlimited. Up to MaxRateLimitedTenants buckets are kept
+func NewTenantRateLimiter(defaultRate float64, burst int, rates map[string]float64) *TenantRateLimiter {
+	if burst <= 0 {
+		burst = 1
+	}
+	return &TenantRateLimiter{
+		defaultRate: defaultRate,
+		rates:       rates,
+		burst:       burst,
+		buckets:     lru.New(MaxRateLimitedTenants, 0),
+		now:         time.Now,
+	}
+}
+
+// Acquire takes a token from the tenant bucket
+func (l *TenantRateLimiter) Acquire(ctx context.Context, tenant string, fullMethod string) (func(), error) {
+	rate := l.defaultRate
+	if tenantRate, ok := l.rates[tenant]; ok {
+		rate = tenantRate
+	}
+	if rate <= 0 {
+		return nil, nil
+	}
+	now := l.now()
+	l.mu.Lock()
+	var bucket *tokenBucket
+	if cached, ok := l.buckets.Get(tenant); ok {
+		bucket = cached.(*tokenBucket)
+	} else {
+		bucket = newTokenBucket(rate, l.burst, now)
+		l.buckets.Add(tenant, bucket, 0, time.Time{})
+	}
+	l.mu.Unlock()
+	if !bucket.take(now) {
+		return nil, status.Errorf(codes.ResourceExhausted, "rate limit exceeded for tenant %q", tenant)
+	}
+	return nil, nil
+}
@@ -0,0 +1,57 @@
+package interceptors
+
+import (
+	"context"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"testing"
+	"time"
+)
+
+func TestTenantConcurrencyLimiter(t *testing.T) {
+	limiter := NewTenantConcurrencyLimiter(1, map[string]int{"big": 2})
+	release, err := limiter.Acquire(context.Background(), "acme", "/svc/Method")
+	assert.NoError(t, err)
+	_, err = limiter.Acquire(context.Background(), "acme", "/svc/Method")
+	assert.Equal(t, codes.ResourceExhausted, status.Code(err))
+	release()
+	_, err = limiter.Acquire(context.Background(), "acme", "/svc/Method")
+	assert.NoError(t, err)
+
+	for i := 0; i < 2; i++ {
+		_, err = limiter.Acquire(context.Background(), "big", "/svc/Method")
+		assert.NoError(t, err)
+	}
+	_, err = limiter.Acquire(context.Background(), "big", "/svc/Method")
+	assert.Error(t, err)
+}
+
+func TestTenantRateLimiter(t *testing.T) {
+	now := time.Now()
+	limiter := NewTenantRateLimiter(1, 1, map[string]float64{"free": 0})
+	limiter.now = func() time.Time { return now }
+
+	_, err := limiter.Acquire(context.Background(), "acme", "/svc/Method")
+	assert.NoError(t, err)
+	_, err = limiter.Acquire(context.Background(), "acme", "/svc/Method")
+	assert.Equal(t, codes.ResourceExhausted, status.Code(err))
+	now = now.Add(time.Second)
+	_, err = limiter.Acquire(context.Background(), "acme", "/svc/Method")
+	assert.NoError(t, err)
+
+	for i := 0; i < 5; i++ {
+		_, err = limiter.Acquire(context.Background(), "free", "/svc/Method")
+		assert.NoError(t, err)
+	}
+}
+
+func TestTenantRateLimiterBoundsBuckets(t *testing.T) {
+	limiter := NewTenantRateLimiter(1, 1, nil)
+	for i := 0; i < MaxRateLimitedTenants+10; i++ {
+		_, err := limiter.Acquire(context.Background(), fmt.Sprintf("tenant-%d", i), "/svc/Method")
+		assert.NoError(t, err)
+	}
+	assert.Equal(t, MaxRateLimitedTenants, limiter.buckets.Len())
+}
@@ -0,0 +1,245 @@
+package interceptors
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"github.com/apssouza22/grpc-production-go/baggage"
+	"github.com/apssouza22/grpc-production-go/metrics"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"strings"
+	"testing"
+)
+
+func TestUnaryTenancy(t *testing.T) {
+	interceptor := UnaryTenancy(WithTenantRegistry(NewStaticTenantRegistry("acme")))
+	var tenant string
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		tenant, _ = TenantFromContext(ctx)
+		return "ok", nil
+	}
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(DefaultTenantHeader, "acme"))
+	resp, err := interceptor(ctx, "req", &grpc.UnaryServerInfo{FullMethod: "/svc/Method"}, handler)
+	assert.NoError(t, err)
+	assert.Equal(t, "ok", resp)
+	assert.Equal(t, "acme", tenant)
+}
+
+func TestTenantNotTakenFromIncomingBaggage(t *testing.T) {
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(baggage.Header, "tenant-id=other"))
+	var tenant string
+	var found bool
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		tenant, found = TenantFromContext(ctx)
+		return "ok", nil
+	}
+	_, err := UnaryBaggage()(ctx, "req", &grpc.UnaryServerInfo{FullMethod: "/svc/Method"}, handler)
+	assert.NoError(t, err)
+	assert.False(t, found)
+	assert.Empty(t, tenant)
+}
+
+func TestUnaryTenancyRejections(t *testing.T) {
+	interceptor := UnaryTenancy(WithTenantRegistry(NewStaticTenantRegistry("acme")))
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return nil, nil
+	}
+	info := &grpc.UnaryServerInfo{FullMethod: "/svc/Method"}
+
+	_, err := interceptor(metadata.NewIncomingContext(context.Background(), metadata.MD{}), "req", info, handler)
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(DefaultTenantHeader, "evil"))
+	_, err = interceptor(ctx, "req", info, handler)
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	_, err = interceptor(context.Background(), "req", &grpc.UnaryServerInfo{FullMethod: "/grpc.health.v1.Health/Check"}, handler)
+	assert.NoError(t, err)
+}
+
+func TestUnaryTenancyRegistryError(t *testing.T) {
+	interceptor := UnaryTenancy(WithTenantRegistry(failingRegistry{}))
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(DefaultTenantHeader, "acme"))
+	_, err := interceptor(ctx, "req", &grpc.UnaryServerInfo{FullMethod: "/svc/Method"}, func(ctx context.Context, req interface{}) (interface{}, error) {
+		return nil, nil
+	})
+	assert.Equal(t, codes.Unavailable, status.Code(err))
+}
+
+func TestStreamTenancy(t *testing.T) {
+	interceptor := StreamTenancy()
+	var tenant string
+	handler := func(srv interface{}, stream grpc.ServerStream) error {
+		tenant, _ = TenantFromContext(stream.Context())
+		return nil
+	}
+	err := interceptor(nil, tenantStreamMock{}, &grpc.StreamServerInfo{FullMethod: "/svc/Method"}, handler)
+	assert.NoError(t, err)
+	assert.Equal(t, "acme", tenant)
+}
+
+func TestTenancyRecordedInAuditEvent(t *testing.T) {
+	sink := &MemorySink{}
+	audit := UnaryAuditServiceRequest(WithAuditSink(sink))
+	tenancy := UnaryTenancy()
+	info := &grpc.UnaryServerInfo{FullMethod: "/svc/Method"}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return "ok", nil
+	}
+	_, err := audit(ServerStreamMock{}.Context(), "req", info, func(ctx context.Context, req interface{}) (interface{}, error) {
+		md, _ := metadata.FromIncomingContext(ctx)
+		md = md.Copy()
+		md.Set(DefaultTenantHeader, "acme")
+		return tenancy(metadata.NewIncomingContext(ctx, md), req, info, handler)
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "acme", sink.Events()[0].Tenant)
+}
+
+func TestTenancyLimitersReleasedInReverseOrder(t *testing.T) {
+	var calls []string
+	first := &recordingLimiter{name: "first", calls: &calls}
+	second := &recordingLimiter{name: "second", calls: &calls}
+	interceptor := UnaryTenancy(WithTenantLimiters(first, second))
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(DefaultTenantHeader, "acme"))
+	_, err := interceptor(ctx, "req", &grpc.UnaryServerInfo{FullMethod: "/svc/Method"}, func(ctx context.Context, req interface{}) (interface{}, error) {
+		calls = append(calls, "handler")
+		return nil, nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"acquire first", "acquire second", "handler", "release second", "release first"}, calls)
+}
+
+func TestTenancyLimiterRejection(t *testing.T) {
+	var calls []string
+	first := &recordingLimiter{name: "first", calls: &calls}
+	second := &recordingLimiter{name: "second", calls: &calls, err: status.Error(codes.ResourceExhausted, "quota")}
+	interceptor := UnaryTenancy(WithTenantLimiters(first, second))
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(DefaultTenantHeader, "acme"))
+	_, err := interceptor(ctx, "req", &grpc.UnaryServerInfo{FullMethod: "/svc/Method"}, func(ctx context.Context, req interface{}) (interface{}, error) {
+		calls = append(calls, "handler")
+		return nil, nil
+	})
+	assert.Equal(t, codes.ResourceExhausted, status.Code(err))
+	assert.Equal(t, []string{"acquire first", "acquire second", "release first"}, calls)
+}
+
+func TestTenancyLimitsUnvalidatedTenantsTogether(t *testing.T) {
+	info := &grpc.UnaryServerInfo{FullMethod: "/svc/Method"}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return nil, nil
+	}
+	call := func(interceptor grpc.UnaryServerInterceptor, tenant string) error {
+		_, err := interceptor(metadata.NewIncomingContext(context.Background(), metadata.Pairs(DefaultTenantHeader, tenant)), "req", info, handler)
+		return err
+	}
+
+	unvalidated := UnaryTenancy(WithTenantLimiters(NewTenantRateLimiter(0.001, 1, nil)))
+	assert.NoError(t, call(unvalidated, "a"))
+	assert.Equal(t, codes.ResourceExhausted, status.Code(call(unvalidated, "b")))
+
+	validated := UnaryTenancy(
+		WithTenantRegistry(NewStaticTenantRegistry("acme", "globex")),
+		WithTenantLimiters(NewTenantRateLimiter(0.001, 1, nil)),
+	)
+	assert.NoError(t, call(validated, "acme"))
+	assert.NoError(t, call(validated, "globex"))
+	assert.Equal(t, codes.ResourceExhausted, status.Code(call(validated, "acme")))
+}
+
+func TestTenancyMetrics(t *testing.T) {
+	provider := metrics.NewMemory()
+	limiter := &recordingLimiter{name: "quota", calls: &[]string{}}
+	interceptor := UnaryTenancy(
+		WithTenantRegistry(NewStaticTenantRegistry("acme", "globex")),
+		WithTenantLimiters(limiter),
+		WithTenancyMetrics(provider),
+	)
+	info := &grpc.UnaryServerInfo{FullMethod: "/svc/Method"}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return nil, nil
+	}
+	call := func(tenant string) {
+		interceptor(metadata.NewIncomingContext(context.Background(), metadata.Pairs(DefaultTenantHeader, tenant)), "req", info, handler)
+	}
+	call("acme")
+	call("evil")
+	limiter.err = status.Error(codes.ResourceExhausted, "quota")
+	call("globex")
+
+	assert.Equal(t, float64(1), provider.Value(TenantRequestsMetric, "tenant", "acme", "method", "/svc/Method", "outcome", TenantAccepted))
+	assert.Equal(t, float64(1), provider.Value(TenantRequestsMetric, "tenant", UnknownTenantLabel, "method", "/svc/Method", "outcome", TenantRejected))
+	assert.Equal(t, float64(1), provider.Value(TenantRequestsMetric, "tenant", "globex", "method", "/svc/Method", "outcome", TenantLimited))
+}
+
+func TestTenancyMetricsWithoutRegistry(t *testing.T) {
+	provider := metrics.NewMemory()
+	interceptor := UnaryTenancy(WithTenancyMetrics(provider))
+	info := &grpc.UnaryServerInfo{FullMethod: "/svc/Method"}
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(DefaultTenantHeader, "made-up"))
+	var label string
+	interceptor(ctx, "req", info, func(ctx context.Context, req interface{}) (interface{}, error) {
+		label = tenantLabel(ctx)
+		return nil, nil
+	})
+
+	assert.Equal(t, UnknownTenantLabel, label)
+	assert.Equal(t, float64(1), provider.Value(TenantRequestsMetric, "tenant", UnknownTenantLabel, "method", "/svc/Method", "outcome", TenantAccepted))
+	assert.Equal(t, float64(0), provider.Value(TenantRequestsMetric, "tenant", "made-up", "method", "/svc/Method", "outcome", TenantAccepted))
+}
+
+func TestTenantFromJWTClaim(t *testing.T) {
+	payload := base64.RawURLEncoding.EncodeToString([]byte(`{"sub":"alice","tenant":"acme"}`))
+	token := strings.Join([]string{"e30", payload, "sig"}, ".")
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("authorization", "Bearer "+token))
+	tenant, ok := TenantFromJWTClaim("tenant")(ctx)
+	assert.True(t, ok)
+	assert.Equal(t, "acme", tenant)
+
+	_, ok = TenantFromJWTClaim("org")(ctx)
+	assert.False(t, ok)
+}
+
+func TestTenantFromPrincipal(t *testing.T) {
+	extract := TenantFromPrincipal(func(principal string) (string, bool) {
+		parts := strings.SplitN(principal, "@", 2)
+		return parts[len(parts)-1], len(parts) == 2
+	})
+	tenant, ok := extract(ContextWithPrincipal(context.Background(), "alice@acme"))
+	assert.True(t, ok)
+	assert.Equal(t, "acme", tenant)
+}
+
+type failingRegistry struct{}
+
+func (failingRegistry) Exists(ctx context.Context, tenant string) (bool, error) {
+	return false, errors.New("down")
+}
+
+type recordingLimiter struct {
+	name  string
+	calls *[]string
+	err   error
+}
+
+func (l *recordingLimiter) Acquire(ctx context.Context, tenant string, fullMethod string) (func(), error) {
+	*l.calls = append(*l.calls, "acquire "+l.name)
+	if l.err != nil {
+		return nil, l.err
+	}
+	return func() {
+		*l.calls = append(*l.calls, "release "+l.name)
+	}, nil
+}
+
+type tenantStreamMock struct {
+	ServerStreamMock
+}
+
+func (s tenantStreamMock) Context() context.Context {
+	return metadata.NewIncomingContext(context.Background(), metadata.Pairs(DefaultTenantHeader, "acme"))
+}
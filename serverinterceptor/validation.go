@@ -0,0 +1,134 @@
+package interceptors
+
+import (
+	"context"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// validator is implemented by the messages generated by protoc-gen-validate and similar plugins
+type validator interface {
+	Validate() error
+}
+
+// allValidator reports every violation instead of stopping at the first one
+type allValidator interface {
+	ValidateAll() error
+}
+
+// fieldError is implemented by the protoc-gen-validate field errors
+type fieldError interface {
+	Field() string
+	Reason() string
+}
+
+// ValidationOption configures the validation interceptors
+type ValidationOption func(*validationConfig)
+
+type validationConfig struct {
+	failFast bool
+}
+
+// WithValidationFailFast calls Validate even when the message implements ValidateAll,
+// reporting only the first violation
+func WithValidationFailFast() ValidationOption {
+	return func(c *validationConfig) {
+		c.failFast = true
+	}
+}
+
+func newValidationConfig(opts []ValidationOption) *validationConfig {
+	cfg := &validationConfig{}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	return cfg
+}
+
+// UnaryValidation validates the request message when it implements `Validate() error` or `ValidateAll() error`.
+// Failures are returned as InvalidArgument with the field violations in a BadRequest detail.
+// It is not part of the default interceptors (see grpcutils.GetDefaultUnaryServerInterceptors): add it to the chain
+// after the audit, so the rejected calls are audited, and before the recovery, which must stay last
+func UnaryValidation(opts ...ValidationOption) grpc.UnaryServerInterceptor {
+	cfg := newValidationConfig(opts)
+	return func(
+		ctx context.Context,
+		req interface{},
+		info *grpc.UnaryServerInfo,
+		handler grpc.UnaryHandler) (_ interface{}, err error) {
+		if err := cfg.validate(req); err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// StreamValidation validates every message received from the client. Like UnaryValidation it is not part of the default interceptors
+func StreamValidation(opts ...ValidationOption) grpc.StreamServerInterceptor {
+	cfg := newValidationConfig(opts)
+	return func(
+		srv interface{},
+		stream grpc.ServerStream,
+		info *grpc.StreamServerInfo,
+		handler grpc.StreamHandler) (err error) {
+		return handler(srv, &validatingServerStream{ServerStream: stream, cfg: cfg})
+	}
+}
+
+// validatingServerStream validates the received messages
+type validatingServerStream struct {
+	grpc.ServerStream
+	cfg *validationConfig
+}
+
+// RecvMsg validates the message received from the client
+func (s *validatingServerStream) RecvMsg(m interface{}) error {
+	if err := s.ServerStream.RecvMsg(m); err != nil {
+		return err
+	}
+	return s.cfg.validate(m)
+}
+
+// validate returns the InvalidArgument status describing the violations of the message, nil if it is valid
+func (c *validationConfig) validate(m interface{}) error {
+	var err error
+	if v, ok := m.(allValidator); ok && !c.failFast {
+		err = v.ValidateAll()
+	} else if v, ok := m.(validator); ok {
+		err = v.Validate()
+	}
+	if err == nil {
+		return nil
+	}
+	return withDetails(status.New(codes.InvalidArgument, err.Error()), &errdetails.BadRequest{FieldViolations: fieldViolations(err)})
+}
+
+// fieldViolations flattens the validation error, expanding the multi errors returned by ValidateAll
+// and joining the paths of the embedded message errors
+func fieldViolations(err error) []*errdetails.BadRequest_FieldViolation {
+	if multi, ok := err.(interface{ AllErrors() []error }); ok {
+		var violations []*errdetails.BadRequest_FieldViolation
+		for _, e := range multi.AllErrors() {
+			violations = append(violations, fieldViolations(e)...)
+		}
+		return violations
+	}
+	fe, ok := err.(fieldError)
+	if !ok {
+		return []*errdetails.BadRequest_FieldViolation{{Description: err.Error()}}
+	}
+	if cause, ok := err.(interface{ Cause() error }); ok && cause.Cause() != nil {
+		nested := fieldViolations(cause.Cause())
+		for _, violation := range nested {
+			if violation.Field == "" {
+				violation.Field = fe.Field()
+			} else {
+				violation.Field = fe.Field() + "." + violation.Field
+			}
+		}
+		return nested
+	}
+	return []*errdetails.BadRequest_FieldViolation{{Field: fe.Field(), Description: fe.Reason()}}
+}
@@ -0,0 +1,143 @@
+package interceptors
+
+import (
+	"context"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"strings"
+	"testing"
+)
+
+func TestUnaryValidation(t *testing.T) {
+	interceptor := UnaryValidation()
+	called := false
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		called = true
+		return nil, nil
+	}
+	info := &grpc.UnaryServerInfo{FullMethod: "/svc/Method"}
+
+	_, err := interceptor(context.Background(), &validatedMessage{}, info, handler)
+	assert.NoError(t, err)
+	assert.True(t, called)
+
+	called = false
+	_, err = interceptor(context.Background(), &validatedMessage{errs: []error{
+		testFieldError{field: "name", reason: "value is required"},
+		testFieldError{field: "address", reason: "embedded message failed validation", cause: testFieldError{field: "zip", reason: "invalid"}},
+	}}, info, handler)
+	assert.False(t, called)
+	assert.Equal(t, []*errdetails.BadRequest_FieldViolation{
+		{Field: "name", Description: "value is required"},
+		{Field: "address.zip", Description: "invalid"},
+	}, badRequestViolations(t, err))
+}
+
+func TestUnaryValidationFailFast(t *testing.T) {
+	interceptor := UnaryValidation(WithValidationFailFast())
+	msg := &validatedMessage{errs: []error{
+		testFieldError{field: "name", reason: "value is required"},
+		testFieldError{field: "age", reason: "must be positive"},
+	}}
+	_, err := interceptor(context.Background(), msg, &grpc.UnaryServerInfo{FullMethod: "/svc/Method"}, func(ctx context.Context, req interface{}) (interface{}, error) {
+		return nil, nil
+	})
+	assert.Equal(t, []*errdetails.BadRequest_FieldViolation{
+		{Field: "name", Description: "value is required"},
+	}, badRequestViolations(t, err))
+}
+
+func TestUnaryValidationPlainError(t *testing.T) {
+	interceptor := UnaryValidation()
+	msg := &simpleValidatedMessage{err: errors.New("bad request")}
+	_, err := interceptor(context.Background(), msg, &grpc.UnaryServerInfo{FullMethod: "/svc/Method"}, func(ctx context.Context, req interface{}) (interface{}, error) {
+		return nil, nil
+	})
+	assert.Equal(t, "bad request", status.Convert(err).Message())
+	assert.Equal(t, []*errdetails.BadRequest_FieldViolation{{Description: "bad request"}}, badRequestViolations(t, err))
+}
+
+func TestStreamValidation(t *testing.T) {
+	interceptor := StreamValidation()
+	var recvErr error
+	handler := func(srv interface{}, stream grpc.ServerStream) error {
+		recvErr = stream.RecvMsg(&simpleValidatedMessage{err: errors.New("bad message")})
+		return nil
+	}
+	interceptor(nil, ServerStreamMock{}, &grpc.StreamServerInfo{FullMethod: "/svc/Method"}, handler)
+	assert.Equal(t, codes.InvalidArgument, status.Code(recvErr))
+
+	handler = func(srv interface{}, stream grpc.ServerStream) error {
+		recvErr = stream.RecvMsg(&simpleValidatedMessage{})
+		return nil
+	}
+	interceptor(nil, ServerStreamMock{}, &grpc.StreamServerInfo{FullMethod: "/svc/Method"}, handler)
+	assert.NoError(t, recvErr)
+}
+
+func badRequestViolations(t *testing.T, err error) []*errdetails.BadRequest_FieldViolation {
+	sts := status.Convert(err)
+	assert.Equal(t, codes.InvalidArgument, sts.Code())
+	for _, detail := range sts.Details() {
+		if badRequest, ok := detail.(*errdetails.BadRequest); ok {
+			return badRequest.FieldViolations
+		}
+	}
+	t.Fatal("missing BadRequest detail")
+	return nil
+}
+
+type simpleValidatedMessage struct {
+	err error
+}
+
+func (m *simpleValidatedMessage) Validate() error {
+	return m.err
+}
+
+type validatedMessage struct {
+	errs []error
+}
+
+func (m *validatedMessage) Validate() error {
+	if len(m.errs) == 0 {
+		return nil
+	}
+	return m.errs[0]
+}
+
+func (m *validatedMessage) ValidateAll() error {
+	if len(m.errs) == 0 {
+		return nil
+	}
+	return testMultiError(m.errs)
+}
+
+type testMultiError []error
+
+func (m testMultiError) Error() string {
+	msgs := make([]string, len(m))
+	for i, err := range m {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "; ")
+}
+
+func (m testMultiError) AllErrors() []error {
+	return m
+}
+
+type testFieldError struct {
+	field  string
+	reason string
+	cause  error
+}
+
+func (e testFieldError) Field() string  { return e.field }
+func (e testFieldError) Reason() string { return e.reason }
+func (e testFieldError) Cause() error   { return e.cause }
+func (e testFieldError) Error() string  { return "invalid " + e.field + ": " + e.reason }
@@ -4,11 +4,11 @@ package testing
 
 import (
 	"crypto/tls"
+	"github.com/apssouza22/grpc-production-go/logging"
 	grpc_middleware "github.com/grpc-ecosystem/go-grpc-middleware"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials"
 	"google.golang.org/grpc/test/bufconn"
-	"log"
 	"os"
 	"os/signal"
 	"syscall"
@@ -26,6 +26,7 @@ type GrpcInProcessingServer interface {
 //GRPC in-processing server builder
 type GrpcInProcessingServerBuilder struct {
 	options []grpc.ServerOption
+	logger  logging.Logger
 }
 
 //DialOption configures how we set up the connection.
@@ -49,6 +50,11 @@ func (sb *GrpcInProcessingServerBuilder) SetUnaryInterceptors(interceptors []grp
 	sb.AddOption(chain)
 }
 
+// SetLogger sets the logger used by the server. The default logger is used otherwise
+func (sb *GrpcInProcessingServerBuilder) SetLogger(logger logging.Logger) {
+	sb.logger = logger
+}
+
 // SetTlsCert sets credentials for server connections
 func (sb *GrpcInProcessingServerBuilder) SetTlsCert(cert *tls.Certificate) {
 	sb.AddOption(grpc.Creds(credentials.NewServerTLSFromCert(cert)))
@@ -57,12 +63,13 @@ func (sb *GrpcInProcessingServerBuilder) SetTlsCert(cert *tls.Certificate) {
 //Build is responsible for building a Fiji GRPC server
 func (sb *GrpcInProcessingServerBuilder) Build() GrpcInProcessingServer {
 	server, listener := GetInProcessingGRPCServer(sb.options)
-	return &grpcServer{server, listener}
+	return &grpcServer{server, listener, logging.OrDefault(sb.logger)}
 }
 
 type grpcServer struct {
 	server   *grpc.Server
 	listener *bufconn.Listener
+	logger   logging.Logger
 }
 
 // GetListener register the services to the server
@@ -78,7 +85,7 @@ func (s *grpcServer) RegisterService(reg func(*grpc.Server)) {
 // Start the GRPC server
 func (s *grpcServer) Start() error {
 	go s.serv()
-	log.Printf("In processing server started")
+	s.logger.Info("In processing server started")
 	return nil
 }
 
@@ -97,11 +104,11 @@ func (s *grpcServer) AwaitTermination(shutdownHook func()) {
 func (s *grpcServer) Cleanup() {
 	s.server.Stop()
 	s.listener.Close()
-	log.Println("Server stopped")
+	s.logger.Info("Server stopped")
 }
 
 func (s *grpcServer) serv() {
-	if err := s.server.Serve(s.listener); err != nil {
-		log.Fatalf("failed to serve: %+v", err)
+	if err := s.server.Serve(s.listener); err != nil && err != grpc.ErrServerStopped {
+		s.logger.Error("failed to serve", "err", err)
 	}
 }